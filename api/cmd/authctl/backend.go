@@ -0,0 +1,157 @@
+package main
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/hashing"
+	"auth-service/internal/models"
+	"auth-service/internal/seeds"
+	"auth-service/internal/services"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// backend is what the subcommands run against, the database directly or
+// the admin HTTP API of a running server.
+type backend interface {
+	ListClients(filter *services.ClientFilter) ([]models.OAuth2Credential, int64, error)
+	CreateClient(req *services.CreateClientRequest) (*services.CreatedClient, error)
+	RotateSecret(clientID string, req *services.RotateSecretRequest) (*services.IssuedSecret, error)
+	DeleteClient(clientID string) error
+
+	ListConsumers(filter *services.ConsumerFilter) ([]models.Consumer, int64, error)
+	CreateConsumer(req *services.CreateConsumerRequest) (*models.Consumer, error)
+	UpdateConsumer(consumerID string, req *services.UpdateConsumerRequest) (*models.Consumer, error)
+	DeleteConsumer(consumerID string, cascade bool) error
+
+	CreateUser(req *services.CreateUserRequest) (*services.UserResponse, error)
+	DeactivateUser(userID uuid.UUID) error
+	AssignRole(userID uuid.UUID, role string) ([]models.Role, error)
+	RemoveRole(userID uuid.UUID, role string) ([]models.Role, error)
+
+	RevokeUserTokens(userID uuid.UUID) (int64, error)
+	RevokeClientTokens(clientID string) (int64, error)
+
+	Seed(clientsPath string) error
+}
+
+type dbBackend struct {
+	db            *gorm.DB
+	clientService *services.ClientService
+	userService   *services.UserService
+	rbacService   *services.RBACService
+}
+
+func newDBBackend(cfg *config.Config) (*dbBackend, error) {
+	db := config.InitDatabase(cfg)
+
+	hasher, err := hashing.New(cfg.Hashing)
+	if err != nil {
+		return nil, err
+	}
+	hashing.SetDefault(hasher)
+
+	var breachedFilter *services.BreachedPasswordFilter
+	if cfg.Password.BreachedFilterPath != "" {
+		filter, err := services.LoadBreachedPasswordFilter(cfg.Password.BreachedFilterPath)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load breached password filter: %w", err)
+		}
+		breachedFilter = filter
+	}
+	passwordPolicy := services.NewPasswordPolicy(cfg.Password, breachedFilter)
+
+	// None of the user operations here touch the image storage
+	return &dbBackend{
+		db:            db,
+		clientService: services.NewClientService(db, cfg),
+		userService:   services.NewUserService(db, cfg, nil, passwordPolicy),
+		rbacService:   services.NewRBACService(db),
+	}, nil
+}
+
+func (b *dbBackend) ListClients(filter *services.ClientFilter) ([]models.OAuth2Credential, int64, error) {
+	return b.clientService.ListClients(filter)
+}
+
+func (b *dbBackend) CreateClient(req *services.CreateClientRequest) (*services.CreatedClient, error) {
+	return b.clientService.CreateClient(req)
+}
+
+func (b *dbBackend) RotateSecret(clientID string, req *services.RotateSecretRequest) (*services.IssuedSecret, error) {
+	return b.clientService.RotateSecret(clientID, req)
+}
+
+func (b *dbBackend) DeleteClient(clientID string) error {
+	return b.clientService.DeleteClient(clientID)
+}
+
+func (b *dbBackend) ListConsumers(filter *services.ConsumerFilter) ([]models.Consumer, int64, error) {
+	return b.clientService.ListConsumers(filter)
+}
+
+func (b *dbBackend) CreateConsumer(req *services.CreateConsumerRequest) (*models.Consumer, error) {
+	return b.clientService.CreateConsumer(req)
+}
+
+func (b *dbBackend) UpdateConsumer(consumerID string, req *services.UpdateConsumerRequest) (*models.Consumer, error) {
+	return b.clientService.UpdateConsumer(consumerID, req)
+}
+
+func (b *dbBackend) DeleteConsumer(consumerID string, cascade bool) error {
+	return b.clientService.DeleteConsumer(consumerID, cascade)
+}
+
+func (b *dbBackend) CreateUser(req *services.CreateUserRequest) (*services.UserResponse, error) {
+	return b.userService.CreateUser(req)
+}
+
+func (b *dbBackend) DeactivateUser(userID uuid.UUID) error {
+	return b.userService.DisableUser(userID)
+}
+
+func (b *dbBackend) AssignRole(userID uuid.UUID, role string) ([]models.Role, error) {
+	user, err := b.rbacService.AssignRole(userID, role)
+	if err != nil {
+		return nil, err
+	}
+	return user.Roles, nil
+}
+
+func (b *dbBackend) RemoveRole(userID uuid.UUID, role string) ([]models.Role, error) {
+	user, err := b.rbacService.RemoveRole(userID, role)
+	if err != nil {
+		return nil, err
+	}
+	return user.Roles, nil
+}
+
+func (b *dbBackend) RevokeUserTokens(userID uuid.UUID) (int64, error) {
+	return b.userService.RevokeUserTokens(userID)
+}
+
+func (b *dbBackend) RevokeClientTokens(clientID string) (int64, error) {
+	return b.clientService.RevokeClientTokens(clientID)
+}
+
+// Seed runs the same migrations and seeders as the server at startup.
+func (b *dbBackend) Seed(clientsPath string) error {
+	if err := b.db.AutoMigrate(models.All...); err != nil {
+		return fmt.Errorf("Migration failed: %w", err)
+	}
+
+	if err := seeds.MigrateClientSecrets(b.db); err != nil {
+		return err
+	}
+	if err := seeds.SeedRoles(b.db); err != nil {
+		return err
+	}
+	if clientsPath != "" {
+		return seeds.SeedClients(b.db, clientsPath)
+	}
+	return nil
+}
+
+var errDatabaseOnly = errors.New("only available with -mode db")
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/services"
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type cli struct {
+	backend backend
+	out     *printer
+}
+
+type command func(args []string) error
+
+func (c *cli) run(args []string) error {
+	commands := map[string]map[string]command{
+		"client": {
+			"list":   c.clientList,
+			"create": c.clientCreate,
+			"rotate": c.clientRotate,
+			"delete": c.clientDelete,
+		},
+		"consumer": {
+			"list":   c.consumerList,
+			"create": c.consumerCreate,
+			"update": c.consumerUpdate,
+			"delete": c.consumerDelete,
+		},
+		"user": {
+			"create":     c.userCreate,
+			"deactivate": c.userDeactivate,
+		},
+		"role": {
+			"assign": c.roleAssign,
+			"remove": c.roleRemove,
+		},
+		"token": {
+			"revoke": c.tokenRevoke,
+		},
+	}
+
+	if args[0] == "seed" {
+		return c.seed(args[1:])
+	}
+
+	actions, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("%s needs one of: %s", args[0], strings.Join(actionNames(actions), ", "))
+	}
+	action, ok := actions[args[1]]
+	if !ok {
+		return fmt.Errorf("unknown command %q %q", args[0], args[1])
+	}
+	return action(args[2:])
+}
+
+func (c *cli) clientList(args []string) error {
+	fs := flag.NewFlagSet("client list", flag.ExitOnError)
+	consumer := fs.String("consumer", "", "consumer ID")
+	name := fs.String("name", "", "part of the client name")
+	limit := fs.Int("limit", 100, "clients per page")
+	offset := fs.Int("offset", 0, "clients to skip")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	filter := &services.ClientFilter{Name: *name, Limit: *limit, Offset: *offset}
+	if *consumer != "" {
+		consumerID, err := uuid.Parse(*consumer)
+		if err != nil {
+			return errors.New("invalid consumer ID")
+		}
+		filter.ConsumerID = &consumerID
+	}
+
+	clients, total, err := c.backend.ListClients(filter)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(clients))
+	for _, client := range clients {
+		rows = append(rows, []string{
+			client.ClientID,
+			client.Name,
+			client.Consumer.Username,
+			strconv.FormatBool(client.Public),
+			joinOrDefault(client.GrantTypes),
+			strings.Join(client.RedirectURIs, ","),
+			client.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return c.out.print(map[string]interface{}{"data": clients, "total": total},
+		[]string{"CLIENT_ID", "NAME", "CONSUMER", "PUBLIC", "GRANT_TYPES", "REDIRECT_URIS", "CREATED_AT"}, rows)
+}
+
+func (c *cli) clientCreate(args []string) error {
+	fs := flag.NewFlagSet("client create", flag.ExitOnError)
+	name := fs.String("name", "", "client name (required)")
+	consumer := fs.String("consumer", "", "consumer ID (required)")
+	clientID := fs.String("client-id", "", "client_id, generated when left out")
+	secret := fs.String("secret", "", "client secret, generated when left out")
+	public := fs.Bool("public", false, "public client without a secret")
+	var redirectURIs, grantTypes stringList
+	fs.Var(&redirectURIs, "redirect-uri", "redirect URI, repeatable")
+	fs.Var(&grantTypes, "grant-type", "allowed grant type, repeatable, the defaults apply when left out")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	consumerID, err := uuid.Parse(*consumer)
+	if *name == "" || err != nil {
+		return errors.New("-name and a valid -consumer are required")
+	}
+
+	created, err := c.backend.CreateClient(&services.CreateClientRequest{
+		Name:         *name,
+		ClientID:     *clientID,
+		ClientSecret: *secret,
+		RedirectURIs: redirectURIs,
+		ConsumerID:   consumerID,
+		ClientPolicyFields: services.ClientPolicyFields{
+			GrantTypes: grantTypes,
+			Public:     *public,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.out.print(created, []string{"CLIENT_ID", "NAME", "CLIENT_SECRET"},
+		[][]string{{created.ClientID, created.Name, created.Secret}})
+}
+
+func (c *cli) clientRotate(args []string) error {
+	fs := flag.NewFlagSet("client rotate", flag.ExitOnError)
+	expiresIn := fs.Int("expires-in", 0, "seconds until the new secret expires, never when 0")
+	previousExpiresIn := fs.Int("previous-expires-in", -1, "seconds the current secrets keep working, the server default when negative")
+	positional, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	req := &services.RotateSecretRequest{}
+	if *expiresIn > 0 {
+		req.ExpiresIn = expiresIn
+	}
+	if *previousExpiresIn >= 0 {
+		req.PreviousExpiresIn = previousExpiresIn
+	}
+
+	issued, err := c.backend.RotateSecret(positional[0], req)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := "never"
+	if issued.ExpiresAt != nil {
+		expiresAt = issued.ExpiresAt.Format(time.RFC3339)
+	}
+	return c.out.print(issued, []string{"SECRET_ID", "EXPIRES_AT", "CLIENT_SECRET"},
+		[][]string{{issued.ID.String(), expiresAt, issued.Secret}})
+}
+
+func (c *cli) clientDelete(args []string) error {
+	fs := flag.NewFlagSet("client delete", flag.ExitOnError)
+	positional, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	if err := c.backend.DeleteClient(positional[0]); err != nil {
+		return err
+	}
+	return c.out.message("Deleted client %s", positional[0])
+}
+
+func (c *cli) consumerList(args []string) error {
+	fs := flag.NewFlagSet("consumer list", flag.ExitOnError)
+	username := fs.String("username", "", "username")
+	customID := fs.String("custom-id", "", "custom_id")
+	limit := fs.Int("limit", 100, "consumers per page")
+	offset := fs.Int("offset", 0, "consumers to skip")
+	var tags stringList
+	fs.Var(&tags, "tag", "tag the consumers must carry, repeatable")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	consumers, total, err := c.backend.ListConsumers(&services.ConsumerFilter{
+		Username: *username,
+		CustomID: *customID,
+		Tags:     tags,
+		Limit:    *limit,
+		Offset:   *offset,
+	})
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(consumers))
+	for _, consumer := range consumers {
+		rows = append(rows, consumerRow(&consumer))
+	}
+	return c.out.print(map[string]interface{}{"data": consumers, "total": total}, consumerHeaders, rows)
+}
+
+func (c *cli) consumerCreate(args []string) error {
+	fs := flag.NewFlagSet("consumer create", flag.ExitOnError)
+	username := fs.String("username", "", "username (required)")
+	customID := fs.String("custom-id", "", "custom_id")
+	var tags stringList
+	var metadata metadataFlag
+	fs.Var(&tags, "tag", "tag, repeatable")
+	fs.Var(&metadata, "meta", "metadata entry as key=value, repeatable")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	if *username == "" {
+		return errors.New("-username is required")
+	}
+
+	consumer, err := c.backend.CreateConsumer(&services.CreateConsumerRequest{
+		Username: *username,
+		CustomID: *customID,
+		Tags:     tags,
+		Metadata: metadata,
+	})
+	if err != nil {
+		return err
+	}
+	return c.out.print(consumer, consumerHeaders, [][]string{consumerRow(consumer)})
+}
+
+func (c *cli) consumerUpdate(args []string) error {
+	fs := flag.NewFlagSet("consumer update", flag.ExitOnError)
+	username := fs.String("username", "", "new username")
+	customID := fs.String("custom-id", "", "new custom_id")
+	var tags stringList
+	var metadata metadataFlag
+	fs.Var(&tags, "tag", "tag, repeatable, replaces every tag")
+	fs.Var(&metadata, "meta", "metadata entry as key=value, repeatable, replaces all metadata")
+	positional, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	// Only the flags given are sent, so the rest keeps its value
+	req := &services.UpdateConsumerRequest{}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "username":
+			req.Username = username
+		case "custom-id":
+			req.CustomID = customID
+		case "tag":
+			tagValues := []string(tags)
+			req.Tags = &tagValues
+		case "meta":
+			metadataValues := map[string]string(metadata)
+			req.Metadata = &metadataValues
+		}
+	})
+
+	consumer, err := c.backend.UpdateConsumer(positional[0], req)
+	if err != nil {
+		return err
+	}
+	return c.out.print(consumer, consumerHeaders, [][]string{consumerRow(consumer)})
+}
+
+func (c *cli) consumerDelete(args []string) error {
+	fs := flag.NewFlagSet("consumer delete", flag.ExitOnError)
+	cascade := fs.Bool("cascade", false, "also delete the consumer's clients and their tokens")
+	positional, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	if err := c.backend.DeleteConsumer(positional[0], *cascade); err != nil {
+		return err
+	}
+	return c.out.message("Deleted consumer %s", positional[0])
+}
+
+func (c *cli) userCreate(args []string) error {
+	fs := flag.NewFlagSet("user create", flag.ExitOnError)
+	email := fs.String("email", "", "email (required)")
+	username := fs.String("username", "", "username, defaults to the local part of the email")
+	name := fs.String("name", "", "display name (required)")
+	passwordStdin := fs.Bool("password-stdin", false, "read the password from stdin instead of AUTHCTL_PASSWORD")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	if *email == "" || *name == "" {
+		return errors.New("-email and -name are required")
+	}
+	if *username == "" {
+		*username = strings.Split(*email, "@")[0]
+	}
+
+	// Passwords stay out of the arguments, they would end up in the
+	// shell history and the process list
+	password := os.Getenv("AUTHCTL_PASSWORD")
+	if *passwordStdin {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return errors.New("failed to read the password from stdin")
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if password == "" {
+		return errors.New("set AUTHCTL_PASSWORD or use -password-stdin")
+	}
+
+	user, err := c.backend.CreateUser(&services.CreateUserRequest{
+		Email:    *email,
+		Password: password,
+		Username: *username,
+		Name:     *name,
+	})
+	if err != nil {
+		var policyErr *services.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			for _, violation := range policyErr.Violations {
+				fmt.Fprintln(os.Stderr, "-", violation.Message)
+			}
+		}
+		return err
+	}
+
+	return c.out.print(user, []string{"ID", "EMAIL", "USERNAME", "NAME", "ACTIVE"},
+		[][]string{{user.ID.String(), user.Email, user.Username, user.Name, strconv.FormatBool(user.IsActive)}})
+}
+
+func (c *cli) userDeactivate(args []string) error {
+	fs := flag.NewFlagSet("user deactivate", flag.ExitOnError)
+	positional, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	userID, err := uuid.Parse(positional[0])
+	if err != nil {
+		return errors.New("invalid user ID")
+	}
+	if err := c.backend.DeactivateUser(userID); err != nil {
+		return err
+	}
+	return c.out.message("Deactivated user %s", userID)
+}
+
+func (c *cli) roleAssign(args []string) error {
+	return c.changeRole("role assign", args, c.backend.AssignRole)
+}
+
+func (c *cli) roleRemove(args []string) error {
+	return c.changeRole("role remove", args, c.backend.RemoveRole)
+}
+
+func (c *cli) changeRole(name string, args []string, change func(uuid.UUID, string) ([]models.Role, error)) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	positional, err := parseArgs(fs, args, 2)
+	if err != nil {
+		return err
+	}
+
+	userID, err := uuid.Parse(positional[0])
+	if err != nil {
+		return errors.New("invalid user ID")
+	}
+
+	roles, err := change(userID, positional[1])
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(roles))
+	for _, role := range roles {
+		rows = append(rows, []string{role.Name, role.Description})
+	}
+	return c.out.print(map[string]interface{}{"user_id": userID, "roles": roles}, []string{"ROLE", "DESCRIPTION"}, rows)
+}
+
+func (c *cli) tokenRevoke(args []string) error {
+	fs := flag.NewFlagSet("token revoke", flag.ExitOnError)
+	user := fs.String("user", "", "revoke every token and session of this user ID")
+	client := fs.String("client", "", "revoke every token issued to this client_id")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	var revoked int64
+	var err error
+	switch {
+	case *user != "" && *client == "":
+		userID, parseErr := uuid.Parse(*user)
+		if parseErr != nil {
+			return errors.New("invalid user ID")
+		}
+		revoked, err = c.backend.RevokeUserTokens(userID)
+	case *client != "" && *user == "":
+		revoked, err = c.backend.RevokeClientTokens(*client)
+	default:
+		return errors.New("give exactly one of -user or -client")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.out.message("Revoked %d tokens", revoked)
+}
+
+func (c *cli) seed(args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	clients := fs.String("clients", "clients.json", "clients file to seed, empty to skip")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	if err := c.backend.Seed(*clients); err != nil {
+		return err
+	}
+	if *clients == "" {
+		return c.out.message("Seeded roles and permissions")
+	}
+	return c.out.message("Seeded roles, permissions and %s", *clients)
+}
+
+var consumerHeaders = []string{"ID", "USERNAME", "CUSTOM_ID", "TAGS", "CREATED_AT"}
+
+func consumerRow(consumer *models.Consumer) []string {
+	return []string{
+		consumer.ID.String(),
+		consumer.Username,
+		consumer.CustomID,
+		strings.Join(consumer.Tags, ","),
+		consumer.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func joinOrDefault(values []string) string {
+	if len(values) == 0 {
+		return "(default)"
+	}
+	return strings.Join(values, ",")
+}
+
+// parseArgs allows flags after the positional arguments, which the flag
+// package alone does not, and checks their number.
+func parseArgs(fs *flag.FlagSet, args []string, want int) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if len(positional) != want {
+		return nil, fmt.Errorf("%s takes %d argument(s), got %d", fs.Name(), want, len(positional))
+	}
+	return positional, nil
+}
+
+func actionNames(actions map[string]command) []string {
+	names := make([]string, 0, len(actions))
+	for name := range actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+type metadataFlag map[string]string
+
+func (m *metadataFlag) String() string { return fmt.Sprint(map[string]string(*m)) }
+
+func (m *metadataFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return errors.New("expected key=value")
+	}
+	if *m == nil {
+		*m = metadataFlag{}
+	}
+	(*m)[key] = val
+	return nil
+}
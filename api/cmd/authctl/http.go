@@ -0,0 +1,230 @@
+package main
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/services"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// httpBackend calls the /admin routes of a running server with a bearer
+// token of a user holding the needed permissions.
+type httpBackend struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+func newHTTPBackend(baseURL, token string) *httpBackend {
+	return &httpBackend{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// listResponse is the envelope of the paginated admin listings
+type listResponse[T any] struct {
+	Data  []T   `json:"data"`
+	Total int64 `json:"total"`
+}
+
+func (b *httpBackend) ListClients(filter *services.ClientFilter) ([]models.OAuth2Credential, int64, error) {
+	query := pageQuery(filter.Limit, filter.Offset)
+	if filter.ConsumerID != nil {
+		query.Set("consumer_id", filter.ConsumerID.String())
+	}
+	if filter.Name != "" {
+		query.Set("name", filter.Name)
+	}
+
+	var resp listResponse[models.OAuth2Credential]
+	if err := b.do(http.MethodGet, "/admin/clients?"+query.Encode(), nil, &resp); err != nil {
+		return nil, 0, err
+	}
+	return resp.Data, resp.Total, nil
+}
+
+func (b *httpBackend) CreateClient(req *services.CreateClientRequest) (*services.CreatedClient, error) {
+	var created services.CreatedClient
+	if err := b.do(http.MethodPost, "/admin/clients", req, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (b *httpBackend) RotateSecret(clientID string, req *services.RotateSecretRequest) (*services.IssuedSecret, error) {
+	var issued services.IssuedSecret
+	if err := b.do(http.MethodPost, "/admin/clients/"+url.PathEscape(clientID)+"/secrets", req, &issued); err != nil {
+		return nil, err
+	}
+	return &issued, nil
+}
+
+func (b *httpBackend) DeleteClient(clientID string) error {
+	return b.do(http.MethodDelete, "/admin/clients/"+url.PathEscape(clientID), nil, nil)
+}
+
+func (b *httpBackend) ListConsumers(filter *services.ConsumerFilter) ([]models.Consumer, int64, error) {
+	query := pageQuery(filter.Limit, filter.Offset)
+	if filter.Username != "" {
+		query.Set("username", filter.Username)
+	}
+	if filter.CustomID != "" {
+		query.Set("custom_id", filter.CustomID)
+	}
+	for _, tag := range filter.Tags {
+		query.Add("tag", tag)
+	}
+
+	var resp listResponse[models.Consumer]
+	if err := b.do(http.MethodGet, "/admin/consumers?"+query.Encode(), nil, &resp); err != nil {
+		return nil, 0, err
+	}
+	return resp.Data, resp.Total, nil
+}
+
+func (b *httpBackend) CreateConsumer(req *services.CreateConsumerRequest) (*models.Consumer, error) {
+	var consumer models.Consumer
+	if err := b.do(http.MethodPost, "/admin/consumers", req, &consumer); err != nil {
+		return nil, err
+	}
+	return &consumer, nil
+}
+
+func (b *httpBackend) UpdateConsumer(consumerID string, req *services.UpdateConsumerRequest) (*models.Consumer, error) {
+	var consumer models.Consumer
+	if err := b.do(http.MethodPut, "/admin/consumers/"+url.PathEscape(consumerID), req, &consumer); err != nil {
+		return nil, err
+	}
+	return &consumer, nil
+}
+
+func (b *httpBackend) DeleteConsumer(consumerID string, cascade bool) error {
+	path := "/admin/consumers/" + url.PathEscape(consumerID)
+	if cascade {
+		path += "?cascade=true"
+	}
+	return b.do(http.MethodDelete, path, nil, nil)
+}
+
+func (b *httpBackend) CreateUser(req *services.CreateUserRequest) (*services.UserResponse, error) {
+	var user services.UserResponse
+	if err := b.do(http.MethodPost, "/admin/users", req, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (b *httpBackend) DeactivateUser(userID uuid.UUID) error {
+	return b.do(http.MethodPost, "/admin/users/"+userID.String()+"/deactivate", nil, nil)
+}
+
+type rolesResponse struct {
+	Roles []models.Role `json:"roles"`
+}
+
+func (b *httpBackend) AssignRole(userID uuid.UUID, role string) ([]models.Role, error) {
+	var resp rolesResponse
+	if err := b.do(http.MethodPost, "/admin/users/"+userID.String()+"/roles", map[string]string{"role": role}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Roles, nil
+}
+
+func (b *httpBackend) RemoveRole(userID uuid.UUID, role string) ([]models.Role, error) {
+	var resp rolesResponse
+	if err := b.do(http.MethodDelete, "/admin/users/"+userID.String()+"/roles/"+url.PathEscape(role), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Roles, nil
+}
+
+type revokedResponse struct {
+	Revoked int64 `json:"revoked"`
+}
+
+func (b *httpBackend) RevokeUserTokens(userID uuid.UUID) (int64, error) {
+	var resp revokedResponse
+	if err := b.do(http.MethodDelete, "/admin/users/"+userID.String()+"/tokens", nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Revoked, nil
+}
+
+func (b *httpBackend) RevokeClientTokens(clientID string) (int64, error) {
+	var resp revokedResponse
+	if err := b.do(http.MethodDelete, "/admin/clients/"+url.PathEscape(clientID)+"/tokens", nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Revoked, nil
+}
+
+// Seed needs the database, the seeders have no HTTP route
+func (b *httpBackend) Seed(string) error {
+	return errDatabaseOnly
+}
+
+func (b *httpBackend) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, b.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if b.token != "" {
+		req.Header.Set("Authorization", "Bearer "+b.token)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		// The admin API answers {"error": "..."}, the same messages the
+		// services return
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return errors.New(apiErr.Error)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func pageQuery(limit, offset int) url.Values {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("offset", strconv.Itoa(offset))
+	return query
+}
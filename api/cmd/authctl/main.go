@@ -0,0 +1,89 @@
+// Command authctl runs the everyday admin tasks of the auth service, either
+// directly against the database or through the admin HTTP API of a running
+// server.
+//
+//	go run ./cmd/authctl client list
+//	go run ./cmd/authctl -url http://localhost:8080 -token $TOKEN -o json consumer list -tag kong
+//
+// Without -url the database from .env is used. The HTTP API needs the access
+// token of a user with the matching permissions, AUTHCTL_URL and
+// AUTHCTL_TOKEN can stand in for the flags.
+package main
+
+import (
+	"auth-service/internal/config"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = `Usage: authctl [global flags] <command> [flags] [arguments]
+
+Commands:
+  client list|create|rotate|delete
+  consumer list|create|update|delete
+  user create|deactivate
+  role assign|remove <user_id> <role>
+  token revoke -user <user_id> | -client <client_id>
+  seed [-clients clients.json]    (database only)
+
+Global flags:
+`
+
+func main() {
+	log.SetFlags(0)
+
+	global := flag.NewFlagSet("authctl", flag.ExitOnError)
+	mode := global.String("mode", "", "db or http, http when -url is set")
+	baseURL := global.String("url", os.Getenv("AUTHCTL_URL"), "base URL of the auth service for -mode http")
+	token := global.String("token", os.Getenv("AUTHCTL_TOKEN"), "admin access token for -mode http")
+	format := global.String("o", "table", "output format, table or json")
+	global.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		global.PrintDefaults()
+	}
+	global.Parse(os.Args[1:])
+
+	if global.NArg() == 0 {
+		global.Usage()
+		os.Exit(2)
+	}
+	if *format != "table" && *format != "json" {
+		log.Fatal("-o must be table or json")
+	}
+
+	if *mode == "" {
+		*mode = "db"
+		if *baseURL != "" {
+			*mode = "http"
+		}
+	}
+
+	var b backend
+	switch *mode {
+	case "http":
+		if *baseURL == "" {
+			log.Fatal("-mode http needs -url")
+		}
+		b = newHTTPBackend(*baseURL, *token)
+	case "db":
+		if err := godotenv.Load(); err != nil {
+			log.Println("No .env file found, using environment variables")
+		}
+		db, err := newDBBackend(config.LoadConfig())
+		if err != nil {
+			log.Fatal(err)
+		}
+		b = db
+	default:
+		log.Fatal("-mode must be db or http")
+	}
+
+	cli := &cli{backend: b, out: &printer{format: *format}}
+	if err := cli.run(global.Args()); err != nil {
+		log.Fatal("Error: ", err)
+	}
+}
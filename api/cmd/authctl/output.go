@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// printer writes results either as an aligned table or as indented JSON
+// of the values the backend returned.
+type printer struct {
+	format string
+}
+
+func (p *printer) print(value interface{}, headers []string, rows [][]string) error {
+	if p.format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(writer, strings.Join(row, "\t"))
+	}
+	return writer.Flush()
+}
+
+// message prints a confirmation, wrapped in an object for JSON output so the
+// output stays machine readable.
+func (p *printer) message(format string, args ...interface{}) error {
+	text := fmt.Sprintf(format, args...)
+	if p.format == "json" {
+		return p.print(map[string]string{"message": text}, nil, nil)
+	}
+	_, err := fmt.Println(text)
+	return err
+}
@@ -0,0 +1,100 @@
+// Command bootstrap-admin creates the first administrator, or promotes an
+// existing account, so the protected /admin API can be reached at all.
+//
+//	go run ./cmd/bootstrap-admin -email admin@example.com -password 'Change-me-2024'
+package main
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/hashing"
+	"auth-service/internal/models"
+	"auth-service/internal/seeds"
+	"auth-service/internal/services"
+	"errors"
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"gorm.io/gorm"
+)
+
+func main() {
+	email := flag.String("email", "", "email of the administrator (required)")
+	password := flag.String("password", "", "password, only used when the user does not exist yet")
+	username := flag.String("username", "", "username, defaults to the local part of the email")
+	name := flag.String("name", "Administrator", "display name, only used when the user does not exist yet")
+	flag.Parse()
+
+	if *email == "" {
+		log.Fatal("-email is required")
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	cfg := config.LoadConfig()
+	db := config.InitDatabase(cfg)
+
+	hasher, err := hashing.New(cfg.Hashing)
+	if err != nil {
+		log.Fatal(err)
+	}
+	hashing.SetDefault(hasher)
+
+	if err := db.AutoMigrate(models.All...); err != nil {
+		log.Fatal("Migration failed:", err)
+	}
+
+	if err := seeds.SeedRoles(db); err != nil {
+		log.Fatal("Seed failed: ", err)
+	}
+
+	var user models.User
+	err = db.Where("email = ?", *email).First(&user).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if *password == "" {
+			log.Fatal("-password is required to create a new user")
+		}
+		if *username == "" {
+			*username = strings.Split(*email, "@")[0]
+		}
+		// The breach corpus is not loaded here, only the local rules apply
+		policy := services.NewPasswordPolicy(cfg.Password, nil)
+		if err := policy.Validate(*password, *username, *email); err != nil {
+			var policyErr *services.PasswordPolicyError
+			if errors.As(err, &policyErr) {
+				for _, violation := range policyErr.Violations {
+					log.Println("-", violation.Message)
+				}
+			}
+			log.Fatal("Password rejected: ", err)
+		}
+		user = models.User{
+			Email:    *email,
+			Password: *password,
+			Username: *username,
+			Name:     *name,
+			IsActive: true,
+		}
+		if err := db.Create(&user).Error; err != nil {
+			log.Fatal("Failed to create user: ", err)
+		}
+		log.Printf("Created user %s (%s)", user.Email, user.ID)
+	case err != nil:
+		log.Fatal("Failed to fetch user: ", err)
+	}
+
+	var role models.Role
+	if err := db.Where("name = ?", models.RoleAdmin).First(&role).Error; err != nil {
+		log.Fatal("Failed to fetch admin role: ", err)
+	}
+
+	if err := db.Model(&user).Association("Roles").Append(&role); err != nil {
+		log.Fatal("Failed to assign admin role: ", err)
+	}
+
+	log.Printf("User %s is now an %s", user.Email, role.Name)
+}
@@ -0,0 +1,95 @@
+// Command breached-filter builds the bloom filter the password policy uses to
+// reject breached passwords offline (PASSWORD_BREACHED_FILTER).
+//
+// The input is a downloadable password list with one entry per line, either
+// plain text passwords (e.g. the SecLists common password lists) or, with
+// -sha1, the Have I Been Pwned SHA-1 hash lists ("HASH:COUNT" per line).
+//
+//	go run ./cmd/breached-filter -input pwned-passwords-sha1.txt -sha1 -output breached.bloom
+package main
+
+import (
+	"auth-service/internal/services"
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"flag"
+	"log"
+	"os"
+	"strings"
+)
+
+func main() {
+	input := flag.String("input", "", "password list to read (required)")
+	output := flag.String("output", "breached.bloom", "file to write the filter to")
+	hashed := flag.Bool("sha1", false, "lines are hex SHA-1 digests, optionally followed by :count")
+	falsePositiveRate := flag.Float64("fp", 0.001, "false positive rate of the filter")
+	flag.Parse()
+
+	if *input == "" {
+		log.Fatal("-input is required")
+	}
+
+	// Counting first sizes the filter exactly for the list
+	entries := uint64(0)
+	if err := eachLine(*input, func(string) error { entries++; return nil }); err != nil {
+		log.Fatal("Failed to read input: ", err)
+	}
+
+	filter := services.NewBreachedPasswordFilter(entries, *falsePositiveRate)
+
+	skipped := 0
+	err := eachLine(*input, func(line string) error {
+		if !*hashed {
+			filter.Add(line)
+			return nil
+		}
+
+		hash, _, _ := strings.Cut(line, ":")
+		raw, err := hex.DecodeString(strings.TrimSpace(hash))
+		if err != nil || len(raw) != sha1.Size {
+			skipped++
+			return nil
+		}
+		var digest [sha1.Size]byte
+		copy(digest[:], raw)
+		filter.AddDigest(digest)
+		return nil
+	})
+	if err != nil {
+		log.Fatal("Failed to read input: ", err)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		log.Fatal("Failed to create output: ", err)
+	}
+	defer file.Close()
+
+	size, err := filter.WriteTo(file)
+	if err != nil {
+		log.Fatal("Failed to write filter: ", err)
+	}
+
+	log.Printf("Wrote %s: %d entries, %d bytes, %d lines skipped", *output, entries-uint64(skipped), size, skipped)
+}
+
+func eachLine(path string, fn func(string) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
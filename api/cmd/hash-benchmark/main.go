@@ -0,0 +1,124 @@
+// Command hash-benchmark measures the password hashing algorithms on the
+// machine it runs on and prints the strongest parameters that still hash
+// within the target time. Run it on the VM the API is deployed to and copy
+// the printed variables into .env.
+//
+//	go run ./cmd/hash-benchmark -target 250ms -max-memory 65536
+package main
+
+import (
+	"auth-service/internal/hashing"
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+const benchmarkPassword = "correct horse battery staple"
+
+func main() {
+	target := flag.Duration("target", 250*time.Millisecond, "time one hash may take")
+	maxMemory := flag.Uint("max-memory", 65536, "most memory in KiB a single argon2id or scrypt hash may use")
+	threads := flag.Uint("threads", 1, "argon2id parallelism")
+	rounds := flag.Int("rounds", 3, "hashes per measurement, the median is used")
+	flag.Parse()
+
+	fmt.Printf("Target %s per hash, at most %d KiB\n\n", *target, *maxMemory)
+
+	argon2 := benchmarkArgon2id(*target, uint32(*maxMemory), uint8(*threads), *rounds)
+	scrypt := benchmarkScrypt(*target, uint32(*maxMemory), *rounds)
+	bcrypt := benchmarkBcrypt(*target, *rounds)
+
+	fmt.Println("\n# Recommended (argon2id)")
+	fmt.Println("PASSWORD_HASH_ALGORITHM=argon2id")
+	fmt.Printf("ARGON2_MEMORY=%d\nARGON2_TIME=%d\nARGON2_THREADS=%d\n", argon2.Memory, argon2.Time, argon2.Threads)
+	fmt.Println("\n# Alternatives")
+	fmt.Printf("SCRYPT_LOG_N=%d\nSCRYPT_R=%d\nSCRYPT_P=%d\n", scrypt.LogN, scrypt.R, scrypt.P)
+	fmt.Printf("BCRYPT_COST=%d\n", bcrypt)
+}
+
+// benchmarkArgon2id prefers memory over passes, as recommended by RFC 9106:
+// it takes the largest memory that fits the target with one pass, then adds
+// passes while they still fit.
+func benchmarkArgon2id(target time.Duration, maxMemory uint32, threads uint8, rounds int) hashing.Argon2idParams {
+	best := hashing.DefaultArgon2idParams
+	best.Threads = threads
+
+	for memory := uint32(8192); memory <= maxMemory; memory *= 2 {
+		params := hashing.Argon2idParams{Memory: memory, Time: 1, Threads: threads}
+		elapsed := measure(hashing.NewArgon2idHasher(params), rounds)
+		fmt.Printf("argon2id m=%d t=%d p=%d: %s\n", params.Memory, params.Time, params.Threads, elapsed)
+		if elapsed > target {
+			break
+		}
+		best = params
+	}
+
+	for {
+		params := best
+		params.Time++
+		elapsed := measure(hashing.NewArgon2idHasher(params), rounds)
+		fmt.Printf("argon2id m=%d t=%d p=%d: %s\n", params.Memory, params.Time, params.Threads, elapsed)
+		if elapsed > target {
+			break
+		}
+		best = params
+	}
+
+	return best
+}
+
+func benchmarkScrypt(target time.Duration, maxMemory uint32, rounds int) hashing.ScryptParams {
+	best := hashing.ScryptParams{LogN: 15, R: 8, P: 1}
+
+	for logN := uint8(14); logN < 24; logN++ {
+		params := hashing.ScryptParams{LogN: logN, R: 8, P: 1}
+		// scrypt uses 128 * N * r bytes
+		if uint64(128)*(1<<logN)*uint64(params.R)/1024 > uint64(maxMemory) {
+			break
+		}
+
+		elapsed := measure(hashing.NewScryptHasher(params), rounds)
+		fmt.Printf("scrypt ln=%d r=%d p=%d: %s\n", params.LogN, params.R, params.P, elapsed)
+		if elapsed > target {
+			break
+		}
+		best = params
+	}
+
+	return best
+}
+
+func benchmarkBcrypt(target time.Duration, rounds int) int {
+	best := 10
+
+	for cost := 10; cost <= 16; cost++ {
+		elapsed := measure(hashing.NewBcryptHasher(cost), rounds)
+		fmt.Printf("bcrypt cost=%d: %s\n", cost, elapsed)
+		if elapsed > target {
+			break
+		}
+		best = cost
+	}
+
+	return best
+}
+
+func measure(hasher hashing.Hasher, rounds int) time.Duration {
+	if rounds < 1 {
+		rounds = 1
+	}
+
+	durations := make([]time.Duration, rounds)
+	for i := range durations {
+		start := time.Now()
+		if _, err := hasher.Hash(benchmarkPassword); err != nil {
+			log.Fatal("Hash failed: ", err)
+		}
+		durations[i] = time.Since(start)
+	}
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	return durations[len(durations)/2]
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"auth-service/internal/models"
+	"auth-service/internal/testdb"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+const template = `_format_version: "3.0"
+
+services:
+  - name: auth-service
+    host: auth-upstream
+    port: 8080
+    routes:
+      - name: auth-route
+        paths:
+          - /api/v1/auth
+`
+
+func seedFixtures(t *testing.T, db *gorm.DB) {
+	t.Helper()
+
+	consumer := models.Consumer{Username: "frontend", CustomID: "frontend", Tags: []string{"web"}}
+	if err := db.Create(&consumer).Error; err != nil {
+		t.Fatal(err)
+	}
+	clients := []models.OAuth2Credential{
+		{Name: "Backend", ClientID: "backend", ConsumerID: consumer.ID, RedirectURIs: []string{"https://app.example/callback"}},
+		{Name: "SPA", ClientID: "spa", ConsumerID: consumer.ID, Public: true, RedirectURIs: []string{"https://app.example/"}},
+	}
+	for i := range clients {
+		if err := db.Create(&clients[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	secret := models.ClientSecret{CredentialID: clients[0].ID, SecretHash: "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$aGFzaA"}
+	if err := db.Create(&secret).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConsumersOmitsSecrets(t *testing.T) {
+	db := testdb.Open(t)
+	seedFixtures(t, db)
+
+	consumers, err := loadConsumers(db, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(consumers) != 1 || len(consumers[0].OAuth2Credentials) != 2 {
+		t.Fatalf("got %+v, want one consumer with two credentials", consumers)
+	}
+
+	types := map[string]string{}
+	for _, credential := range consumers[0].OAuth2Credentials {
+		if credential.ClientSecret != "" || credential.HashSecret {
+			t.Errorf("credential %s carries a secret", credential.ClientID)
+		}
+		types[credential.ClientID] = credential.ClientType
+	}
+	if types["backend"] != "confidential" || types["spa"] != "public" {
+		t.Errorf("client types = %v", types)
+	}
+
+	withSecrets, err := loadConsumers(db, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := withSecrets[0].OAuth2Credentials[0]
+	if !backend.HashSecret || !strings.HasPrefix(backend.ClientSecret, "$argon2id$") {
+		t.Errorf("-omit-secrets=false should copy the argon2 hash, got %+v", backend)
+	}
+}
+
+func TestRenderAndPush(t *testing.T) {
+	db := testdb.Open(t)
+	seedFixtures(t, db)
+
+	consumers, err := loadConsumers(db, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendered, err := renderConfig([]byte(template), consumers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pushed struct {
+		Query  string
+		Token  string
+		Config string
+	}
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/config" {
+			http.NotFound(w, r)
+			return
+		}
+		pushed.Query = r.URL.RawQuery
+		pushed.Token = r.Header.Get("Kong-Admin-Token")
+
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		pushed.Config = body["config"]
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer admin.Close()
+
+	if err := pushConfig(admin.URL+"/", "secret-token", rendered); err != nil {
+		t.Fatal(err)
+	}
+	if pushed.Query != "check_hash=1" || pushed.Token != "secret-token" {
+		t.Errorf("pushed with query %q and token %q", pushed.Query, pushed.Token)
+	}
+
+	var config struct {
+		FormatVersion string `yaml:"_format_version"`
+		Services      []struct {
+			Name string `yaml:"name"`
+		} `yaml:"services"`
+		Consumers []struct {
+			Username          string                   `yaml:"username"`
+			OAuth2Credentials []map[string]interface{} `yaml:"oauth2_credentials"`
+		} `yaml:"consumers"`
+	}
+	if err := yaml.Unmarshal([]byte(pushed.Config), &config); err != nil {
+		t.Fatalf("Kong received invalid YAML: %v", err)
+	}
+	if config.FormatVersion != "3.0" || len(config.Services) != 1 || config.Services[0].Name != "auth-service" {
+		t.Errorf("template not kept: %+v", config)
+	}
+	if len(config.Consumers) != 1 || config.Consumers[0].Username != "frontend" {
+		t.Fatalf("consumers = %+v", config.Consumers)
+	}
+	for _, credential := range config.Consumers[0].OAuth2Credentials {
+		if _, ok := credential["client_secret"]; ok {
+			t.Errorf("credential %v has a client_secret", credential["client_id"])
+		}
+		if _, ok := credential["hash_secret"]; ok {
+			t.Errorf("credential %v has hash_secret", credential["client_id"])
+		}
+	}
+}
+
+func TestPushReportsKongErrors(t *testing.T) {
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		http.Error(w, `{"message":"declarative config is invalid"}`, http.StatusBadRequest)
+	}))
+	defer admin.Close()
+
+	err := pushConfig(admin.URL, "", []byte("_format_version: \"3.0\"\n"))
+	if err == nil || !strings.Contains(err.Error(), "declarative config is invalid") {
+		t.Fatalf("err = %v, want Kong's message", err)
+	}
+}
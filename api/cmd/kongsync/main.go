@@ -0,0 +1,152 @@
+// Command kongsync renders the Kong 3.x declarative configuration from the
+// consumers and OAuth2 clients in the auth database. Services, routes,
+// upstreams and plugins come from a template, usually the current file, and
+// its consumers section is replaced.
+//
+//	go run ./cmd/kongsync -template ../gateway/config/kong.prod.yaml -output ../gateway/config/kong.prod.yaml -dry-run
+//	go run ./cmd/kongsync -template ../gateway/config/kong.prod.yaml -push http://localhost:8001
+//
+// -dry-run prints a diff against -output instead of writing it and exits
+// with status 1 when they differ. -push loads the result into a DB-less Kong
+// through the Admin API. Client secrets are left out unless -omit-secrets=false,
+// Kong is not known to accept a hash made elsewhere as a hashed secret.
+package main
+
+import (
+	"auth-service/internal/config"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+func main() {
+	template := flag.String("template", "", "declarative file with the services, routes, upstreams and plugins")
+	output := flag.String("output", "-", "file to write, - for stdout")
+	dryRun := flag.Bool("dry-run", false, "print a diff against -output instead of writing it")
+	push := flag.String("push", "", "Kong Admin API URL to load the configuration into")
+	adminToken := flag.String("admin-token", "", "Kong-Admin-Token header for -push")
+	omitSecrets := flag.Bool("omit-secrets", true, "leave client secret hashes out of the file, false copies argon2 and bcrypt hashes with hash_secret")
+	flag.Parse()
+
+	if *dryRun && *output == "-" {
+		log.Fatal("-dry-run needs -output to compare against")
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	cfg := config.LoadConfig()
+	db := config.InitDatabase(cfg)
+
+	var templateData []byte
+	if *template != "" {
+		data, err := os.ReadFile(*template)
+		if err != nil {
+			log.Fatal("Failed to read template: ", err)
+		}
+		templateData = data
+	}
+
+	consumers, err := loadConsumers(db, !*omitSecrets)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rendered, err := renderConfig(templateData, consumers)
+	if err != nil {
+		log.Fatal("Failed to render configuration: ", err)
+	}
+
+	if *dryRun {
+		changed, err := printDiff(*output, rendered)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if changed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *output == "-" {
+		os.Stdout.Write(rendered)
+	} else if err := os.WriteFile(*output, rendered, 0o644); err != nil {
+		log.Fatal("Failed to write output: ", err)
+	}
+
+	if *push != "" {
+		if err := pushConfig(*push, *adminToken, rendered); err != nil {
+			log.Fatal("Push failed: ", err)
+		}
+		log.Printf("Pushed %d consumers to %s", len(consumers), *push)
+	}
+}
+
+// printDiff prints a unified diff from the current file to the rendered one
+// and reports whether there was any difference.
+func printDiff(path string, rendered []byte) (bool, error) {
+	current, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("Failed to read %s: %w", path, err)
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(current)),
+		B:        difflib.SplitLines(string(rendered)),
+		FromFile: path,
+		ToFile:   path + " (rendered)",
+		Context:  3,
+	})
+	if err != nil {
+		return false, fmt.Errorf("Failed to diff: %w", err)
+	}
+
+	if diff == "" {
+		log.Printf("%s is up to date", path)
+		return false, nil
+	}
+	fmt.Print(diff)
+	return true, nil
+}
+
+// pushConfig replaces the configuration of a DB-less Kong node with POST
+// /config. check_hash makes Kong skip the reload when nothing changed.
+func pushConfig(adminURL, token string, rendered []byte) error {
+	body, err := json.Marshal(map[string]string{"config": string(rendered)})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(adminURL, "/")+"/config?check_hash=1", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Kong-Admin-Token", token)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("Kong answered %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+const formatVersion = "3.0"
+
+type kongConsumer struct {
+	Username          string                 `yaml:"username"`
+	CustomID          string                 `yaml:"custom_id,omitempty"`
+	Tags              []string               `yaml:"tags,omitempty"`
+	OAuth2Credentials []kongOAuth2Credential `yaml:"oauth2_credentials,omitempty"`
+}
+
+type kongOAuth2Credential struct {
+	Name         string   `yaml:"name"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret,omitempty"`
+	HashSecret   bool     `yaml:"hash_secret,omitempty"`
+	ClientType   string   `yaml:"client_type"`
+	RedirectURIs []string `yaml:"redirect_uris,omitempty"`
+}
+
+// loadConsumers reads every consumer with its clients in a stable order so
+// renders of unchanged data are identical.
+func loadConsumers(db *gorm.DB, withSecrets bool) ([]kongConsumer, error) {
+	var consumers []models.Consumer
+	if err := db.Order("username").Find(&consumers).Error; err != nil {
+		return nil, fmt.Errorf("Failed to fetch consumers: %w", err)
+	}
+
+	now := utils.GetCurrentTS()
+	result := make([]kongConsumer, 0, len(consumers))
+	for _, consumer := range consumers {
+		var clients []models.OAuth2Credential
+		err := db.Preload("Secrets", "expires_at IS NULL OR expires_at > ?", now, func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at DESC")
+		}).Where("consumer_id = ?", consumer.ID).Order("client_id").Find(&clients).Error
+		if err != nil {
+			return nil, fmt.Errorf("Failed to fetch clients of %s: %w", consumer.Username, err)
+		}
+
+		kong := kongConsumer{
+			Username: consumer.Username,
+			CustomID: consumer.CustomID,
+			Tags:     consumer.Tags,
+		}
+		for _, client := range clients {
+			credential := kongOAuth2Credential{
+				Name:         client.Name,
+				ClientID:     client.ClientID,
+				ClientType:   "confidential",
+				RedirectURIs: client.RedirectURIs,
+			}
+			if client.Public {
+				credential.ClientType = "public"
+			} else if withSecrets {
+				credential.ClientSecret = kongSecretHash(&client)
+				credential.HashSecret = credential.ClientSecret != ""
+			}
+			kong.OAuth2Credentials = append(kong.OAuth2Credentials, credential)
+		}
+		result = append(result, kong)
+	}
+	return result, nil
+}
+
+// kongSecretHash returns the newest active secret hash if Kong can verify
+// it. Kong holds a single secret per credential and only understands
+// argon2 and bcrypt hashes, for anything else it generates its own.
+func kongSecretHash(client *models.OAuth2Credential) string {
+	if len(client.Secrets) == 0 {
+		return ""
+	}
+
+	hash := client.Secrets[0].SecretHash
+	if !strings.HasPrefix(hash, "$argon2") && !strings.HasPrefix(hash, "$2") {
+		log.Printf("Client %s: secret hash not supported by Kong, left out", client.ClientID)
+		return ""
+	}
+	return hash
+}
+
+// renderConfig replaces the consumers of the template, keeping the rest of
+// the document as written, comments and key order included.
+func renderConfig(template []byte, consumers []kongConsumer) ([]byte, error) {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	if len(bytes.TrimSpace(template)) > 0 {
+		var doc yaml.Node
+		if err := yaml.Unmarshal(template, &doc); err != nil {
+			return nil, err
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			return nil, errors.New("template is not a YAML mapping")
+		}
+		root = doc.Content[0]
+	}
+
+	if version := mappingValue(root, "_format_version"); version == nil {
+		root.Content = append([]*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "_format_version"},
+			{Kind: yaml.ScalarNode, Value: formatVersion, Style: yaml.DoubleQuotedStyle},
+		}, root.Content...)
+	} else if !strings.HasPrefix(version.Value, "3.") {
+		return nil, fmt.Errorf("template has _format_version %s, Kong 3.x needs 3.0", version.Value)
+	}
+
+	// Credentials may also sit at the top level referencing their consumer
+	removeMappingKey(root, "consumers")
+	removeMappingKey(root, "oauth2_credentials")
+
+	if len(consumers) > 0 {
+		var value yaml.Node
+		if err := value.Encode(consumers); err != nil {
+			return nil, err
+		}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "consumers"}, &value)
+	}
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func removeMappingKey(mapping *yaml.Node, key string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return
+		}
+	}
+}
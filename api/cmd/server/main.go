@@ -3,25 +3,22 @@ package main
 import (
 	"auth-service/internal/config"
 	"auth-service/internal/handlers"
+	"auth-service/internal/hashing"
 	"auth-service/internal/models"
 	"auth-service/internal/seeds"
 	"auth-service/internal/services"
+	"auth-service/internal/storage"
 	"auth-service/internal/utils"
 	"context"
+	"expvar"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/joho/godotenv"
-	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
-	"gorm.io/gorm"
 )
 
-var globalDB *gorm.DB
-
 func main() {
 	ctx := context.Background()
 	if err := godotenv.Load(); err != nil {
@@ -30,42 +27,79 @@ func main() {
 
 	cfg := config.LoadConfig()
 	db := config.InitDatabase(cfg)
-	globalDB = db
 
-	minioClient, err := minio.New(cfg.Minio.Endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(cfg.Minio.RootUser, cfg.Minio.RootPwd, ""),
-		Secure: false,
-	})
+	store, err := storage.New(ctx, cfg)
 	if err != nil {
 		log.Fatalln(err)
 	}
+	log.Printf("Storing blobs with the %s backend", cfg.Storage.Backend)
 
-	setupMinioClient(minioClient, &ctx)
+	if err := db.AutoMigrate(models.All...); err != nil {
+		log.Fatal("Migration failed:", err)
+	}
 
-	buckets, err := minioClient.ListBuckets(context.Background())
+	hasher, err := hashing.New(cfg.Hashing)
 	if err != nil {
-		log.Fatalln(err)
+		log.Fatal(err)
 	}
+	hashing.SetDefault(hasher)
 
-	for _, bucket := range buckets {
-		log.Println(bucket.Name)
+	if err := seeds.MigrateClientSecrets(db); err != nil {
+		log.Fatal("Migration failed: ", err)
 	}
 
-	if err := db.AutoMigrate(&models.User{}, &models.Consumer{}, &models.OAuth2Token{}, &models.OAuth2Credential{}, &models.AuthorizationCode{}, &models.Image{}); err != nil {
-		log.Fatal("Migration failed:", err)
+	if err := seeds.SeedClients(db, "clients.json"); err != nil {
+		log.Fatal("Seed failed: ", err)
 	}
 
-	if err := seeds.SeedClients(db, "clients.json"); err != nil {
+	if err := seeds.SeedRoles(db); err != nil {
 		log.Fatal("Seed failed: ", err)
 	}
 
-	oauth2Service := services.NewOAuth2Service(db, cfg)
-	oauth2Handler := handlers.NewOAuth2Handler(oauth2Service, db, cfg)
-	authHandler := handlers.NewAuthHandler(db)
-	imageService := services.NewImageService(db)
-	imageHandler := handlers.NewImageHandler(imageService, minioClient)
+	var breachedFilter *services.BreachedPasswordFilter
+	if cfg.Password.BreachedFilterPath != "" {
+		filter, err := services.LoadBreachedPasswordFilter(cfg.Password.BreachedFilterPath)
+		if err != nil {
+			log.Fatal("Failed to load breached password filter: ", err)
+		}
+		breachedFilter = filter
+	}
+	passwordPolicy := services.NewPasswordPolicy(cfg.Password, breachedFilter)
+
+	var authenticator services.Authenticator = services.NewLocalAuthenticator(db)
+	if cfg.LDAP.Enabled {
+		authenticator = services.NewChainAuthenticator(services.NewLDAPAuthenticator(db, cfg.LDAP), authenticator)
+	}
 
-	router := setupRouter(oauth2Handler, authHandler, imageHandler)
+	oauth2Service := services.NewOAuth2Service(db, cfg, authenticator)
+	sessionService := services.NewSessionService(db, cfg, authenticator)
+	federationService := services.NewFederationService(db, cfg)
+	sessionHandler := handlers.NewSessionHandler(sessionService, federationService, cfg)
+	federationHandler := handlers.NewFederationHandler(federationService, sessionService, cfg)
+	oauth2Handler := handlers.NewOAuth2Handler(oauth2Service, sessionService, db, cfg)
+	authHandler := handlers.NewAuthHandler(db, passwordPolicy)
+	rbacService := services.NewRBACService(db)
+	imageService := services.NewImageService(db, cfg, store, rbacService)
+	imageHandler := handlers.NewImageHandler(imageService)
+	inferenceService := services.NewInferenceService(imageService, services.NewHTTPInferenceClient(cfg.Inference))
+	inferenceHandler := handlers.NewInferenceHandler(inferenceService)
+	userService := services.NewUserService(db, cfg, store, passwordPolicy)
+	userHandler := handlers.NewUserHandler(userService)
+	exportService := services.NewExportService(db, cfg, store)
+	exportHandler := handlers.NewExportHandler(exportService)
+	rbacHandler := handlers.NewRBACHandler(rbacService)
+	clientService := services.NewClientService(db, cfg)
+	clientHandler := handlers.NewClientHandler(clientService)
+	scimService := services.NewScimService(db, cfg, userService, passwordPolicy)
+	scimHandler := handlers.NewScimHandler(scimService, cfg)
+
+	userService.StartDeletionWorker(ctx, time.Hour)
+	exportService.StartCleanupWorker(ctx, time.Hour)
+	federationService.StartCleanupWorker(ctx, time.Hour)
+	imageService.StartReconcileWorker(ctx, time.Duration(cfg.Images.ReconcileInterval)*time.Minute)
+	imageService.StartPurgeWorker(ctx, time.Duration(cfg.Images.PurgeInterval)*time.Minute)
+
+	router := setupRouter(oauth2Handler, authHandler, sessionHandler, federationHandler, imageHandler, inferenceHandler, userHandler, exportHandler, rbacHandler, clientHandler, scimHandler)
 
 	server := &http.Server{
 		Addr:         cfg.Host + ":" + cfg.Port,
@@ -83,21 +117,7 @@ func main() {
 	}
 }
 
-func setupMinioClient(client *minio.Client, ctx *context.Context) {
-	err := client.MakeBucket(*ctx, "cc-images", minio.MakeBucketOptions{})
-	if err != nil {
-		exists, errBucketExists := client.BucketExists(*ctx, "cc-images")
-		if errBucketExists == nil && exists {
-			log.Printf("Bucket exists.")
-		} else {
-			log.Fatalln(err)
-		}
-	} else {
-		log.Printf("Successfully created bucket")
-	}
-}
-
-func setupRouter(oauth2Handler *handlers.OAuth2Handler, authHandler *handlers.AuthHandler, imageHandler *handlers.ImageHandler) *gin.Engine {
+func setupRouter(oauth2Handler *handlers.OAuth2Handler, authHandler *handlers.AuthHandler, sessionHandler *handlers.SessionHandler, federationHandler *handlers.FederationHandler, imageHandler *handlers.ImageHandler, inferenceHandler *handlers.InferenceHandler, userHandler *handlers.UserHandler, exportHandler *handlers.ExportHandler, rbacHandler *handlers.RBACHandler, clientHandler *handlers.ClientHandler, scimHandler *handlers.ScimHandler) *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 
 	router := gin.New()
@@ -124,8 +144,11 @@ func setupRouter(oauth2Handler *handlers.OAuth2Handler, authHandler *handlers.Au
 		oauth2Group.GET("/authorize", oauth2Handler.OAuth2Authorize)
 		oauth2Group.POST("/authorize", oauth2Handler.OAuth2Authorize)
 		oauth2Group.POST("/token", oauth2Handler.OAuth2Token)
-		oauth2Group.Any("/tokens", oauth2Handler.OAuth2Tokens)
-		oauth2Group.Any("/tokens/:token_id", oauth2Handler.OAuth2TokenByID)
+		oauth2Group.GET("/tokens", oauth2Handler.ValidateToken(), rbacHandler.RequirePermission(models.PermissionTokensRead), oauth2Handler.OAuth2Tokens)
+		oauth2Group.POST("/tokens", oauth2Handler.ValidateToken(), rbacHandler.RequirePermission(models.PermissionTokensWrite), oauth2Handler.OAuth2Tokens)
+		oauth2Group.GET("/tokens/:token_id", oauth2Handler.ValidateToken(), rbacHandler.RequirePermission(models.PermissionTokensRead), oauth2Handler.OAuth2TokenByID)
+		oauth2Group.PUT("/tokens/:token_id", oauth2Handler.ValidateToken(), rbacHandler.RequirePermission(models.PermissionTokensWrite), oauth2Handler.OAuth2TokenByID)
+		oauth2Group.DELETE("/tokens/:token_id", oauth2Handler.ValidateToken(), rbacHandler.RequirePermission(models.PermissionTokensRevoke), oauth2Handler.OAuth2TokenByID)
 		oauth2Group.POST("/introspect", oauth2Handler.IntrospectToken)
 	}
 
@@ -134,8 +157,25 @@ func setupRouter(oauth2Handler *handlers.OAuth2Handler, authHandler *handlers.Au
 		authGroup.GET("/authorize", authHandler.ShowAuthorizationPage)
 		authGroup.POST("/register", authHandler.Register)
 		authGroup.POST("/logout", authHandler.Logout)
+		authGroup.POST("/verify-email", userHandler.VerifyEmail)
+		authGroup.GET("/login", sessionHandler.ShowLoginPage)
+		authGroup.POST("/login", sessionHandler.Login)
+		authGroup.GET("/session", sessionHandler.GetSession)
+		authGroup.DELETE("/session", sessionHandler.EndSession)
+		authGroup.GET("/federated", federationHandler.ListEnabledProviders)
+		authGroup.GET("/federated/:provider/login", federationHandler.FederatedLogin)
+		authGroup.GET("/federated/:provider/callback", federationHandler.FederatedCallback)
 	}
 
+	// Signed blob URLs from /api/v1/images/:id/url carry their own authorization.
+	// They sit under /api/v1 with the rest of the browser's routes, which is
+	// what Kong forwards, but outside apiGroup and its token check.
+	router.GET("/api/v1/blobs/:id", imageHandler.GetSignedBlob)
+	router.HEAD("/api/v1/blobs/:id", imageHandler.GetSignedBlob)
+	// Export download links are unguessable and expire, so they work without
+	// a token too
+	router.GET("/api/v1/exports/:token", exportHandler.DownloadExport)
+
 	apiGroup := router.Group("/api/v1")
 	apiGroup.Use(oauth2Handler.ValidateToken())
 	{
@@ -148,31 +188,91 @@ func setupRouter(oauth2Handler *handlers.OAuth2Handler, authHandler *handlers.Au
 			})
 		})
 
+		meGroup := apiGroup.Group("/me")
+		{
+			meGroup.GET("", userHandler.GetMe)
+			meGroup.PATCH("", userHandler.UpdateMe)
+			meGroup.DELETE("", userHandler.DeleteMe)
+			meGroup.POST("/password", userHandler.ChangePassword)
+			meGroup.POST("/email", userHandler.ChangeEmail)
+			meGroup.POST("/export", exportHandler.RequestExport)
+			meGroup.GET("/export/:id", exportHandler.GetExport)
+		}
+
 		// Image routes
 		imageGroup := apiGroup.Group("/images")
 		{
-			imageGroup.POST("", imageHandler.CreateImage)
+			// The segmentation is taken as sent, users go through /inferences
+			imageGroup.POST("", rbacHandler.RequirePermission(models.PermissionImagesWrite), imageHandler.CreateImage)
 			imageGroup.GET("", imageHandler.GetUserImages)
+			imageGroup.GET("/trash", imageHandler.ListTrash)
 			imageGroup.GET("/:id", imageHandler.GetImageByID)
 			imageGroup.DELETE("/:id", imageHandler.DeleteImage)
+			imageGroup.POST("/:id/restore", imageHandler.RestoreImage)
+			imageGroup.GET("/:id/url", imageHandler.GetBlobURL)
+			imageGroup.GET("/:id/blob", imageHandler.GetImageBlob)
+			imageGroup.HEAD("/:id/blob", imageHandler.GetImageBlob)
 			imageGroup.GET("/blob/:id", imageHandler.GetBlobFromID)
+			imageGroup.HEAD("/blob/:id", imageHandler.GetBlobFromID)
 			imageGroup.GET("/sent/:sent_image_id", imageHandler.GetImageBySentID)
 			imageGroup.GET("/received/:received_image_id", imageHandler.GetImageByReceivedID)
 		}
 
-		apiGroup.GET("/users/:user_id/images", imageHandler.GetUserImages)
+		apiGroup.GET("/users/:user_id/images", imageHandler.ListUserImages)
+		apiGroup.POST("/inferences", inferenceHandler.CreateInference)
 	}
 
 	adminGroup := router.Group("/admin")
+	adminGroup.Use(oauth2Handler.ValidateToken())
 	{
-		adminGroup.GET("/clients", listClients)
-		adminGroup.POST("/clients", createClient)
-		adminGroup.GET("/clients/:client_id", getClient)
-		adminGroup.PUT("/clients/:client_id", updateClient)
-		adminGroup.DELETE("/clients/:client_id", deleteClient)
-		adminGroup.POST("/consumers", createConsumer)
-		adminGroup.GET("/consumers", listConsumers)
-		adminGroup.GET("/consumers/:consumer_id", getConsumer)
+		adminGroup.GET("/clients", rbacHandler.RequirePermission(models.PermissionClientsRead), clientHandler.ListClients)
+		adminGroup.POST("/clients", rbacHandler.RequirePermission(models.PermissionClientsWrite), clientHandler.CreateClient)
+		adminGroup.GET("/clients/:client_id", rbacHandler.RequirePermission(models.PermissionClientsRead), clientHandler.GetClient)
+		adminGroup.PUT("/clients/:client_id", rbacHandler.RequirePermission(models.PermissionClientsWrite), clientHandler.UpdateClient)
+		adminGroup.DELETE("/clients/:client_id", rbacHandler.RequirePermission(models.PermissionClientsWrite), clientHandler.DeleteClient)
+		adminGroup.POST("/clients/:client_id/secrets", rbacHandler.RequirePermission(models.PermissionClientsWrite), clientHandler.RotateClientSecret)
+		adminGroup.DELETE("/clients/:client_id/secrets/:secret_id", rbacHandler.RequirePermission(models.PermissionClientsWrite), clientHandler.RevokeClientSecret)
+		adminGroup.DELETE("/clients/:client_id/tokens", rbacHandler.RequirePermission(models.PermissionTokensRevoke), clientHandler.RevokeClientTokens)
+		adminGroup.POST("/consumers", rbacHandler.RequirePermission(models.PermissionConsumersWrite), clientHandler.CreateConsumer)
+		adminGroup.GET("/consumers", rbacHandler.RequirePermission(models.PermissionConsumersRead), clientHandler.ListConsumers)
+		adminGroup.GET("/consumers/:consumer_id", rbacHandler.RequirePermission(models.PermissionConsumersRead), clientHandler.GetConsumer)
+		adminGroup.PUT("/consumers/:consumer_id", rbacHandler.RequirePermission(models.PermissionConsumersWrite), clientHandler.UpdateConsumer)
+		adminGroup.DELETE("/consumers/:consumer_id", rbacHandler.RequirePermission(models.PermissionConsumersWrite), rbacHandler.RequirePermission(models.PermissionClientsWrite), clientHandler.DeleteConsumer)
+		adminGroup.GET("/consumers/:consumer_id/clients", rbacHandler.RequirePermission(models.PermissionConsumersRead), clientHandler.ListConsumerClients)
+		adminGroup.GET("/consumers/:consumer_id/tokens", rbacHandler.RequirePermission(models.PermissionConsumersRead), clientHandler.ListConsumerTokens)
+		adminGroup.GET("/metrics", rbacHandler.RequirePermission(models.PermissionMetricsRead), gin.WrapH(expvar.Handler()))
+		adminGroup.GET("/roles", rbacHandler.RequirePermission(models.PermissionUsersRead), rbacHandler.ListRoles)
+		adminGroup.POST("/users", rbacHandler.RequirePermission(models.PermissionUsersWrite), userHandler.CreateUser)
+		adminGroup.POST("/users/:user_id/deactivate", rbacHandler.RequirePermission(models.PermissionUsersWrite), userHandler.DeactivateUser)
+		adminGroup.DELETE("/users/:user_id/tokens", rbacHandler.RequirePermission(models.PermissionTokensRevoke), userHandler.RevokeUserTokens)
+		adminGroup.GET("/users/:user_id/roles", rbacHandler.RequirePermission(models.PermissionUsersRead), rbacHandler.GetUserRoles)
+		adminGroup.POST("/users/:user_id/roles", rbacHandler.RequirePermission(models.PermissionRolesWrite), rbacHandler.AssignUserRole)
+		adminGroup.DELETE("/users/:user_id/roles/:role", rbacHandler.RequirePermission(models.PermissionRolesWrite), rbacHandler.RemoveUserRole)
+		adminGroup.GET("/identity-providers", rbacHandler.RequirePermission(models.PermissionIdentityProvidersWrite), federationHandler.ListProviders)
+		adminGroup.POST("/identity-providers", rbacHandler.RequirePermission(models.PermissionIdentityProvidersWrite), federationHandler.CreateProvider)
+		adminGroup.PUT("/identity-providers/:id", rbacHandler.RequirePermission(models.PermissionIdentityProvidersWrite), federationHandler.UpdateProvider)
+		adminGroup.DELETE("/identity-providers/:id", rbacHandler.RequirePermission(models.PermissionIdentityProvidersWrite), federationHandler.DeleteProvider)
+	}
+
+	// SCIM 2.0 provisioning, only for tokens of the client in SCIM_CLIENT_ID
+	scimGroup := router.Group("/scim/v2")
+	scimGroup.Use(oauth2Handler.ValidateToken(), scimHandler.RequireScimClient())
+	{
+		scimGroup.GET("/ServiceProviderConfig", scimHandler.ServiceProviderConfig)
+		scimGroup.GET("/ResourceTypes", scimHandler.ResourceTypes)
+		scimGroup.GET("/Schemas", scimHandler.Schemas)
+		scimGroup.GET("/Users", scimHandler.ListUsers)
+		scimGroup.POST("/Users", scimHandler.CreateUser)
+		scimGroup.GET("/Users/:id", scimHandler.GetUser)
+		scimGroup.PUT("/Users/:id", scimHandler.ReplaceUser)
+		scimGroup.PATCH("/Users/:id", scimHandler.PatchUser)
+		scimGroup.DELETE("/Users/:id", scimHandler.DeleteUser)
+		scimGroup.GET("/Groups", scimHandler.ListGroups)
+		scimGroup.POST("/Groups", scimHandler.CreateGroup)
+		scimGroup.GET("/Groups/:id", scimHandler.GetGroup)
+		scimGroup.PUT("/Groups/:id", scimHandler.ReplaceGroup)
+		scimGroup.PATCH("/Groups/:id", scimHandler.PatchGroup)
+		scimGroup.DELETE("/Groups/:id", scimHandler.DeleteGroup)
 	}
 
 	return router
@@ -181,7 +281,7 @@ func setupRouter(oauth2Handler *handlers.OAuth2Handler, authHandler *handlers.Au
 func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
 		c.Header("Access-Control-Expose-Headers", "Content-Length")
 		c.Header("Access-Control-Allow-Credentials", "true")
@@ -194,159 +294,3 @@ func corsMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
-
-func createConsumer(c *gin.Context) {
-	var req struct {
-		Username string `json:"username"`
-		CustomID string `json:"custom_id"`
-	}
-
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
-		return
-	}
-
-	consumer := &models.Consumer{
-		Username: req.Username,
-		CustomID: req.CustomID,
-	}
-
-	if err := globalDB.Create(consumer).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create consumer"})
-		return
-	}
-
-	c.JSON(http.StatusCreated, consumer)
-}
-
-func listConsumers(c *gin.Context) {
-	var consumers []models.Consumer
-	if err := globalDB.Find(&consumers).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch consumers"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"total": len(consumers),
-		"data":  consumers,
-	})
-}
-
-func getConsumer(c *gin.Context) {
-	consumerID := c.Param("consumer_id")
-
-	var consumer models.Consumer
-	if err := globalDB.Where("id = ?", consumerID).First(&consumer).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "consumer not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch consumer"})
-		return
-	}
-
-	c.JSON(http.StatusOK, consumer)
-}
-
-func listClients(c *gin.Context) {
-	var clients []models.OAuth2Credential
-	if err := globalDB.Preload("Consumer").Find(&clients).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch clients"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"total": len(clients),
-		"data":  clients,
-	})
-}
-
-func createClient(c *gin.Context) {
-	var req struct {
-		Name         string    `json:"name" binding:"required"`
-		ClientID     string    `json:"client_id"`
-		ClientSecret string    `json:"client_secret"`
-		RedirectURIs []string  `json:"redirect_uris" binding:"required" swaggertype:"array,string"`
-		ConsumerID   uuid.UUID `json:"consumer_id" binding:"required"`
-	}
-
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
-		return
-	}
-
-	client := &models.OAuth2Credential{
-		Name:         req.Name,
-		ClientID:     req.ClientID,
-		ClientSecret: req.ClientSecret,
-		RedirectURIs: req.RedirectURIs,
-		ConsumerID:   req.ConsumerID,
-	}
-
-	if err := globalDB.Create(client).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create client"})
-		return
-	}
-
-	c.JSON(http.StatusCreated, client)
-}
-
-func getClient(c *gin.Context) {
-	clientID := c.Param("client_id")
-
-	var client models.OAuth2Credential
-	if err := globalDB.Preload("Consumer").Where("client_id = ?", clientID).First(&client).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "client not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch client"})
-		return
-	}
-
-	c.JSON(http.StatusOK, client)
-}
-
-func updateClient(c *gin.Context) {
-	clientID := c.Param("client_id")
-
-	var updates map[string]interface{}
-	if err := c.ShouldBindJSON(&updates); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
-		return
-	}
-
-	var client models.OAuth2Credential
-	if err := globalDB.Where("client_id = ?", clientID).First(&client).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "client not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch client"})
-		return
-	}
-
-	if err := globalDB.Model(&client).Updates(updates).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update client"})
-		return
-	}
-
-	c.JSON(http.StatusOK, client)
-}
-
-func deleteClient(c *gin.Context) {
-	clientID := c.Param("client_id")
-
-	result := globalDB.Where("client_id = ?", clientID).Delete(&models.OAuth2Credential{})
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete client"})
-		return
-	}
-
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "client not found"})
-		return
-	}
-
-	c.JSON(http.StatusNoContent, nil)
-}
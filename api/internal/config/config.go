@@ -8,10 +8,159 @@ import (
 type Config struct {
 	Port         string
 	Host         string
+	PublicURL    string
 	DatabaseURL  string
 	OAuth2       OAuth2Config
 	ProvisionKey string
 	Minio        MinioConfig
+	Storage      StorageConfig
+	Account      AccountConfig
+	Export       ExportConfig
+	Session      SessionConfig
+	LDAP         LDAPConfig
+	Scim         ScimConfig
+	Password     PasswordPolicyConfig
+	Hashing      HashingConfig
+	Inference    InferenceConfig
+	Images       ImageConfig
+}
+
+type ImageConfig struct {
+	// Minutes an image may stay pending before the reconciler treats its row
+	// and blobs as a failed upload
+	PendingTimeout int
+	// Minutes between reconciler runs
+	ReconcileInterval int
+	// Most images and blobs one reconciler run may remove, the rest waits
+	// for the next run
+	ReconcileMaxDeletions int
+	// Hours a deleted image stays in the trash before its blobs and row are
+	// purged
+	TrashRetention int
+	// Minutes between purge runs
+	PurgeInterval int
+	// Comma separated thumbnail sizes in pixels, requested as thumb_<size>
+	ThumbnailSizes string
+	// Render every derivative right after an upload instead of on the first
+	// request for it
+	DerivativesOnUpload bool
+}
+
+// InferenceConfig points at the segmentation model service the API calls on
+// behalf of the browser
+type InferenceConfig struct {
+	URL string
+	// Seconds one call to the model may take. All attempts together have
+	// to fit in the server's 15s write timeout
+	Timeout int
+	// Extra attempts after a failed call, with exponential backoff starting
+	// at RetryBackoff milliseconds
+	MaxRetries   int
+	RetryBackoff int
+	// Consecutive failures that open the circuit breaker, and seconds it
+	// stays open before letting a trial call through
+	BreakerThreshold int
+	BreakerCooldown  int
+}
+
+// HashingConfig selects how passwords and client secrets are hashed, see
+// cmd/hash-benchmark to pick the parameters
+type HashingConfig struct {
+	// argon2id, scrypt or bcrypt
+	Algorithm string
+	// Argon2id memory in KiB
+	Argon2Memory  int
+	Argon2Time    int
+	Argon2Threads int
+	// scrypt N as a power of two
+	ScryptLogN int
+	ScryptR    int
+	ScryptP    int
+	BcryptCost int
+}
+
+type PasswordPolicyConfig struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// Bloom filter of breached passwords built with cmd/breached-filter,
+	// the check is skipped while empty
+	BreachedFilterPath string
+}
+
+type ScimConfig struct {
+	// OAuth2 client whose tokens may call the SCIM endpoints, SCIM is
+	// disabled while empty
+	ClientID string
+}
+
+type LDAPConfig struct {
+	Enabled      bool
+	URL          string
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// Search filter, every %s is replaced with the escaped login identifier
+	UserFilter   string
+	EmailAttr    string
+	NameAttr     string
+	UsernameAttr string
+	GroupAttr    string
+	// Group CN to role name, e.g. "admins:admin,operators:operator"
+	GroupRoles string
+	// Seconds to connect to the directory and to wait for each operation
+	Timeout int
+}
+
+type SessionConfig struct {
+	CookieName string
+	// Secure cookies are only sent over HTTPS, disable for local development
+	CookieSecure bool
+	// Minutes without activity before a session ends
+	IdleTimeout int
+	// Hours after login before a session ends regardless of activity
+	AbsoluteTimeout int
+}
+
+type ExportConfig struct {
+	// Hours a finished export can be downloaded
+	LinkExpiration int
+	// Minutes an export may stay pending or running before it is taken as
+	// failed, its goroutine does not survive a restart
+	JobTimeout int
+	// Base URL of the gateway logger, used to collect a user's request logs
+	LoggerURL string
+	// Shared secret the logger requires to read logs back
+	LoggerToken string
+}
+
+type AccountConfig struct {
+	// Hours between an account being deactivated and its data being purged
+	DeletionGracePeriod int
+	// Hours an email change verification token stays valid
+	EmailVerificationExpiration int
+	// Write email verification tokens to the log, there is no mail delivery
+	// yet. Development only, anyone reading the logs can confirm the change.
+	LogVerificationTokens bool
+}
+
+// StorageConfig selects where image and export blobs are kept
+type StorageConfig struct {
+	// minio, filesystem or memory
+	Backend string
+	// MinIO bucket, only used by the minio backend
+	Bucket string
+	// Directory of the filesystem backend
+	Path string
+	// presign hands out URLs of the backend itself, signed URLs served by
+	// the API. Backends that cannot presign always get signed URLs.
+	URLMode string
+	// Seconds an image URL stays valid
+	URLExpiry int
+	// HMAC secret of signed URLs, has to be the same on every replica
+	SigningKey string
 }
 
 type MinioConfig struct {
@@ -24,11 +173,14 @@ type OAuth2Config struct {
 	AccessTokenExpiration  int `json:"token_expiration"`
 	RefreshTokenExpiration int `json:"refresh_token_expiration"`
 	AuthCodeExpiration     int `json:"auth_code_expiration"`
+	// Seconds the previous client secrets keep working after a rotation
+	ClientSecretRotationOverlap int `json:"client_secret_rotation_overlap"`
 
-	EnableClientCredentials   bool `json:"enable_client_credentials"`
-	EnableAuthorizationCode   bool `json:"enable_authorization_code"`
-	EnableImplicitGrant       bool `json:"enable_implicit_grant"`
-	EnablePasswordCredentials bool `json:"enable_password_credentials"`
+	// Defaults for clients without their own grant and response types. The
+	// password grant has no default, clients have to list it themselves.
+	EnableClientCredentials bool `json:"enable_client_credentials"`
+	EnableAuthorizationCode bool `json:"enable_authorization_code"`
+	EnableImplicitGrant     bool `json:"enable_implicit_grant"`
 
 	EnablePKCE   bool `json:"enable_pkce"`
 	PKCERequired bool `json:"pkce_required"`
@@ -47,6 +199,7 @@ func LoadConfig() *Config {
 	return &Config{
 		Port:         getEnv("PORT", "8080"),
 		Host:         getEnv("HOST", "0.0.0.0"),
+		PublicURL:    getEnv("PUBLIC_URL", "http://localhost:8080"),
 		DatabaseURL:  getEnv("DATABASE_URL", ""),
 		ProvisionKey: getEnv("PROVISION_KEY", generateProvisionKey()),
 
@@ -56,15 +209,103 @@ func LoadConfig() *Config {
 			RootPwd:  getEnv("MINIO_ROOT_PASSWORD", "holaJorge@1234"),
 		},
 
+		Storage: StorageConfig{
+			Backend:    getEnv("STORAGE_BACKEND", "minio"),
+			Bucket:     getEnv("STORAGE_BUCKET", "cc-images"),
+			Path:       getEnv("STORAGE_PATH", "./data/blobs"),
+			URLMode:    getEnv("STORAGE_URL_MODE", "presign"),
+			URLExpiry:  getEnvAsInt("STORAGE_URL_EXPIRY", 300),
+			SigningKey: getEnv("STORAGE_SIGNING_KEY", ""),
+		},
+
+		Account: AccountConfig{
+			DeletionGracePeriod:         getEnvAsInt("ACCOUNT_DELETION_GRACE_PERIOD", 72),
+			EmailVerificationExpiration: getEnvAsInt("EMAIL_VERIFICATION_EXPIRATION", 24),
+			LogVerificationTokens:       getEnvAsBool("LOG_VERIFICATION_TOKENS", false),
+		},
+
+		Export: ExportConfig{
+			LinkExpiration: getEnvAsInt("EXPORT_LINK_EXPIRATION", 24),
+			JobTimeout:     getEnvAsInt("EXPORT_JOB_TIMEOUT", 30),
+			LoggerURL:      getEnv("LOGGER_URL", "http://localhost:8080"),
+			LoggerToken:    getEnv("LOGGER_READ_TOKEN", ""),
+		},
+
+		Session: SessionConfig{
+			CookieName:      getEnv("SESSION_COOKIE_NAME", "ccs_session"),
+			CookieSecure:    getEnvAsBool("SESSION_COOKIE_SECURE", true),
+			IdleTimeout:     getEnvAsInt("SESSION_IDLE_TIMEOUT", 30),
+			AbsoluteTimeout: getEnvAsInt("SESSION_ABSOLUTE_TIMEOUT", 12),
+		},
+
+		LDAP: LDAPConfig{
+			Enabled:      getEnvAsBool("LDAP_ENABLED", false),
+			URL:          getEnv("LDAP_URL", "ldap://localhost:389"),
+			BindDN:       getEnv("LDAP_BIND_DN", ""),
+			BindPassword: getEnv("LDAP_BIND_PASSWORD", ""),
+			BaseDN:       getEnv("LDAP_BASE_DN", ""),
+			UserFilter:   getEnv("LDAP_USER_FILTER", "(&(objectClass=inetOrgPerson)(|(mail=%s)(uid=%s)))"),
+			EmailAttr:    getEnv("LDAP_EMAIL_ATTR", "mail"),
+			NameAttr:     getEnv("LDAP_NAME_ATTR", "cn"),
+			UsernameAttr: getEnv("LDAP_USERNAME_ATTR", "uid"),
+			GroupAttr:    getEnv("LDAP_GROUP_ATTR", "memberOf"),
+			GroupRoles:   getEnv("LDAP_GROUP_ROLES", ""),
+			Timeout:      getEnvAsInt("LDAP_TIMEOUT", 5),
+		},
+
+		Password: PasswordPolicyConfig{
+			MinLength:          getEnvAsInt("PASSWORD_MIN_LENGTH", 10),
+			RequireUpper:       getEnvAsBool("PASSWORD_REQUIRE_UPPER", true),
+			RequireLower:       getEnvAsBool("PASSWORD_REQUIRE_LOWER", true),
+			RequireDigit:       getEnvAsBool("PASSWORD_REQUIRE_DIGIT", true),
+			RequireSymbol:      getEnvAsBool("PASSWORD_REQUIRE_SYMBOL", false),
+			BreachedFilterPath: getEnv("PASSWORD_BREACHED_FILTER", ""),
+		},
+
+		Hashing: HashingConfig{
+			Algorithm:     getEnv("PASSWORD_HASH_ALGORITHM", "argon2id"),
+			Argon2Memory:  getEnvAsInt("ARGON2_MEMORY", 19456),
+			Argon2Time:    getEnvAsInt("ARGON2_TIME", 2),
+			Argon2Threads: getEnvAsInt("ARGON2_THREADS", 1),
+			ScryptLogN:    getEnvAsInt("SCRYPT_LOG_N", 15),
+			ScryptR:       getEnvAsInt("SCRYPT_R", 8),
+			ScryptP:       getEnvAsInt("SCRYPT_P", 1),
+			BcryptCost:    getEnvAsInt("BCRYPT_COST", 12),
+		},
+
+		Scim: ScimConfig{
+			ClientID: getEnv("SCIM_CLIENT_ID", ""),
+		},
+
+		Images: ImageConfig{
+			PendingTimeout:        getEnvAsInt("IMAGE_PENDING_TIMEOUT", 15),
+			ReconcileInterval:     getEnvAsInt("IMAGE_RECONCILE_INTERVAL", 60),
+			ReconcileMaxDeletions: getEnvAsInt("IMAGE_RECONCILE_MAX_DELETIONS", 100),
+			TrashRetention:        getEnvAsInt("IMAGE_TRASH_RETENTION", 720),
+			PurgeInterval:         getEnvAsInt("IMAGE_PURGE_INTERVAL", 60),
+			ThumbnailSizes:        getEnv("IMAGE_THUMBNAIL_SIZES", "64,128,256"),
+			DerivativesOnUpload:   getEnvAsBool("IMAGE_DERIVATIVES_ON_UPLOAD", false),
+		},
+
+		Inference: InferenceConfig{
+			URL:              getEnv("INFERENCE_URL", "http://localhost:8000/"),
+			Timeout:          getEnvAsInt("INFERENCE_TIMEOUT", 5),
+			MaxRetries:       getEnvAsInt("INFERENCE_MAX_RETRIES", 1),
+			RetryBackoff:     getEnvAsInt("INFERENCE_RETRY_BACKOFF", 200),
+			BreakerThreshold: getEnvAsInt("INFERENCE_BREAKER_THRESHOLD", 5),
+			BreakerCooldown:  getEnvAsInt("INFERENCE_BREAKER_COOLDOWN", 30),
+		},
+
 		OAuth2: OAuth2Config{
 			AccessTokenExpiration:  getEnvAsInt("ACCESS_TOKEN_EXPIRATION", 7200),
 			RefreshTokenExpiration: getEnvAsInt("REFRESH_TOKEN_EXPIRATION", 1209600),
 			AuthCodeExpiration:     getEnvAsInt("AUTH_CODE_EXPIRATION", 600),
 
-			EnableClientCredentials:   getEnvAsBool("ENABLE_CLIENT_CREDENTIALS", true),
-			EnableAuthorizationCode:   getEnvAsBool("ENABLE_AUTHORIZATION_CODE", true),
-			EnableImplicitGrant:       getEnvAsBool("ENABLE_IMPLICIT_GRANT", false),
-			EnablePasswordCredentials: getEnvAsBool("ENABLE_PASSWORD_CREDENTIALS", false),
+			ClientSecretRotationOverlap: getEnvAsInt("CLIENT_SECRET_ROTATION_OVERLAP", 86400),
+
+			EnableClientCredentials: getEnvAsBool("ENABLE_CLIENT_CREDENTIALS", true),
+			EnableAuthorizationCode: getEnvAsBool("ENABLE_AUTHORIZATION_CODE", true),
+			EnableImplicitGrant:     getEnvAsBool("ENABLE_IMPLICIT_GRANT", false),
 
 			EnablePKCE:   getEnvAsBool("ENABLE_PKCE", true),
 			PKCERequired: getEnvAsBool("PKCE_REQUIRED", false),
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"auth-service/internal/models"
+	"auth-service/internal/services"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -9,11 +10,12 @@ import (
 )
 
 type AuthHandler struct {
-	db *gorm.DB
+	db             *gorm.DB
+	passwordPolicy *services.PasswordPolicy
 }
 
-func NewAuthHandler(db *gorm.DB) *AuthHandler {
-	return &AuthHandler{db: db}
+func NewAuthHandler(db *gorm.DB, passwordPolicy *services.PasswordPolicy) *AuthHandler {
+	return &AuthHandler{db: db, passwordPolicy: passwordPolicy}
 }
 
 // ShowAuthorizationPage godoc
@@ -71,7 +73,7 @@ func (h *AuthHandler) ShowAuthorizationPage(c *gin.Context) {
 // @Produce      json
 // @Param        user  body   object{email=string,password=string,username=string,name=string}  true  "User registration object"
 // @Success      201  {object}  map[string]interface{}
-// @Failure      400  {object}  map[string]string
+// @Failure      400  {object}  map[string]interface{}  "Invalid request or password policy violations"
 // @Failure      409  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
 // @Router       /auth/register [post]
@@ -94,6 +96,11 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	if err := h.passwordPolicy.Validate(req.Password, req.Username, req.Email); err != nil {
+		sendPasswordPolicyError(c, err)
+		return
+	}
+
 	user := &models.User{
 		Email:    req.Email,
 		Username: req.Username,
@@ -106,6 +113,14 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	var role models.Role
+	if err := h.db.Where("name = ?", models.RoleUser).First(&role).Error; err == nil {
+		if err := h.db.Model(user).Association("Roles").Append(&role); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to assign role"})
+			return
+		}
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
 		"id":       user.ID,
 		"email":    user.Email,
@@ -0,0 +1,467 @@
+package handlers
+
+import (
+	"auth-service/internal/services"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type ClientHandler struct {
+	clientService *services.ClientService
+}
+
+func NewClientHandler(clientService *services.ClientService) *ClientHandler {
+	return &ClientHandler{
+		clientService: clientService,
+	}
+}
+
+// ListClients godoc
+// @Summary      List OAuth2 clients
+// @Description  Returns a page of OAuth2 clients with their consumer
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        consumer_id  query  string  false  "Consumer ID"
+// @Param        name         query  string  false  "Part of the client name"
+// @Param        limit        query  int     false  "Limit"
+// @Param        offset       query  int     false  "Offset"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Router       /admin/clients [get]
+func (h *ClientHandler) ListClients(c *gin.Context) {
+	filter := services.ClientFilter{Name: c.Query("name")}
+	if consumerIDStr := c.Query("consumer_id"); consumerIDStr != "" {
+		consumerID, err := uuid.Parse(consumerIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid consumer_id format"})
+			return
+		}
+		filter.ConsumerID = &consumerID
+	}
+	filter.Limit, filter.Offset = paginationParams(c)
+
+	h.listClients(c, &filter)
+}
+
+func (h *ClientHandler) listClients(c *gin.Context, filter *services.ClientFilter) {
+	clients, total, err := h.clientService.ListClients(filter)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":   clients,
+		"total":  total,
+		"limit":  filter.Limit,
+		"offset": filter.Offset,
+	})
+}
+
+// CreateClient godoc
+// @Summary      Create an OAuth2 client
+// @Description  Registers a client for a consumer. client_id and client_secret are generated when left out; a generated secret is only ever returned in this response.
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        client  body  services.CreateClientRequest  true  "Client"
+// @Success      201  {object}  services.CreatedClient
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string  "Consumer not found"
+// @Failure      409  {object}  map[string]string
+// @Router       /admin/clients [post]
+func (h *ClientHandler) CreateClient(c *gin.Context) {
+	var req services.CreateClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	client, err := h.clientService.CreateClient(&req)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, client)
+}
+
+// GetClient godoc
+// @Summary      Get an OAuth2 client
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        client_id  path  string  true  "Client ID"
+// @Success      200  {object}  models.OAuth2Credential
+// @Failure      404  {object}  map[string]string
+// @Router       /admin/clients/{client_id} [get]
+func (h *ClientHandler) GetClient(c *gin.Context) {
+	client, err := h.clientService.GetClient(c.Param("client_id"))
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, client)
+}
+
+// UpdateClient godoc
+// @Summary      Update an OAuth2 client
+// @Description  Updates the name and/or redirect URIs. Any other field is rejected.
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        client_id  path  string                       true  "Client ID"
+// @Param        client     body  services.UpdateClientRequest  true  "Fields to update"
+// @Success      200  {object}  models.OAuth2Credential
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /admin/clients/{client_id} [put]
+func (h *ClientHandler) UpdateClient(c *gin.Context) {
+	// Unknown fields such as client_secret or consumer_id are an error rather
+	// than silently ignored, so callers notice they were not applied
+	var req services.UpdateClientRequest
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	client, err := h.clientService.UpdateClient(c.Param("client_id"), &req)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, client)
+}
+
+// DeleteClient godoc
+// @Summary      Delete an OAuth2 client
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Param        client_id  path  string  true  "Client ID"
+// @Success      204  "No Content"
+// @Failure      404  {object}  map[string]string
+// @Router       /admin/clients/{client_id} [delete]
+func (h *ClientHandler) DeleteClient(c *gin.Context) {
+	if err := h.clientService.DeleteClient(c.Param("client_id")); err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RotateClientSecret godoc
+// @Summary      Rotate a client secret
+// @Description  Issues a new secret, returned only in this response, and sets the current secrets to expire after the overlap
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        client_id  path  string                       true   "Client ID"
+// @Param        rotation   body  services.RotateSecretRequest  false  "Expiration of the new and previous secrets"
+// @Success      201  {object}  services.IssuedSecret
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /admin/clients/{client_id}/secrets [post]
+func (h *ClientHandler) RotateClientSecret(c *gin.Context) {
+	var req services.RotateSecretRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+	}
+
+	secret, err := h.clientService.RotateSecret(c.Param("client_id"), &req)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, secret)
+}
+
+// RevokeClientSecret godoc
+// @Summary      Revoke a client secret
+// @Description  Expires one secret of the client immediately
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Param        client_id  path  string  true  "Client ID"
+// @Param        secret_id  path  string  true  "Secret ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /admin/clients/{client_id}/secrets/{secret_id} [delete]
+func (h *ClientHandler) RevokeClientSecret(c *gin.Context) {
+	secretID, err := uuid.Parse(c.Param("secret_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid secret ID format"})
+		return
+	}
+
+	if err := h.clientService.RevokeSecret(c.Param("client_id"), secretID); err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeClientTokens godoc
+// @Summary      Revoke a client's tokens
+// @Description  Deletes every token issued to the client
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        client_id  path  string  true  "Client ID"
+// @Success      200  {object}  map[string]int64
+// @Failure      404  {object}  map[string]string
+// @Router       /admin/clients/{client_id}/tokens [delete]
+func (h *ClientHandler) RevokeClientTokens(c *gin.Context) {
+	revoked, err := h.clientService.RevokeClientTokens(c.Param("client_id"))
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revoked": revoked})
+}
+
+// ListConsumers godoc
+// @Summary      List consumers
+// @Description  Returns a page of consumers. Repeating tag returns the consumers that carry every given tag.
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        username   query  string    false  "Username"
+// @Param        custom_id  query  string    false  "Custom ID"
+// @Param        tag        query  []string  false  "Tag" collectionFormat(multi)
+// @Param        limit      query  int       false  "Limit"
+// @Param        offset     query  int       false  "Offset"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Router       /admin/consumers [get]
+func (h *ClientHandler) ListConsumers(c *gin.Context) {
+	filter := services.ConsumerFilter{
+		Username: c.Query("username"),
+		CustomID: c.Query("custom_id"),
+		Tags:     c.QueryArray("tag"),
+	}
+	filter.Limit, filter.Offset = paginationParams(c)
+
+	consumers, total, err := h.clientService.ListConsumers(&filter)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":   consumers,
+		"total":  total,
+		"limit":  filter.Limit,
+		"offset": filter.Offset,
+	})
+}
+
+// CreateConsumer godoc
+// @Summary      Create a consumer
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        consumer  body  services.CreateConsumerRequest  true  "Consumer"
+// @Success      201  {object}  models.Consumer
+// @Failure      400  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /admin/consumers [post]
+func (h *ClientHandler) CreateConsumer(c *gin.Context) {
+	var req services.CreateConsumerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	consumer, err := h.clientService.CreateConsumer(&req)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, consumer)
+}
+
+// GetConsumer godoc
+// @Summary      Get a consumer
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        consumer_id  path  string  true  "Consumer ID"
+// @Success      200  {object}  models.Consumer
+// @Failure      404  {object}  map[string]string
+// @Router       /admin/consumers/{consumer_id} [get]
+func (h *ClientHandler) GetConsumer(c *gin.Context) {
+	consumer, err := h.clientService.GetConsumer(c.Param("consumer_id"))
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, consumer)
+}
+
+// UpdateConsumer godoc
+// @Summary      Update a consumer
+// @Description  Replaces the given fields. Tags and metadata are replaced as a whole. Any other field is rejected.
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        consumer_id  path  string                         true  "Consumer ID"
+// @Param        consumer     body  services.UpdateConsumerRequest  true  "Fields to update"
+// @Success      200  {object}  models.Consumer
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /admin/consumers/{consumer_id} [put]
+func (h *ClientHandler) UpdateConsumer(c *gin.Context) {
+	var req services.UpdateConsumerRequest
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	consumer, err := h.clientService.UpdateConsumer(c.Param("consumer_id"), &req)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, consumer)
+}
+
+// DeleteConsumer godoc
+// @Summary      Delete a consumer
+// @Description  A consumer with clients is only deleted with cascade=true, which deletes its clients and their tokens too.
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Param        consumer_id  path   string  true   "Consumer ID"
+// @Param        cascade      query  bool    false  "Delete the consumer's clients as well"
+// @Success      204  "No Content"
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string  "Consumer has clients"
+// @Router       /admin/consumers/{consumer_id} [delete]
+func (h *ClientHandler) DeleteConsumer(c *gin.Context) {
+	cascade, _ := strconv.ParseBool(c.Query("cascade"))
+	if err := h.clientService.DeleteConsumer(c.Param("consumer_id"), cascade); err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListConsumerClients godoc
+// @Summary      List a consumer's clients
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        consumer_id  path   string  true   "Consumer ID"
+// @Param        limit        query  int     false  "Limit"
+// @Param        offset       query  int     false  "Offset"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]string
+// @Router       /admin/consumers/{consumer_id}/clients [get]
+func (h *ClientHandler) ListConsumerClients(c *gin.Context) {
+	consumer, err := h.clientService.GetConsumer(c.Param("consumer_id"))
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	filter := services.ClientFilter{ConsumerID: &consumer.ID}
+	filter.Limit, filter.Offset = paginationParams(c)
+
+	h.listClients(c, &filter)
+}
+
+// ListConsumerTokens godoc
+// @Summary      List a consumer's active tokens
+// @Description  Returns the unexpired access tokens issued to any of the consumer's clients, with the token values redacted
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        consumer_id  path   string  true   "Consumer ID"
+// @Param        limit        query  int     false  "Limit"
+// @Param        offset       query  int     false  "Offset"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]string
+// @Router       /admin/consumers/{consumer_id}/tokens [get]
+func (h *ClientHandler) ListConsumerTokens(c *gin.Context) {
+	limit, offset := paginationParams(c)
+
+	tokens, total, err := h.clientService.ListConsumerTokens(c.Param("consumer_id"), limit, offset)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":   tokens,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// paginationParams reads limit and offset the way the image listing does:
+// 10 by default, at most 100, and invalid values are ignored.
+func paginationParams(c *gin.Context) (int, int) {
+	limit := 10
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
+			limit = min(parsedLimit, 100)
+		}
+	}
+
+	offset := 0
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		if parsedOffset, err := strconv.Atoi(offsetStr); err == nil && parsedOffset >= 0 {
+			offset = parsedOffset
+		}
+	}
+
+	return limit, offset
+}
+
+func (h *ClientHandler) sendError(c *gin.Context, err error) {
+	switch err.Error() {
+	case "client not found", "consumer not found", "secret not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case "client already exists", "consumer already exists", "consumer has clients":
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case "invalid redirect_uri", "name cannot be empty", "username cannot be empty", "invalid expiration",
+		"invalid grant_types", "invalid response_types", "invalid token lifetime", "invalid refresh_token_policy",
+		"public clients cannot use client_credentials", "public clients cannot use password", "public clients cannot have a secret":
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
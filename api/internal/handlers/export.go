@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/services"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type ExportHandler struct {
+	exportService *services.ExportService
+}
+
+func NewExportHandler(exportService *services.ExportService) *ExportHandler {
+	return &ExportHandler{
+		exportService: exportService,
+	}
+}
+
+// RequestExport godoc
+// @Summary      Request a personal data export
+// @Description  Starts an asynchronous export of everything stored about the authenticated user
+// @Tags         me
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Success      202  {object}  models.ExportJob
+// @Failure      401  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /me/export [post]
+func (h *ExportHandler) RequestExport(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.exportService.RequestExport(userID)
+	if err != nil {
+		switch err.Error() {
+		case "user not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case "export already in progress":
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, h.exportResponse(job))
+}
+
+// GetExport godoc
+// @Summary      Get a personal data export
+// @Description  Returns the status of an export and, once completed, its expiring download link
+// @Tags         me
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        id  path  string  true  "Export ID"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /me/export/{id} [get]
+func (h *ExportHandler) GetExport(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	exportID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid export ID format"})
+		return
+	}
+
+	job, err := h.exportService.GetExport(userID, exportID)
+	if err != nil {
+		if err.Error() == "export not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.exportResponse(job))
+}
+
+// DownloadExport godoc
+// @Summary      Download a personal data export
+// @Description  Streams the ZIP archive of a completed export while its link has not expired
+// @Tags         me
+// @Produce      application/zip
+// @Param        token  path  string  true  "Download token"
+// @Success      200  {file}  file
+// @Failure      404  {object}  map[string]string
+// @Router       /api/v1/exports/{token} [get]
+func (h *ExportHandler) DownloadExport(c *gin.Context) {
+	job, obj, err := h.exportService.OpenDownload(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		if err.Error() == "export not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer obj.Close()
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Length", fmt.Sprintf("%d", job.Size))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"export-%s.zip\"", job.ID))
+	// The status is already sent, a failed copy can only be logged and the
+	// client sees a short download
+	if _, err := io.Copy(c.Writer, obj); err != nil {
+		log.Printf("Download of export %s interrupted: %v", job.ID, err)
+	}
+}
+
+func (h *ExportHandler) exportResponse(job *models.ExportJob) gin.H {
+	response := gin.H{
+		"id":         job.ID,
+		"status":     job.Status,
+		"created_at": job.CreatedAt,
+	}
+
+	if job.Error != "" {
+		response["error"] = job.Error
+	}
+
+	if job.IsDownloadable() {
+		response["download_url"] = h.exportService.DownloadURL(job)
+		response["expires_at"] = job.ExpiresAt
+		response["size"] = job.Size
+	}
+
+	return response
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type FederationHandler struct {
+	federationService *services.FederationService
+	sessionService    *services.SessionService
+	config            *config.Config
+}
+
+func NewFederationHandler(federationService *services.FederationService, sessionService *services.SessionService, cfg *config.Config) *FederationHandler {
+	return &FederationHandler{
+		federationService: federationService,
+		sessionService:    sessionService,
+		config:            cfg,
+	}
+}
+
+// ListEnabledProviders godoc
+// @Summary      List identity providers
+// @Description  Returns the upstream identity providers users can log in with
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Router       /auth/federated [get]
+func (h *FederationHandler) ListEnabledProviders(c *gin.Context) {
+	providers, err := h.federationService.ListProviders(true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	data := make([]gin.H, len(providers))
+	for i, provider := range providers {
+		data[i] = gin.H{
+			"slug":      provider.Slug,
+			"name":      provider.Name,
+			"login_url": "/auth/federated/" + provider.Slug + "/login",
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": len(data),
+		"data":  data,
+	})
+}
+
+// FederatedLogin godoc
+// @Summary      Log in with an identity provider
+// @Description  Redirects to the upstream identity provider to authenticate
+// @Tags         auth
+// @Param        provider   path   string  true   "Identity provider slug"
+// @Param        return_to  query  string  false  "Relative URL to continue to after login"
+// @Success      302  {string}  string  "Redirects to the identity provider"
+// @Failure      404  {object}  map[string]string
+// @Failure      502  {object}  map[string]string
+// @Router       /auth/federated/{provider}/login [get]
+func (h *FederationHandler) FederatedLogin(c *gin.Context) {
+	authURL, err := h.federationService.BeginLogin(c.Request.Context(), c.Param("provider"), safeReturnTo(c.Query("return_to")))
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// FederatedCallback godoc
+// @Summary      Identity provider callback
+// @Description  Completes a federated login, linking or provisioning the local user and starting a login session
+// @Tags         auth
+// @Param        provider  path   string  true   "Identity provider slug"
+// @Param        code      query  string  true   "Authorization code"
+// @Param        state     query  string  true   "State"
+// @Success      302  {string}  string  "Redirects to return_to"
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Router       /auth/federated/{provider}/callback [get]
+func (h *FederationHandler) FederatedCallback(c *gin.Context) {
+	if errorCode := c.Query("error"); errorCode != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             errorCode,
+			"error_description": c.Query("error_description"),
+		})
+		return
+	}
+
+	user, returnTo, err := h.federationService.CompleteLogin(c.Request.Context(), c.Param("provider"), c.Query("state"), c.Query("code"))
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	raw, _, err := h.sessionService.CreateSession(user, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	setSessionCookie(c, h.config, raw, int(h.sessionService.AbsoluteTimeout().Seconds()))
+	c.Redirect(http.StatusFound, publicURL(h.config, safeReturnTo(returnTo)))
+}
+
+// ListProviders godoc
+// @Summary      List identity provider configurations
+// @Description  Returns every configured identity provider, enabled or not
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Router       /admin/identity-providers [get]
+func (h *FederationHandler) ListProviders(c *gin.Context) {
+	providers, err := h.federationService.ListProviders(false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": len(providers),
+		"data":  providers,
+	})
+}
+
+// CreateProvider godoc
+// @Summary      Create an identity provider
+// @Description  Registers an upstream OpenID Connect provider
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        provider  body  services.IdentityProviderRequest  true  "Provider configuration"
+// @Success      201  {object}  models.IdentityProvider
+// @Failure      400  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /admin/identity-providers [post]
+func (h *FederationHandler) CreateProvider(c *gin.Context) {
+	var req services.IdentityProviderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	provider, err := h.federationService.CreateProvider(&req)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, provider)
+}
+
+// UpdateProvider godoc
+// @Summary      Update an identity provider
+// @Description  Updates the given fields of an identity provider
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        id        path  string                            true  "Identity provider ID"
+// @Param        provider  body  services.IdentityProviderRequest  true  "Fields to update"
+// @Success      200  {object}  models.IdentityProvider
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /admin/identity-providers/{id} [put]
+func (h *FederationHandler) UpdateProvider(c *gin.Context) {
+	providerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid identity provider ID format"})
+		return
+	}
+
+	var req services.IdentityProviderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	provider, err := h.federationService.UpdateProvider(providerID, &req)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, provider)
+}
+
+// DeleteProvider godoc
+// @Summary      Delete an identity provider
+// @Description  Removes an identity provider and every identity linked through it
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Param        id  path  string  true  "Identity provider ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /admin/identity-providers/{id} [delete]
+func (h *FederationHandler) DeleteProvider(c *gin.Context) {
+	providerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid identity provider ID format"})
+		return
+	}
+
+	if err := h.federationService.DeleteProvider(providerID); err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *FederationHandler) sendError(c *gin.Context, err error) {
+	switch err.Error() {
+	case "identity provider not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case "identity provider already exists":
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case "identity provider unavailable":
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	case "invalid login state", "identity provider rejected the login",
+		"slug, name, issuer, client_id and client_secret are required":
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case "user is inactive", "email not verified by identity provider", "account email not verified",
+		"no account linked to this identity", "identity provider did not share an email":
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
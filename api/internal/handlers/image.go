@@ -2,39 +2,51 @@ package handlers
 
 import (
 	"auth-service/internal/services"
+	"auth-service/internal/storage"
+	"auth-service/internal/utils"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/minio/minio-go/v7"
 )
 
+// Both images of an upload together, with room for the multipart framing
+const maxImageUploadBytes = 6 << 20
+
+// Blobs are never rewritten, a new image gets new blob ids. Browsers may keep
+// them for a year.
+const blobMaxAge = 365 * 24 * 60 * 60
+
 type ImageHandler struct {
 	imageService *services.ImageService
-	MinioClient  *minio.Client
 }
 
-func NewImageHandler(imageService *services.ImageService, minioClient *minio.Client) *ImageHandler {
+func NewImageHandler(imageService *services.ImageService) *ImageHandler {
 	return &ImageHandler{
 		imageService: imageService,
-		MinioClient:  minioClient,
 	}
 }
 
 // CreateImage godoc
 // @Summary      Create an image record and upload images
-// @Description  Uploads original and inference images, creates a record for the user
+// @Description  Uploads original and inference images, creates a record for the user. The segmentation is stored as sent, so this needs images:write; users go through /inferences.
 // @Tags         images
 // @Accept       multipart/form-data
 // @Produce      json
-// @Param        original_image   formData  file   true  "Original image file"
-// @Param        inference_image  formData  file   true  "Inference image file"
+// @Param        original_image   formData  file   true  "Original drawing, 112x112 PNG"
+// @Param        inference_image  formData  file   true  "Inference image, PNG"
 // @Success      201  {object}  map[string]interface{}
-// @Failure      400  {object}  map[string]string
+// @Failure      400  {object}  services.ImageValidationError
 // @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      413  {object}  services.ImageValidationError
+// @Failure      415  {object}  services.ImageValidationError
+// @Failure      422  {object}  services.ImageValidationError
 // @Failure      500  {object}  map[string]string
 // @Router       /images [post]
 func (h *ImageHandler) CreateImage(c *gin.Context) {
@@ -50,102 +62,200 @@ func (h *ImageHandler) CreateImage(c *gin.Context) {
 		return
 	}
 
-	inferenceID := uuid.New()
-	receivedID := uuid.New()
+	// Both images are checked and re-encoded before anything is stored
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImageUploadBytes)
+
+	original, ok := readUploadedImage(c, "original_image", services.NormalizeDrawing)
+	if !ok {
+		return
+	}
+	inference, ok := readUploadedImage(c, "inference_image", services.NormalizeSegmentation)
+	if !ok {
+		return
+	}
 
-	originalHeader, err := c.FormFile("original_image")
+	image, err := h.imageService.CreateImage(c.Request.Context(), userID, &services.CreateImageRequest{
+		Drawing:      original,
+		Segmentation: inference,
+	})
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "original_image is required"})
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":           "Record and images created",
+		"id":                image.ID,
+		"sent_image_id":     image.SentImageID,
+		"received_image_id": image.ReceivedImageID,
+	})
+}
+
+// GetBlobFromID godoc
+// @Summary      Get image blob by ID
+// @Description  Returns the image file as binary. Blobs never change, so the response carries a strong ETag and Last-Modified, is cacheable by the browser for a year and answers conditional and Range requests
+// @Tags         images
+// @Produce      image/png
+// @Param        id  path  string  true  "Image ID"
+// @Param        If-None-Match  header  string  false  "ETag of a cached copy"
+// @Param        Range          header  string  false  "Byte range"
+// @Success      200  {file}  file
+// @Success      206  {file}  file
+// @Success      304  "Not Modified"
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      416  "Range Not Satisfiable"
+// @Failure      500  {object}  map[string]string
+// @Router       /images/blob/{id} [get]
+// @Router       /images/blob/{id} [head]
+func (h *ImageHandler) GetBlobFromID(c *gin.Context) {
+	viewer, ok := h.imageViewer(c)
+	if !ok {
 		return
 	}
-	originalFile, _ := originalHeader.Open()
-	defer originalFile.Close()
 
-	inferenceHeader, err := c.FormFile("inference_image")
+	blobID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "inference_image is required"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image ID format"})
 		return
 	}
-	inferenceFile, _ := inferenceHeader.Open()
-	defer inferenceFile.Close()
 
-	_, err = h.MinioClient.PutObject(
-		c.Request.Context(),
-		"cc-images",
-		fmt.Sprintf("%s.png", receivedID),
-		inferenceFile,
-		inferenceHeader.Size,
-		minio.PutObjectOptions{ContentType: inferenceHeader.Header.Get("Content-Type")},
-	)
+	// Only blobs of visible images are served, not those of other users,
+	// in the trash or still uploading
+	obj, info, err := h.imageService.OpenBlob(c.Request.Context(), viewer, blobID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to upload inference image"})
+		if err.Error() == "image not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	defer obj.Close()
+
+	// The response depends on the access token, shared caches must not keep it
+	serveBlob(c, obj, info, fmt.Sprintf("private, max-age=%d, immutable", blobMaxAge))
+}
 
-	_, err = h.MinioClient.PutObject(
-		c.Request.Context(),
-		"cc-images",
-		fmt.Sprintf("%s.png", inferenceID),
-		originalFile,
-		originalHeader.Size,
-		minio.PutObjectOptions{ContentType: originalHeader.Header.Get("Content-Type")},
-	)
+// GetImageBlob godoc
+// @Summary      Get an image blob or one of its derivatives
+// @Description  Returns the sent or received PNG of an image, or a derivative rendered from it on first request: thumb_<size> for each size in IMAGE_THUMBNAIL_SIZES, scaled down to fit a size x size square, or composite, the drawing next to its segmentation. Cached and conditional requests work as in /images/blob/{id}
+// @Tags         images
+// @Produce      image/png
+// @Param        id       path   string  true   "Image ID"
+// @Param        kind     query  string  false  "sent (default) or received, ignored by composite"
+// @Param        variant  query  string  false  "thumb_<size> or composite, the original when empty"
+// @Success      200  {file}  file
+// @Success      206  {file}  file
+// @Success      304  "Not Modified"
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      416  "Range Not Satisfiable"
+// @Failure      500  {object}  map[string]string
+// @Router       /images/{id}/blob [get]
+// @Router       /images/{id}/blob [head]
+func (h *ImageHandler) GetImageBlob(c *gin.Context) {
+	viewer, ok := h.imageViewer(c)
+	if !ok {
+		return
+	}
+
+	imageID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to upload original image"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image ID format"})
 		return
 	}
 
-	image, err := h.imageService.CreateImage(userID, &services.CreateImageRequest{
-		SentImageID:     &inferenceID,
-		ReceivedImageID: &receivedID,
-	})
+	obj, info, err := h.imageService.OpenImageBlob(c.Request.Context(), viewer, imageID, c.Query("kind"), c.Query("variant"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to create image",
-		})
+		sendBlobError(c, err)
+		return
 	}
+	defer obj.Close()
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message":           "Record and images created",
-		"id":                image.ID,
-		"sent_image_id":     inferenceID,
-		"received_image_id": receivedID,
-	})
+	// A derivative is rendered from blobs that never change, so it is as
+	// immutable as they are
+	serveBlob(c, obj, info, fmt.Sprintf("private, max-age=%d, immutable", blobMaxAge))
 }
 
-// GetBlobFromID godoc
-// @Summary      Get image blob by ID
-// @Description  Returns the image file as binary
+// GetBlobURL godoc
+// @Summary      Get a short-lived URL of an image blob
+// @Description  Returns a URL the browser can load the sent or received PNG, or a derivative of it, from without the access token, presigned by MinIO or signed by the API
+// @Tags         images
+// @Produce      json
+// @Param        id       path   string  true   "Image ID"
+// @Param        kind     query  string  false  "sent (default) or received"
+// @Param        variant  query  string  false  "Derivative, thumb_<size> or composite"
+// @Success      200  {object}  services.BlobURLResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /images/{id}/url [get]
+func (h *ImageHandler) GetBlobURL(c *gin.Context) {
+	viewer, ok := h.imageViewer(c)
+	if !ok {
+		return
+	}
+
+	imageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image ID format"})
+		return
+	}
+
+	url, err := h.imageService.BlobURL(c.Request.Context(), viewer, imageID, c.Query("kind"), c.Query("variant"))
+	if err != nil {
+		sendBlobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, url)
+}
+
+// GetSignedBlob godoc
+// @Summary      Get an image blob through a signed URL
+// @Description  Serves a blob from a URL returned by /images/{id}/url, the signature replaces the access token. Shared caches may keep the response until the URL expires, conditional and Range requests are answered as in /images/blob/{id}
 // @Tags         images
 // @Produce      image/png
-// @Param        id  path  string  true  "Image ID"
+// @Param        id         path   string  true  "Blob ID"
+// @Param        variant    query  string  false  "Derivative the URL was signed for"
+// @Param        expires    query  int     true  "Expiry as a Unix timestamp"
+// @Param        signature  query  string  true  "URL signature"
 // @Success      200  {file}  file
+// @Success      206  {file}  file
+// @Success      304  "Not Modified"
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
 // @Failure      404  {object}  map[string]string
+// @Failure      416  "Range Not Satisfiable"
 // @Failure      500  {object}  map[string]string
-// @Router       /images/blob/{id} [get]
-func (h *ImageHandler) GetBlobFromID(c *gin.Context) {
-	imageID := c.Param("id")
-	objectName := fmt.Sprintf("%s.png", imageID)
-	obj, err := h.MinioClient.GetObject(
-		c.Request.Context(),
-		"cc-images",
-		objectName,
-		minio.GetObjectOptions{},
-	)
+// @Router       /api/v1/blobs/{id} [get]
+// @Router       /api/v1/blobs/{id} [head]
+func (h *ImageHandler) GetSignedBlob(c *gin.Context) {
+	blobID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get image"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image ID format"})
 		return
 	}
 
-	stat, err := obj.Stat()
+	obj, info, err := h.imageService.OpenSignedBlob(c.Request.Context(), blobID, c.Query("variant"), c.Query("expires"), c.Query("signature"))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
+		sendBlobError(c, err)
 		return
 	}
+	defer obj.Close()
 
-	c.Header("Content-Type", stat.ContentType)
-	c.Header("Content-Length", fmt.Sprintf("%d", stat.Size))
-	io.Copy(c.Writer, obj)
+	// The signature is part of the URL, so any cache may keep the response,
+	// but not past the point the URL stops working
+	expires, _ := strconv.ParseInt(c.Query("expires"), 10, 64)
+	maxAge := max(expires-utils.GetCurrentTS().Unix(), 0)
+	serveBlob(c, obj, info, fmt.Sprintf("public, max-age=%d, immutable", min(maxAge, blobMaxAge)))
 }
 
 // GetAllImages godoc
@@ -153,15 +263,21 @@ func (h *ImageHandler) GetBlobFromID(c *gin.Context) {
 // @Description  Lists all images, optionally filtered by user_id, with pagination
 // @Tags         images
 // @Produce      json
-// @Param        user_id  query  string  false  "User ID"
-// @Param        limit    query  int     false  "Limit"
-// @Param        offset   query  int     false  "Offset"
+// @Param        user_id         query  string  false  "User ID"
+// @Param        digit           query  int     false  "Only images where this digit (0-9) was detected"
+// @Param        min_confidence  query  number  false  "Only images with a detected digit at least this confident (0-1)"
+// @Param        limit           query  int     false  "Limit"
+// @Param        offset          query  int     false  "Offset"
 // @Success      200  {object}  map[string]interface{}
 // @Failure      400  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
 // @Router       /images [get]
 func (h *ImageHandler) GetAllImages(c *gin.Context) {
-	// Parse query parameters
+	viewer, ok := h.imageViewer(c)
+	if !ok {
+		return
+	}
+
 	var userID *uuid.UUID
 	if userIDStr := c.Query("user_id"); userIDStr != "" {
 		parsedUserID, err := uuid.Parse(userIDStr)
@@ -172,48 +288,32 @@ func (h *ImageHandler) GetAllImages(c *gin.Context) {
 		userID = &parsedUserID
 	}
 
-	limit := 10
-	if limitStr := c.Query("limit"); limitStr != "" {
-		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
-			if parsedLimit > 100 {
-				parsedLimit = 100
-			}
-			limit = parsedLimit
-		}
-	}
-
-	offset := 0
-	if offsetStr := c.Query("offset"); offsetStr != "" {
-		if parsedOffset, err := strconv.Atoi(offsetStr); err == nil && parsedOffset >= 0 {
-			offset = parsedOffset
-		}
-	}
-
-	images, total, err := h.imageService.GetAllImages(userID, limit, offset)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	filter, ok := imageFilterParams(c)
+	if !ok {
 		return
 	}
+	filter.UserID = userID
 
-	c.JSON(http.StatusOK, gin.H{
-		"data":   images,
-		"total":  total,
-		"limit":  limit,
-		"offset": offset,
-	})
+	h.listImages(c, viewer, filter)
 }
 
 // GetImageByID godoc
 // @Summary      Get image by UUID
-// @Description  Returns the image metadata for the given image ID
+// @Description  Returns the image metadata for the given image ID, with the inference and its base64 class map
 // @Tags         images
 // @Produce      json
 // @Param        id  path  string  true  "Image ID"
 // @Success      200  {object}  object
 // @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
 // @Failure      404  {object}  map[string]string
 // @Router       /images/{id} [get]
 func (h *ImageHandler) GetImageByID(c *gin.Context) {
+	viewer, ok := h.imageViewer(c)
+	if !ok {
+		return
+	}
+
 	imageIDStr := c.Param("id")
 	imageID, err := uuid.Parse(imageIDStr)
 	if err != nil {
@@ -221,7 +321,7 @@ func (h *ImageHandler) GetImageByID(c *gin.Context) {
 		return
 	}
 
-	image, err := h.imageService.GetImageByID(imageID)
+	image, err := h.imageService.GetImageByID(viewer, imageID)
 	if err != nil {
 		if err.Error() == "image not found" {
 			c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
@@ -242,9 +342,15 @@ func (h *ImageHandler) GetImageByID(c *gin.Context) {
 // @Param        sent_image_id  path  string  true  "Sent Image ID"
 // @Success      200  {object}  object
 // @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
 // @Failure      404  {object}  map[string]string
 // @Router       /images/sent/{sent_image_id} [get]
 func (h *ImageHandler) GetImageBySentID(c *gin.Context) {
+	viewer, ok := h.imageViewer(c)
+	if !ok {
+		return
+	}
+
 	sentImageIDStr := c.Param("sent_image_id")
 	sentImageID, err := uuid.Parse(sentImageIDStr)
 	if err != nil {
@@ -252,7 +358,7 @@ func (h *ImageHandler) GetImageBySentID(c *gin.Context) {
 		return
 	}
 
-	image, err := h.imageService.GetImageBySentID(sentImageID)
+	image, err := h.imageService.GetImageBySentID(viewer, sentImageID)
 	if err != nil {
 		if err.Error() == "image not found" {
 			c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
@@ -273,9 +379,15 @@ func (h *ImageHandler) GetImageBySentID(c *gin.Context) {
 // @Param        received_image_id  path  string  true  "Received Image ID"
 // @Success      200  {object}  object
 // @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
 // @Failure      404  {object}  map[string]string
 // @Router       /images/received/{received_image_id} [get]
 func (h *ImageHandler) GetImageByReceivedID(c *gin.Context) {
+	viewer, ok := h.imageViewer(c)
+	if !ok {
+		return
+	}
+
 	receivedImageIDStr := c.Param("received_image_id")
 	receivedImageID, err := uuid.Parse(receivedImageIDStr)
 	if err != nil {
@@ -283,7 +395,7 @@ func (h *ImageHandler) GetImageByReceivedID(c *gin.Context) {
 		return
 	}
 
-	image, err := h.imageService.GetImageByReceivedID(receivedImageID)
+	image, err := h.imageService.GetImageByReceivedID(viewer, receivedImageID)
 	if err != nil {
 		if err.Error() == "image not found" {
 			c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
@@ -301,65 +413,134 @@ func (h *ImageHandler) GetImageByReceivedID(c *gin.Context) {
 // @Description  Returns paginated images for the current user
 // @Tags         images
 // @Produce      json
-// @Param        limit   query  int  false  "Limit"
-// @Param        offset  query  int  false  "Offset"
+// @Param        digit           query  int     false  "Only images where this digit (0-9) was detected"
+// @Param        min_confidence  query  number  false  "Only images with a detected digit at least this confident (0-1)"
+// @Param        limit           query  int     false  "Limit"
+// @Param        offset          query  int     false  "Offset"
 // @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]string
 // @Failure      401  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
 // @Router       /images/user [get]
 func (h *ImageHandler) GetUserImages(c *gin.Context) {
-	userIDStr, exists := c.Get("authenticated_userid")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "No token provided"})
+	viewer, ok := h.imageViewer(c)
+	if !ok {
 		return
 	}
 
-	userIDParsed, ok := userIDStr.(string)
+	filter, ok := imageFilterParams(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("User id found: %s", userIDParsed)})
 		return
 	}
+	filter.UserID = &viewer.UserID
 
-	userID, err := uuid.Parse(userIDParsed)
+	h.listImages(c, viewer, filter)
+}
+
+// ListUserImages godoc
+// @Summary      Get all images of a user
+// @Description  Returns paginated images of the given user. Callers without images:read_all only see their own, other users answer 404.
+// @Tags         images
+// @Produce      json
+// @Param        user_id         path   string  true   "User ID"
+// @Param        digit           query  int     false  "Only images where this digit (0-9) was detected"
+// @Param        min_confidence  query  number  false  "Only images with a detected digit at least this confident (0-1)"
+// @Param        limit           query  int     false  "Limit"
+// @Param        offset          query  int     false  "Offset"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /users/{user_id}/images [get]
+func (h *ImageHandler) ListUserImages(c *gin.Context) {
+	viewer, ok := h.imageViewer(c)
+	if !ok {
+		return
+	}
+
+	userID, err := uuid.Parse(c.Param("user_id"))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Couldn't parse uuid"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id format"})
+		return
 	}
 
-	limit := 10
-	if limitStr := c.Query("limit"); limitStr != "" {
-		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
-			if parsedLimit > 100 {
-				parsedLimit = 100
-			}
-			limit = parsedLimit
-		}
+	filter, ok := imageFilterParams(c)
+	if !ok {
+		return
 	}
+	filter.UserID = &userID
+
+	h.listImages(c, viewer, filter)
+}
 
-	offset := 0
-	if offsetStr := c.Query("offset"); offsetStr != "" {
-		if parsedOffset, err := strconv.Atoi(offsetStr); err == nil && parsedOffset >= 0 {
-			offset = parsedOffset
+func (h *ImageHandler) listImages(c *gin.Context, viewer *services.ImageViewer, filter *services.ImageFilter) {
+	images, total, err := h.imageService.GetAllImages(viewer, filter)
+	if err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"data":   images,
+		"total":  total,
+		"limit":  filter.Limit,
+		"offset": filter.Offset,
+	}
+	if filter.UserID != nil {
+		response["user_id"] = filter.UserID.String()
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// imageViewer resolves who the request reads images for. It writes the error
+// response itself, so callers only need to return when ok is false.
+func (h *ImageHandler) imageViewer(c *gin.Context) (*services.ImageViewer, bool) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return nil, false
 	}
 
-	images, total, err := h.imageService.GetAllImages(&userID, limit, offset)
+	viewer, err := h.imageService.Viewer(userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return nil, false
 	}
+	return viewer, true
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"data":    images,
-		"total":   total,
-		"limit":   limit,
-		"offset":  offset,
-		"user_id": userIDParsed,
-	})
+// sendBlobError maps the errors of opening a blob, a derivative or a URL to
+// one
+func sendBlobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, storage.ErrInvalidSignature), errors.Is(err, storage.ErrURLExpired):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case err.Error() == "kind must be sent or received", err.Error() == "unknown variant":
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err.Error() == "image not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// serveBlob answers a GET or HEAD for a blob with http.ServeContent, which
+// handles If-None-Match, If-Modified-Since, If-Range and Range against the
+// ETag and Last-Modified of the stored object
+func serveBlob(c *gin.Context, obj storage.Object, info *storage.ObjectInfo, cacheControl string) {
+	c.Header("Content-Type", info.ContentType)
+	c.Header("ETag", `"`+strings.Trim(info.ETag, `"`)+`"`)
+	c.Header("Cache-Control", cacheControl)
+	http.ServeContent(c.Writer, c.Request, "", info.LastModified, obj)
 }
 
 // DeleteImage godoc
 // @Summary      Delete an image
-// @Description  Deletes image by ID for the authenticated user
+// @Description  Moves the image to the trash, it can be restored until it is purged
 // @Tags         images
 // @Param        id  path  string  true  "Image ID"
 // @Success      204  "No Content"
@@ -389,7 +570,7 @@ func (h *ImageHandler) DeleteImage(c *gin.Context) {
 		return
 	}
 
-	err = h.imageService.DeleteImage(imageID, userID)
+	err = h.imageService.DeleteImage(c.Request.Context(), imageID, userID)
 	if err != nil {
 		if err.Error() == "image not found" {
 			c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
@@ -401,3 +582,158 @@ func (h *ImageHandler) DeleteImage(c *gin.Context) {
 
 	c.JSON(http.StatusNoContent, nil)
 }
+
+// ListTrash godoc
+// @Summary      List deleted images
+// @Description  Returns the authenticated user's images in the trash, with the date each one will be purged
+// @Tags         images
+// @Produce      json
+// @Param        limit   query  int  false  "Limit"
+// @Param        offset  query  int  false  "Offset"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      401  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /images/trash [get]
+func (h *ImageHandler) ListTrash(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	limit, offset := paginationParams(c)
+	images, total, err := h.imageService.ListTrash(userID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":   images,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// RestoreImage godoc
+// @Summary      Restore a deleted image
+// @Description  Takes an image of the authenticated user out of the trash
+// @Tags         images
+// @Produce      json
+// @Param        id  path  string  true  "Image ID"
+// @Success      200  {object}  services.ImageResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /images/{id}/restore [post]
+func (h *ImageHandler) RestoreImage(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	imageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image ID format"})
+		return
+	}
+
+	image, err := h.imageService.RestoreImage(imageID, userID)
+	if err != nil {
+		if err.Error() == "image not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, image)
+}
+
+// readUploadedImage opens a form file and runs it through normalize. It
+// writes the error response itself, so callers only need to return when ok
+// is false.
+func readUploadedImage(c *gin.Context, field string, normalize func(string, io.Reader) ([]byte, error)) ([]byte, bool) {
+	header, err := c.FormFile(field)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "upload too large"})
+			return nil, false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s is required", field)})
+		return nil, false
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s could not be read", field)})
+		return nil, false
+	}
+	defer file.Close()
+
+	data, err := normalize(field, file)
+	if err != nil {
+		if !sendImageValidationError(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process image"})
+		}
+		return nil, false
+	}
+	return data, true
+}
+
+// sendImageValidationError answers with the reason an image was refused when
+// err is an image validation error, and reports whether it did.
+func sendImageValidationError(c *gin.Context, err error) bool {
+	var validationErr *services.ImageValidationError
+	if !errors.As(err, &validationErr) {
+		return false
+	}
+
+	status := http.StatusBadRequest
+	switch validationErr.Code {
+	case services.ImageTooLarge:
+		status = http.StatusRequestEntityTooLarge
+	case services.ImageNotPNG:
+		status = http.StatusUnsupportedMediaType
+	case services.ImageInvalidDimensions:
+		status = http.StatusUnprocessableEntity
+	}
+
+	c.JSON(status, gin.H{
+		"error":  validationErr.Message,
+		"code":   validationErr.Code,
+		"field":  validationErr.Field,
+		"params": validationErr.Params,
+	})
+	return true
+}
+
+// imageFilterParams reads the pagination and inference filters of the image
+// listings, answering 400 and returning false when a filter is invalid
+func imageFilterParams(c *gin.Context) (*services.ImageFilter, bool) {
+	limit, offset := paginationParams(c)
+	filter := &services.ImageFilter{Limit: limit, Offset: offset}
+
+	if digitStr := c.Query("digit"); digitStr != "" {
+		digit, err := strconv.Atoi(digitStr)
+		if err != nil || digit < 0 || digit > 9 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "digit must be between 0 and 9"})
+			return nil, false
+		}
+		filter.Digit = &digit
+	}
+
+	if confidenceStr := c.Query("min_confidence"); confidenceStr != "" {
+		confidence, err := strconv.ParseFloat(confidenceStr, 64)
+		if err != nil || confidence < 0 || confidence > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_confidence must be between 0 and 1"})
+			return nil, false
+		}
+		filter.MinConfidence = &confidence
+	}
+
+	return filter, true
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"auth-service/internal/config"
+	"auth-service/internal/models"
+	"auth-service/internal/services"
+	"auth-service/internal/storage"
+	"auth-service/internal/testdb"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// TestImageReadsAreScopedToTheOwner requests every image read route as the
+// owner, another user and an admin, and for an image in the trash
+func TestImageReadsAreScopedToTheOwner(t *testing.T) {
+	db := testdb.Open(t)
+	cfg := &config.Config{PublicURL: "http://api.test", Storage: config.StorageConfig{SigningKey: "test", URLExpiry: 300}}
+	rbac := services.NewRBACService(db)
+	imageService := services.NewImageService(db, cfg, storage.NewMemoryStore(), rbac)
+	handler := NewImageHandler(imageService)
+
+	router := gin.New()
+	router.Use(authenticateAs())
+	router.GET("/api/v1/images/blob/:id", handler.GetBlobFromID)
+	router.HEAD("/api/v1/images/blob/:id", handler.GetBlobFromID)
+	router.GET("/api/v1/images/:id", handler.GetImageByID)
+	router.GET("/api/v1/images/:id/blob", handler.GetImageBlob)
+	router.GET("/api/v1/images/:id/url", handler.GetBlobURL)
+	router.GET("/api/v1/users/:user_id/images", handler.ListUserImages)
+
+	owner := newTestUser(t, db, models.RoleUser)
+	other := newTestUser(t, db, models.RoleUser)
+	admin := newTestUser(t, db, models.RoleAdmin)
+
+	create := func() *services.ImageResponse {
+		image, err := imageService.CreateImage(context.Background(), owner, &services.CreateImageRequest{
+			Drawing:      testPNG(t, 112, 112),
+			Segmentation: testPNG(t, 4, 4),
+			Inference:    &models.Inference{ModelVersion: "test", Width: 4, Height: 4},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return image
+	}
+	visible := create()
+	trashed := create()
+	if err := imageService.DeleteImage(context.Background(), trashed.ID, owner); err != nil {
+		t.Fatal(err)
+	}
+
+	routes := func(image *services.ImageResponse) map[string]string {
+		return map[string]string{
+			"GET /images/blob/:id":       "/api/v1/images/blob/" + image.SentImageID.String(),
+			"HEAD /images/blob/:id":      "/api/v1/images/blob/" + image.ReceivedImageID.String(),
+			"GET /images/:id":            "/api/v1/images/" + image.ID.String(),
+			"GET /images/:id/blob":       "/api/v1/images/" + image.ID.String() + "/blob?kind=received",
+			"GET /images/:id/url":        "/api/v1/images/" + image.ID.String() + "/url",
+			"GET /users/:user_id/images": "/api/v1/users/" + owner.String() + "/images",
+		}
+	}
+
+	// The listing answers 404 for another user's images and leaves trashed
+	// images out instead
+	cases := []struct {
+		name       string
+		viewer     uuid.UUID
+		image      *services.ImageResponse
+		want       int
+		wantList   int
+		wantListed bool
+	}{
+		{"owner", owner, visible, http.StatusOK, http.StatusOK, true},
+		{"other user", other, visible, http.StatusNotFound, http.StatusNotFound, false},
+		{"admin", admin, visible, http.StatusOK, http.StatusOK, true},
+		{"trashed", owner, trashed, http.StatusNotFound, http.StatusOK, false},
+		{"trashed as admin", admin, trashed, http.StatusNotFound, http.StatusOK, false},
+	}
+
+	for _, tc := range cases {
+		for route, target := range routes(tc.image) {
+			method := http.MethodGet
+			if strings.HasPrefix(route, "HEAD") {
+				method = http.MethodHead
+			}
+			req := httptest.NewRequest(method, target, nil)
+			req.Header.Set("X-Test-User", tc.viewer.String())
+			resp := serve(router, req)
+
+			want := tc.want
+			if route == "GET /users/:user_id/images" {
+				want = tc.wantList
+			}
+			if resp.Code != want {
+				t.Errorf("%s, %s: got %d, want %d (%s)", tc.name, route, resp.Code, want, resp.Body)
+				continue
+			}
+			if route == "GET /users/:user_id/images" && resp.Code == http.StatusOK {
+				if listed := listsImage(t, resp, tc.image.ID); listed != tc.wantListed {
+					t.Errorf("%s, %s: image listed = %v, want %v", tc.name, route, listed, tc.wantListed)
+				}
+			}
+		}
+	}
+}
+
+func listsImage(t *testing.T, resp *httptest.ResponseRecorder, imageID uuid.UUID) bool {
+	t.Helper()
+
+	var body struct {
+		Data []struct {
+			ID uuid.UUID `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range body.Data {
+		if entry.ID == imageID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"auth-service/internal/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type InferenceHandler struct {
+	inferenceService *services.InferenceService
+}
+
+func NewInferenceHandler(inferenceService *services.InferenceService) *InferenceHandler {
+	return &InferenceHandler{
+		inferenceService: inferenceService,
+	}
+}
+
+// CreateInference godoc
+// @Summary      Run the model on a drawing
+// @Description  Sends a 112x112 PNG drawing to the segmentation model, stores the drawing and the segmentation and records the image for the user
+// @Tags         images
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        drawing  formData  file  true  "112x112 PNG drawing"
+// @Success      201  {object}  services.InferenceResponse
+// @Failure      400  {object}  services.ImageValidationError
+// @Failure      401  {object}  map[string]string
+// @Failure      413  {object}  services.ImageValidationError
+// @Failure      415  {object}  services.ImageValidationError
+// @Failure      422  {object}  map[string]string
+// @Failure      502  {object}  map[string]string
+// @Failure      503  {object}  map[string]string
+// @Router       /inferences [post]
+func (h *InferenceHandler) CreateInference(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("authenticated_userid"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	// Bad uploads are answered here, CreateInference checks the drawing
+	// again for callers that skip the handler
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImageUploadBytes)
+	drawing, ok := readUploadedImage(c, "drawing", services.NormalizeDrawing)
+	if !ok {
+		return
+	}
+
+	inference, err := h.inferenceService.CreateInference(c.Request.Context(), userID, drawing)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, inference)
+}
+
+func (h *InferenceHandler) sendError(c *gin.Context, err error) {
+	if sendImageValidationError(c, err) {
+		return
+	}
+
+	switch {
+	case errors.Is(err, services.ErrInferenceUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": services.ErrInferenceUnavailable.Error()})
+	case errors.Is(err, services.ErrInferenceRejected):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInferenceBadResponse):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	case err.Error() == "user not found":
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
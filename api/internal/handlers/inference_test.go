@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"auth-service/internal/config"
+	"auth-service/internal/models"
+	"auth-service/internal/services"
+	"auth-service/internal/storage"
+	"auth-service/internal/testdb"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCreateInferenceMapsModelAnswers(t *testing.T) {
+	cases := []struct {
+		model int
+		want  int
+	}{
+		{http.StatusOK, http.StatusCreated},
+		{http.StatusBadRequest, http.StatusUnprocessableEntity},
+		{http.StatusUnprocessableEntity, http.StatusUnprocessableEntity},
+		{http.StatusInternalServerError, http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range cases {
+		model := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tc.model != http.StatusOK {
+				http.Error(w, http.StatusText(tc.model), tc.model)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"segmentation_base64": base64.StdEncoding.EncodeToString(testPNG(t, 4, 4)),
+				"class_map_base64":    base64.StdEncoding.EncodeToString(make([]byte, 16)),
+				"width":               4,
+				"height":              4,
+			})
+		}))
+
+		db := testdb.Open(t)
+		imageService := services.NewImageService(db, &config.Config{}, storage.NewMemoryStore(), services.NewRBACService(db))
+		client := services.NewHTTPInferenceClient(config.InferenceConfig{URL: model.URL, Timeout: 5, MaxRetries: 1, RetryBackoff: 1})
+		handler := NewInferenceHandler(services.NewInferenceService(imageService, client))
+
+		router := gin.New()
+		router.POST("/api/v1/inferences", authenticateAs(), handler.CreateInference)
+
+		userID := newTestUser(t, db)
+		resp := serve(router, multipartRequest(t, http.MethodPost, "/api/v1/inferences", userID, map[string][]byte{
+			"drawing": testPNG(t, 112, 112),
+		}))
+		if resp.Code != tc.want {
+			t.Errorf("model answered %d: got %d, want %d (%s)", tc.model, resp.Code, tc.want, resp.Body)
+		}
+
+		var stored int64
+		db.Model(&models.Image{}).Count(&stored)
+		if (tc.want == http.StatusCreated) != (stored == 1) {
+			t.Errorf("model answered %d: %d images stored", tc.model, stored)
+		}
+		model.Close()
+	}
+}
+
+func TestCreateImageNeedsImagesWrite(t *testing.T) {
+	db := testdb.Open(t)
+	rbac := services.NewRBACService(db)
+	handler := NewImageHandler(services.NewImageService(db, &config.Config{}, storage.NewMemoryStore(), rbac))
+
+	router := gin.New()
+	router.POST("/api/v1/images", authenticateAs(), NewRBACHandler(rbac).RequirePermission(models.PermissionImagesWrite), handler.CreateImage)
+
+	files := map[string][]byte{
+		"original_image":  testPNG(t, 112, 112),
+		"inference_image": testPNG(t, 112, 112),
+	}
+	for _, tc := range []struct {
+		role string
+		want int
+	}{
+		{models.RoleUser, http.StatusForbidden},
+		{models.RoleOperator, http.StatusForbidden},
+		{models.RoleAdmin, http.StatusCreated},
+	} {
+		userID := newTestUser(t, db, tc.role)
+		resp := serve(router, multipartRequest(t, http.MethodPost, "/api/v1/images", userID, files))
+		if resp.Code != tc.want {
+			t.Errorf("%s: got %d, want %d (%s)", tc.role, resp.Code, tc.want, resp.Body)
+		}
+	}
+}
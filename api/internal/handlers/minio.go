@@ -2,12 +2,13 @@ package handlers
 
 import (
 	"auth-service/internal/services"
+	"auth-service/internal/storage"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/minio/minio-go/v7"
 )
 
 type MinioHandler struct {
@@ -21,8 +22,8 @@ func NewMinioHandler(minioService *services.MinioService) *MinioHandler {
 }
 
 // StoreImage godoc
-// @Summary      Store image in MinIO
-// @Description  Uploads an image for a given ID to MinIO storage
+// @Summary      Store image in blob storage
+// @Description  Uploads an image for a given ID to the configured blob storage
 // @Tags         minio
 // @Accept       multipart/form-data
 // @Produce      json
@@ -50,16 +51,7 @@ func (h *MinioHandler) StoreImage(c *gin.Context) {
 
 	objectName := fmt.Sprintf("%s-%s", id, header.Filename)
 
-	info, err := h.MinioService.MinioClient.PutObject(
-		c.Request.Context(),
-		"CC-Images",
-		objectName,
-		src,
-		header.Size,
-		minio.PutObjectOptions{
-			ContentType: header.Header.Get("Content-Type"),
-		},
-	)
+	err = h.MinioService.StoreImage(c.Request.Context(), objectName, src, header.Size, header.Header.Get("Content-Type"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "upload failed", "details": err.Error()})
 		return
@@ -67,14 +59,14 @@ func (h *MinioHandler) StoreImage(c *gin.Context) {
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message":     "upload successful",
-		"object_name": info.Key,
-		"size":        info.Size,
+		"object_name": objectName,
+		"size":        header.Size,
 	})
 }
 
 // GetImageByID godoc
-// @Summary      Get image from MinIO by ID
-// @Description  Fetches an image from MinIO storage by object ID
+// @Summary      Get image from blob storage by ID
+// @Description  Fetches an image from the configured blob storage by object ID
 // @Tags         minio
 // @Produce      image/png
 // @Param        id  path  string  true  "Object ID"
@@ -84,21 +76,16 @@ func (h *MinioHandler) StoreImage(c *gin.Context) {
 // @Router       /minio/images/{id} [get]
 func (h *MinioHandler) GetImageByID(c *gin.Context) {
 	id := c.Param("id")
-	object, err := h.MinioService.MinioClient.GetObject(
-		c.Request.Context(),
-		"CC-Images",
-		id,
-		minio.GetObjectOptions{},
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get image"})
+	object, stat, err := h.MinioService.GetImage(c.Request.Context(), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
 		return
 	}
-	stat, err := object.Stat()
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get image"})
 		return
 	}
+	defer object.Close()
 
 	c.Header("Content-Type", stat.ContentType)
 	c.Header("Content-Length", fmt.Sprintf("%d", stat.Size))
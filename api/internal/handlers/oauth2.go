@@ -3,6 +3,8 @@ package handlers
 import (
 	"fmt"
 	"net/http"
+	"net/url"
+	"slices"
 	"strings"
 	"time"
 
@@ -17,16 +19,18 @@ import (
 )
 
 type OAuth2Handler struct {
-	oauth2Service *services.OAuth2Service
-	db            *gorm.DB
-	config        *config.Config
+	oauth2Service  *services.OAuth2Service
+	sessionService *services.SessionService
+	db             *gorm.DB
+	config         *config.Config
 }
 
-func NewOAuth2Handler(oauth2Service *services.OAuth2Service, db *gorm.DB, cfg *config.Config) *OAuth2Handler {
+func NewOAuth2Handler(oauth2Service *services.OAuth2Service, sessionService *services.SessionService, db *gorm.DB, cfg *config.Config) *OAuth2Handler {
 	return &OAuth2Handler{
-		oauth2Service: oauth2Service,
-		db:            db,
-		config:        cfg,
+		oauth2Service:  oauth2Service,
+		sessionService: sessionService,
+		db:             db,
+		config:         cfg,
 	}
 }
 
@@ -43,7 +47,7 @@ func NewOAuth2Handler(oauth2Service *services.OAuth2Service, db *gorm.DB, cfg *c
 // @Router       /oauth2/introspect [post]
 func (h *OAuth2Handler) IntrospectToken(c *gin.Context) {
 	var req struct {
-		Token string `json:"token" binding: "required"`
+		Token string `json:"token" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -104,7 +108,7 @@ func (h *OAuth2Handler) IntrospectToken(c *gin.Context) {
 
 // OAuth2Authorize godoc
 // @Summary      OAuth2 authorization endpoint
-// @Description  Handles OAuth2 authorization requests
+// @Description  Handles OAuth2 authorization requests. Requests without a Kong provision key are authenticated with the login session cookie, redirecting to the login page when there is none.
 // @Tags         oauth2
 // @Accept       application/x-www-form-urlencoded
 // @Produce      json
@@ -113,32 +117,114 @@ func (h *OAuth2Handler) IntrospectToken(c *gin.Context) {
 // @Param        redirect_uri   formData  string  true  "Redirect URI"
 // @Param        scope          formData  string  false "Scope"
 // @Param        state          formData  string  false "State"
+// @Param        prompt         formData  string  false "none or login"
+// @Param        max_age        formData  int     false "Maximum seconds since the user last entered credentials"
 // @Success      302  {string}  string  "Redirects to client"
-// @Failure      400  {object}  map[string]string
+// @Failure      400  {object}  map[string]string  "Unknown client or unregistered redirect URI, nothing is redirected"
 // @Failure      401  {object}  map[string]string
 // @Router       /oauth2/authorize [get]
 func (h *OAuth2Handler) OAuth2Authorize(c *gin.Context) {
 	var req services.AuthorizeRequest
 
+	// Nothing is redirected until the redirect_uri is known to belong to the
+	// client, otherwise this endpoint would redirect anywhere
 	if err := c.ShouldBind(&req); err != nil {
-		h.sendErrorRedirect(c, "invalid_request", "Invalid request parameters", req.RedirectURI, req.State)
+		h.sendErrorRedirect(c, "invalid_request", "Invalid request parameters", "", req.State)
 		return
 	}
 
 	if req.ResponseType == "" || req.ClientID == "" {
-		h.sendErrorRedirect(c, "invalid_request", "Missing required parameters", req.RedirectURI, req.State)
+		h.sendErrorRedirect(c, "invalid_request", "Missing required parameters", "", req.State)
+		return
+	}
+
+	if err := h.oauth2Service.CheckRedirectURI(req.ClientID, req.RedirectURI); err != nil {
+		h.sendErrorRedirect(c, authorizeErrorCode(err), err.Error(), "", req.State)
+		return
+	}
+
+	if req.ProvisionKey == "" {
+		h.authorizeWithSession(c, &req)
 		return
 	}
 
 	response, err := h.oauth2Service.Authorize(&req)
 	if err != nil {
-		h.sendErrorRedirect(c, "invalid_client", err.Error(), req.RedirectURI, req.State)
+		h.sendErrorRedirect(c, authorizeErrorCode(err), err.Error(), req.RedirectURI, req.State)
+		return
+	}
+
+	c.Redirect(http.StatusFound, response.RedirectURI)
+}
+
+// authorizeWithSession authorizes the user behind the SSO cookie, sending them
+// to the login page first when there is no session or a fresh login is
+// required by prompt=login or max_age.
+func (h *OAuth2Handler) authorizeWithSession(c *gin.Context, req *services.AuthorizeRequest) {
+	prompts := strings.Fields(req.Prompt)
+
+	var session *models.Session
+	if raw, err := c.Cookie(h.config.Session.CookieName); err == nil {
+		session, _ = h.sessionService.ResolveSession(raw)
+	}
+
+	needsLogin := session == nil || slices.Contains(prompts, "login")
+	if session != nil && req.MaxAge != nil {
+		authAge := utils.GetCurrentTS().Sub(session.AuthTime)
+		needsLogin = needsLogin || authAge > time.Duration(*req.MaxAge)*time.Second
+	}
+
+	if needsLogin {
+		if slices.Contains(prompts, "none") {
+			h.sendErrorRedirect(c, "login_required", "User must log in", req.RedirectURI, req.State)
+			return
+		}
+
+		c.Redirect(http.StatusFound, publicURL(h.config, "/auth/login?return_to="+url.QueryEscape(authorizeReturnURL(req))))
+		return
+	}
+
+	response, err := h.oauth2Service.AuthorizeForUser(req, session.UserID)
+	if err != nil {
+		h.sendErrorRedirect(c, authorizeErrorCode(err), err.Error(), req.RedirectURI, req.State)
 		return
 	}
 
 	c.Redirect(http.StatusFound, response.RedirectURI)
 }
 
+// authorizeReturnURL rebuilds the authorization request to resume after login.
+// prompt=login and max_age are dropped, the login they asked for has just
+// happened and keeping them would send the user back to the login page.
+func authorizeReturnURL(req *services.AuthorizeRequest) string {
+	query := url.Values{}
+	query.Set("response_type", req.ResponseType)
+	query.Set("client_id", req.ClientID)
+	for key, value := range map[string]string{
+		"redirect_uri":          req.RedirectURI,
+		"scope":                 req.Scope,
+		"state":                 req.State,
+		"code_challenge":        req.CodeChallenge,
+		"code_challenge_method": req.CodeChallengeMethod,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	var prompts []string
+	for _, prompt := range strings.Fields(req.Prompt) {
+		if prompt != "login" {
+			prompts = append(prompts, prompt)
+		}
+	}
+	if len(prompts) > 0 {
+		query.Set("prompt", strings.Join(prompts, " "))
+	}
+
+	return "/oauth2/authorize?" + query.Encode()
+}
+
 // OAuth2Token godoc
 // @Summary      OAuth2 token endpoint
 // @Description  Issues OAuth2 tokens (access/refresh) for a client
@@ -150,6 +236,7 @@ func (h *OAuth2Handler) OAuth2Authorize(c *gin.Context) {
 // @Param        client_secret  formData  string  false "Client Secret"
 // @Param        code           formData  string  false "Authorization code"
 // @Param        redirect_uri   formData  string  false "Redirect URI"
+// @Param        code_verifier  formData  string  false "PKCE code verifier"
 // @Param        refresh_token  formData  string  false "Refresh token"
 // @Success      200  {object}  map[string]interface{}
 // @Failure      400  {object}  map[string]interface{}
@@ -196,6 +283,8 @@ func (h *OAuth2Handler) OAuth2Token(c *gin.Context) {
 			errorCode = "invalid_grant"
 		case strings.Contains(err.Error(), "unsupported grant"):
 			errorCode = "unsupported_grant_type"
+		case strings.Contains(err.Error(), "not allowed for this client"):
+			errorCode = "unauthorized_client"
 		case strings.Contains(err.Error(), "invalid scope"):
 			errorCode = "invalid_scope"
 		}
@@ -209,7 +298,7 @@ func (h *OAuth2Handler) OAuth2Token(c *gin.Context) {
 
 // ListOAuth2Tokens godoc
 // @Summary      List OAuth2 tokens
-// @Description  Retrieve all OAuth2 tokens, optionally filtered by service_id
+// @Description  Retrieve all OAuth2 tokens, optionally filtered by service_id, with the token values redacted
 // @Tags         oauth2
 // @Produce      json
 // @Param        service_id  query  string  false  "Service ID"
@@ -241,7 +330,7 @@ func (h *OAuth2Handler) OAuth2Tokens(c *gin.Context) {
 
 // GetOAuth2TokenByID godoc
 // @Summary      Get a token by ID
-// @Description  Retrieve a specific OAuth2 token by ID
+// @Description  Retrieve a specific OAuth2 token by ID, with the token values redacted
 // @Tags         oauth2
 // @Produce      json
 // @Param        token_id  path  string  true  "Token ID"
@@ -252,12 +341,12 @@ func (h *OAuth2Handler) OAuth2Tokens(c *gin.Context) {
 
 // UpdateOAuth2TokenByID godoc
 // @Summary      Update a token by ID
-// @Description  Update fields of a specific OAuth2 token by ID
+// @Description  Update the scope or the expirations (seconds from now) of a specific OAuth2 token by ID, other fields cannot be changed
 // @Tags         oauth2
 // @Accept       json
 // @Produce      json
 // @Param        token_id  path  string  true  "Token ID"
-// @Param        updates   body  object  true  "Fields to update (partial allowed)"
+// @Param        updates   body  object  true  "scope, access_token_expiration and refresh_token_expiration, all optional"
 // @Success      200  {object}  models.OAuth2Token
 // @Failure      400  {object}  map[string]string
 // @Failure      404  {object}  map[string]string
@@ -305,6 +394,10 @@ func (h *OAuth2Handler) listTokens(c *gin.Context) {
 		return
 	}
 
+	for i := range tokens {
+		redactToken(&tokens[i])
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"total": len(tokens),
 		"data":  tokens,
@@ -358,16 +451,38 @@ func (h *OAuth2Handler) getToken(c *gin.Context, tokenID string) {
 		return
 	}
 
+	redactToken(&token)
 	c.JSON(http.StatusOK, token)
 }
 
 func (h *OAuth2Handler) updateToken(c *gin.Context, tokenID string) {
-	var updates map[string]interface{}
-	if err := c.ShouldBindJSON(&updates); err != nil {
+	// Only these fields can change, the token values, the user and the
+	// client a token belongs to are fixed when it is issued
+	var req struct {
+		Scope                  *string `json:"scope"`
+		AccessTokenExpiration  *int    `json:"access_token_expiration"`
+		RefreshTokenExpiration *int    `json:"refresh_token_expiration"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
 		return
 	}
 
+	updates := map[string]interface{}{}
+	if req.Scope != nil {
+		updates["scope"] = *req.Scope
+	}
+	if req.AccessTokenExpiration != nil {
+		updates["access_token_expiration"] = utils.GetCurrentTS().Add(time.Duration(*req.AccessTokenExpiration) * time.Second)
+	}
+	if req.RefreshTokenExpiration != nil {
+		updates["refresh_token_expiration"] = utils.GetCurrentTS().Add(time.Duration(*req.RefreshTokenExpiration) * time.Second)
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update"})
+		return
+	}
+
 	var token models.OAuth2Token
 	if err := h.db.Where("id = ?", tokenID).First(&token).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -383,9 +498,17 @@ func (h *OAuth2Handler) updateToken(c *gin.Context, tokenID string) {
 		return
 	}
 
+	redactToken(&token)
 	c.JSON(http.StatusOK, token)
 }
 
+// redactToken hides the token values of a token that is only being shown,
+// anyone able to read them could use the token
+func redactToken(token *models.OAuth2Token) {
+	token.AccessToken = services.RedactToken(token.AccessToken)
+	token.RefreshToken = services.RedactToken(token.RefreshToken)
+}
+
 func (h *OAuth2Handler) deleteToken(c *gin.Context, tokenID string) {
 	result := h.db.Where("id = ?", tokenID).Delete(&models.OAuth2Token{})
 	if result.Error != nil {
@@ -420,6 +543,20 @@ func (h *OAuth2Handler) sendErrorRedirect(c *gin.Context, errorCode, description
 	c.Redirect(http.StatusFound, errorURL)
 }
 
+// authorizeErrorCode maps an authorization error to its RFC 6749 code.
+func authorizeErrorCode(err error) string {
+	switch {
+	case strings.Contains(err.Error(), "not allowed for this client"):
+		return "unauthorized_client"
+	case strings.Contains(err.Error(), "unsupported response type"):
+		return "unsupported_response_type"
+	case strings.Contains(err.Error(), "PKCE"), strings.Contains(err.Error(), "code challenge"), strings.Contains(err.Error(), "redirect URI"):
+		return "invalid_request"
+	default:
+		return "invalid_client"
+	}
+}
+
 func (h *OAuth2Handler) sendTokenError(c *gin.Context, errorCode, description string, status int) {
 	c.JSON(status, gin.H{
 		"error":             errorCode,
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"auth-service/internal/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type RBACHandler struct {
+	rbacService *services.RBACService
+}
+
+func NewRBACHandler(rbacService *services.RBACService) *RBACHandler {
+	return &RBACHandler{
+		rbacService: rbacService,
+	}
+}
+
+// RequirePermission godoc
+// @Summary      Middleware to enforce a permission
+// @Description  Must run after ValidateToken. Aborts with 401 if the token has no user and 403 if none of the user's roles grants the permission.
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+func (h *RBACHandler) RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.GetString("authenticated_userid"))
+		if err != nil || userID == uuid.Nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+			c.Abort()
+			return
+		}
+
+		allowed, err := h.rbacService.HasPermission(userID, permission)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ListRoles godoc
+// @Summary      List roles
+// @Description  Returns every role with its permissions
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Router       /admin/roles [get]
+func (h *RBACHandler) ListRoles(c *gin.Context) {
+	roles, err := h.rbacService.ListRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": len(roles),
+		"data":  roles,
+	})
+}
+
+// GetUserRoles godoc
+// @Summary      Get user roles
+// @Description  Returns the roles assigned to a user
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        user_id  path  string  true  "User ID"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /admin/users/{user_id}/roles [get]
+func (h *RBACHandler) GetUserRoles(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID format"})
+		return
+	}
+
+	user, err := h.rbacService.GetUserWithRoles(userID)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": user.ID,
+		"roles":   user.Roles,
+	})
+}
+
+// AssignUserRole godoc
+// @Summary      Assign a role
+// @Description  Grants a role to a user
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        user_id  path  string               true  "User ID"
+// @Param        role     body  object{role=string}  true  "Role name"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /admin/users/{user_id}/roles [post]
+func (h *RBACHandler) AssignUserRole(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID format"})
+		return
+	}
+
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	user, err := h.rbacService.AssignRole(userID, req.Role)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": user.ID,
+		"roles":   user.Roles,
+	})
+}
+
+// RemoveUserRole godoc
+// @Summary      Remove a role
+// @Description  Revokes a role from a user
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        user_id  path  string  true  "User ID"
+// @Param        role     path  string  true  "Role name"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /admin/users/{user_id}/roles/{role} [delete]
+func (h *RBACHandler) RemoveUserRole(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID format"})
+		return
+	}
+
+	user, err := h.rbacService.RemoveRole(userID, c.Param("role"))
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": user.ID,
+		"roles":   user.Roles,
+	})
+}
+
+func (h *RBACHandler) sendError(c *gin.Context, err error) {
+	switch err.Error() {
+	case "user not found", "role not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,535 @@
+package handlers
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/services"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ScimHandler struct {
+	scimService *services.ScimService
+	config      *config.Config
+}
+
+func NewScimHandler(scimService *services.ScimService, cfg *config.Config) *ScimHandler {
+	return &ScimHandler{
+		scimService: scimService,
+		config:      cfg,
+	}
+}
+
+// RequireScimClient godoc
+// @Summary      Middleware to restrict SCIM to the provisioning client
+// @Description  Must run after ValidateToken. Aborts with 403 unless the token was issued to the client configured in SCIM_CLIENT_ID.
+// @Tags         scim
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Failure      403  {object}  map[string]interface{}
+func (h *ScimHandler) RequireScimClient() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID := c.GetString("client_id")
+		if h.config.Scim.ClientID == "" || clientID != h.config.Scim.ClientID {
+			h.sendScimError(c, http.StatusForbidden, "", "client is not allowed to provision")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ServiceProviderConfig godoc
+// @Summary      SCIM service provider configuration
+// @Description  Describes the SCIM features supported by this server
+// @Tags         scim
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Router       /scim/v2/ServiceProviderConfig [get]
+func (h *ScimHandler) ServiceProviderConfig(c *gin.Context) {
+	h.sendScim(c, http.StatusOK, gin.H{
+		"schemas":          []string{"urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"},
+		"documentationUri": h.config.PublicURL + "/swagger/index.html",
+		"patch":            gin.H{"supported": true},
+		"bulk":             gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":           gin.H{"supported": true, "maxResults": services.ScimMaxCount},
+		"changePassword":   gin.H{"supported": true},
+		"sort":             gin.H{"supported": false},
+		"etag":             gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Access token issued to the provisioning client with the client credentials grant",
+			"primary":     true,
+		}},
+		"meta": gin.H{
+			"resourceType": "ServiceProviderConfig",
+			"location":     h.config.PublicURL + "/scim/v2/ServiceProviderConfig",
+		},
+	})
+}
+
+// ResourceTypes godoc
+// @Summary      SCIM resource types
+// @Description  Lists the resource types exposed through SCIM
+// @Tags         scim
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Router       /scim/v2/ResourceTypes [get]
+func (h *ScimHandler) ResourceTypes(c *gin.Context) {
+	resourceTypes := []gin.H{
+		{
+			"schemas":  []string{"urn:ietf:params:scim:schemas:core:2.0:ResourceType"},
+			"id":       "User",
+			"name":     "User",
+			"endpoint": "/Users",
+			"schema":   services.ScimSchemaUser,
+			"meta":     gin.H{"resourceType": "ResourceType", "location": h.config.PublicURL + "/scim/v2/ResourceTypes/User"},
+		},
+		{
+			"schemas":  []string{"urn:ietf:params:scim:schemas:core:2.0:ResourceType"},
+			"id":       "Group",
+			"name":     "Group",
+			"endpoint": "/Groups",
+			"schema":   services.ScimSchemaGroup,
+			"meta":     gin.H{"resourceType": "ResourceType", "location": h.config.PublicURL + "/scim/v2/ResourceTypes/Group"},
+		},
+	}
+
+	h.sendScim(c, http.StatusOK, &services.ScimListResponse{
+		Schemas:      []string{services.ScimSchemaListResponse},
+		TotalResults: int64(len(resourceTypes)),
+		StartIndex:   1,
+		ItemsPerPage: len(resourceTypes),
+		Resources:    resourceTypes,
+	})
+}
+
+// Schemas godoc
+// @Summary      SCIM schemas
+// @Description  Lists the attributes of the User and Group schemas that are stored
+// @Tags         scim
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Router       /scim/v2/Schemas [get]
+func (h *ScimHandler) Schemas(c *gin.Context) {
+	attribute := func(name, kind string, required bool, uniqueness string) gin.H {
+		return gin.H{
+			"name":        name,
+			"type":        kind,
+			"multiValued": false,
+			"required":    required,
+			"mutability":  "readWrite",
+			"returned":    "default",
+			"uniqueness":  uniqueness,
+		}
+	}
+
+	schemas := []gin.H{
+		{
+			"id":   services.ScimSchemaUser,
+			"name": "User",
+			"attributes": []gin.H{
+				attribute("userName", "string", true, "server"),
+				attribute("displayName", "string", false, "none"),
+				attribute("active", "boolean", false, "none"),
+				attribute("externalId", "string", false, "none"),
+				{"name": "name", "type": "complex", "multiValued": false, "required": false,
+					"subAttributes": []gin.H{attribute("formatted", "string", false, "none"),
+						attribute("givenName", "string", false, "none"),
+						attribute("familyName", "string", false, "none")}},
+				{"name": "emails", "type": "complex", "multiValued": true, "required": true,
+					"subAttributes": []gin.H{attribute("value", "string", true, "server")}},
+				{"name": "password", "type": "string", "multiValued": false, "required": false,
+					"mutability": "writeOnly", "returned": "never"},
+			},
+		},
+		{
+			"id":   services.ScimSchemaGroup,
+			"name": "Group",
+			"attributes": []gin.H{
+				attribute("displayName", "string", true, "server"),
+				attribute("externalId", "string", false, "none"),
+				{"name": "members", "type": "complex", "multiValued": true, "required": false,
+					"subAttributes": []gin.H{attribute("value", "string", true, "none")}},
+			},
+		},
+	}
+
+	h.sendScim(c, http.StatusOK, &services.ScimListResponse{
+		Schemas:      []string{services.ScimSchemaListResponse},
+		TotalResults: int64(len(schemas)),
+		StartIndex:   1,
+		ItemsPerPage: len(schemas),
+		Resources:    schemas,
+	})
+}
+
+// ListUsers godoc
+// @Summary      List SCIM users
+// @Description  Returns a page of users, optionally filtered (e.g. userName eq "jdoe")
+// @Tags         scim
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        filter      query  string  false  "SCIM filter"
+// @Param        startIndex  query  int     false  "1-based index of the first result"  default(1)
+// @Param        count       query  int     false  "Page size"  default(100)
+// @Success      200  {object}  services.ScimListResponse
+// @Failure      400  {object}  map[string]interface{}
+// @Router       /scim/v2/Users [get]
+func (h *ScimHandler) ListUsers(c *gin.Context) {
+	startIndex, count := scimPage(c)
+	list, err := h.scimService.ListUsers(c.Query("filter"), startIndex, count)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	h.sendScim(c, http.StatusOK, list)
+}
+
+// CreateUser godoc
+// @Summary      Create a SCIM user
+// @Description  Provisions an account with the user role
+// @Tags         scim
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        user  body  services.ScimUser  true  "SCIM user"
+// @Success      201  {object}  services.ScimUser
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      409  {object}  map[string]interface{}
+// @Router       /scim/v2/Users [post]
+func (h *ScimHandler) CreateUser(c *gin.Context) {
+	var resource services.ScimUser
+	if err := c.ShouldBindJSON(&resource); err != nil {
+		h.sendScimError(c, http.StatusBadRequest, "invalidSyntax", "invalid request")
+		return
+	}
+
+	user, err := h.scimService.CreateUser(&resource)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.Header("Location", user.Meta.Location)
+	h.sendScim(c, http.StatusCreated, user)
+}
+
+// GetUser godoc
+// @Summary      Get a SCIM user
+// @Tags         scim
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        id  path  string  true  "User ID"
+// @Success      200  {object}  services.ScimUser
+// @Failure      404  {object}  map[string]interface{}
+// @Router       /scim/v2/Users/{id} [get]
+func (h *ScimHandler) GetUser(c *gin.Context) {
+	user, err := h.scimService.GetUser(c.Param("id"))
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	h.sendScim(c, http.StatusOK, user)
+}
+
+// ReplaceUser godoc
+// @Summary      Replace a SCIM user
+// @Description  Overwrites the user; active=false disables the account and revokes its tokens
+// @Tags         scim
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path  string             true  "User ID"
+// @Param        user  body  services.ScimUser  true  "SCIM user"
+// @Success      200  {object}  services.ScimUser
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
+// @Failure      409  {object}  map[string]interface{}
+// @Router       /scim/v2/Users/{id} [put]
+func (h *ScimHandler) ReplaceUser(c *gin.Context) {
+	var resource services.ScimUser
+	if err := c.ShouldBindJSON(&resource); err != nil {
+		h.sendScimError(c, http.StatusBadRequest, "invalidSyntax", "invalid request")
+		return
+	}
+
+	user, err := h.scimService.ReplaceUser(c.Param("id"), &resource)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	h.sendScim(c, http.StatusOK, user)
+}
+
+// PatchUser godoc
+// @Summary      Patch a SCIM user
+// @Description  Applies add, replace and remove operations, e.g. replace active with false to disable the account
+// @Tags         scim
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        id     path  string                     true  "User ID"
+// @Param        patch  body  services.ScimPatchRequest  true  "SCIM PatchOp"
+// @Success      200  {object}  services.ScimUser
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
+// @Router       /scim/v2/Users/{id} [patch]
+func (h *ScimHandler) PatchUser(c *gin.Context) {
+	var req services.ScimPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.sendScimError(c, http.StatusBadRequest, "invalidSyntax", "invalid request")
+		return
+	}
+
+	user, err := h.scimService.PatchUser(c.Param("id"), &req)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	h.sendScim(c, http.StatusOK, user)
+}
+
+// DeleteUser godoc
+// @Summary      Delete a SCIM user
+// @Description  Deactivates the account and schedules its data for deletion after the grace period
+// @Tags         scim
+// @Security     ApiKeyAuth
+// @Param        id  path  string  true  "User ID"
+// @Success      204  "No Content"
+// @Failure      404  {object}  map[string]interface{}
+// @Router       /scim/v2/Users/{id} [delete]
+func (h *ScimHandler) DeleteUser(c *gin.Context) {
+	if err := h.scimService.DeleteUser(c.Param("id")); err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListGroups godoc
+// @Summary      List SCIM groups
+// @Description  Returns a page of groups, optionally filtered (e.g. displayName eq "course-101")
+// @Tags         scim
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        filter      query  string  false  "SCIM filter"
+// @Param        startIndex  query  int     false  "1-based index of the first result"  default(1)
+// @Param        count       query  int     false  "Page size"  default(100)
+// @Success      200  {object}  services.ScimListResponse
+// @Failure      400  {object}  map[string]interface{}
+// @Router       /scim/v2/Groups [get]
+func (h *ScimHandler) ListGroups(c *gin.Context) {
+	startIndex, count := scimPage(c)
+	list, err := h.scimService.ListGroups(c.Query("filter"), startIndex, count)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	h.sendScim(c, http.StatusOK, list)
+}
+
+// CreateGroup godoc
+// @Summary      Create a SCIM group
+// @Tags         scim
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        group  body  services.ScimGroup  true  "SCIM group"
+// @Success      201  {object}  services.ScimGroup
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      409  {object}  map[string]interface{}
+// @Router       /scim/v2/Groups [post]
+func (h *ScimHandler) CreateGroup(c *gin.Context) {
+	var resource services.ScimGroup
+	if err := c.ShouldBindJSON(&resource); err != nil {
+		h.sendScimError(c, http.StatusBadRequest, "invalidSyntax", "invalid request")
+		return
+	}
+
+	group, err := h.scimService.CreateGroup(&resource)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.Header("Location", group.Meta.Location)
+	h.sendScim(c, http.StatusCreated, group)
+}
+
+// GetGroup godoc
+// @Summary      Get a SCIM group
+// @Tags         scim
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        id  path  string  true  "Group ID"
+// @Success      200  {object}  services.ScimGroup
+// @Failure      404  {object}  map[string]interface{}
+// @Router       /scim/v2/Groups/{id} [get]
+func (h *ScimHandler) GetGroup(c *gin.Context) {
+	group, err := h.scimService.GetGroup(c.Param("id"))
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	h.sendScim(c, http.StatusOK, group)
+}
+
+// ReplaceGroup godoc
+// @Summary      Replace a SCIM group
+// @Tags         scim
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        id     path  string              true  "Group ID"
+// @Param        group  body  services.ScimGroup  true  "SCIM group"
+// @Success      200  {object}  services.ScimGroup
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
+// @Router       /scim/v2/Groups/{id} [put]
+func (h *ScimHandler) ReplaceGroup(c *gin.Context) {
+	var resource services.ScimGroup
+	if err := c.ShouldBindJSON(&resource); err != nil {
+		h.sendScimError(c, http.StatusBadRequest, "invalidSyntax", "invalid request")
+		return
+	}
+
+	group, err := h.scimService.ReplaceGroup(c.Param("id"), &resource)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	h.sendScim(c, http.StatusOK, group)
+}
+
+// PatchGroup godoc
+// @Summary      Patch a SCIM group
+// @Description  Applies add, replace and remove operations, including members[value eq "id"] removals
+// @Tags         scim
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        id     path  string                     true  "Group ID"
+// @Param        patch  body  services.ScimPatchRequest  true  "SCIM PatchOp"
+// @Success      200  {object}  services.ScimGroup
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
+// @Router       /scim/v2/Groups/{id} [patch]
+func (h *ScimHandler) PatchGroup(c *gin.Context) {
+	var req services.ScimPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.sendScimError(c, http.StatusBadRequest, "invalidSyntax", "invalid request")
+		return
+	}
+
+	group, err := h.scimService.PatchGroup(c.Param("id"), &req)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	h.sendScim(c, http.StatusOK, group)
+}
+
+// DeleteGroup godoc
+// @Summary      Delete a SCIM group
+// @Description  Removes the group; its members are not affected
+// @Tags         scim
+// @Security     ApiKeyAuth
+// @Param        id  path  string  true  "Group ID"
+// @Success      204  "No Content"
+// @Failure      404  {object}  map[string]interface{}
+// @Router       /scim/v2/Groups/{id} [delete]
+func (h *ScimHandler) DeleteGroup(c *gin.Context) {
+	if err := h.scimService.DeleteGroup(c.Param("id")); err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// scimPage reads startIndex and count, clamping them as RFC 7644 allows
+// instead of rejecting out of range values.
+func scimPage(c *gin.Context) (int, int) {
+	startIndex, err := strconv.Atoi(c.DefaultQuery("startIndex", "1"))
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+
+	count, err := strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(services.ScimDefaultCount)))
+	if err != nil {
+		count = services.ScimDefaultCount
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > services.ScimMaxCount {
+		count = services.ScimMaxCount
+	}
+
+	return startIndex, count
+}
+
+func (h *ScimHandler) sendScim(c *gin.Context, status int, body interface{}) {
+	c.Header("Content-Type", "application/scim+json")
+	c.JSON(status, body)
+}
+
+func (h *ScimHandler) sendScimError(c *gin.Context, status int, scimType, detail string) {
+	body := gin.H{
+		"schemas": []string{services.ScimSchemaError},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	h.sendScim(c, status, body)
+}
+
+func (h *ScimHandler) sendError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidFilter):
+		h.sendScimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	case errors.Is(err, services.ErrInvalidScimValue):
+		h.sendScimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+
+	var policyErr *services.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		messages := make([]string, len(policyErr.Violations))
+		for i, violation := range policyErr.Violations {
+			messages[i] = violation.Message
+		}
+		h.sendScimError(c, http.StatusBadRequest, "invalidValue", strings.Join(messages, "; "))
+		return
+	}
+
+	switch err.Error() {
+	case "user not found", "group not found":
+		h.sendScimError(c, http.StatusNotFound, "", err.Error())
+	case "user already exists", "group already exists":
+		h.sendScimError(c, http.StatusConflict, "uniqueness", err.Error())
+	default:
+		h.sendScimError(c, http.StatusInternalServerError, "", err.Error())
+	}
+}
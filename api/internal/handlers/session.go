@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/services"
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"embed"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed templates/login.html
+var templateFS embed.FS
+
+var loginTemplate = template.Must(template.ParseFS(templateFS, "templates/login.html"))
+
+type SessionHandler struct {
+	sessionService    *services.SessionService
+	federationService *services.FederationService
+	config            *config.Config
+}
+
+func NewSessionHandler(sessionService *services.SessionService, federationService *services.FederationService, cfg *config.Config) *SessionHandler {
+	return &SessionHandler{
+		sessionService:    sessionService,
+		federationService: federationService,
+		config:            cfg,
+	}
+}
+
+// ShowLoginPage godoc
+// @Summary      Show login page
+// @Description  Renders the first-party login form of the authorization server
+// @Tags         auth
+// @Produce      html
+// @Param        return_to  query  string  false  "Relative URL to continue to after login"
+// @Success      200  {string}  string  "HTML page"
+// @Router       /auth/login [get]
+func (h *SessionHandler) ShowLoginPage(c *gin.Context) {
+	h.renderLogin(c, http.StatusOK, safeReturnTo(c.Query("return_to")), "", "")
+}
+
+// Login godoc
+// @Summary      Log in
+// @Description  Checks the credentials, starts a login session and sets the SSO cookie
+// @Tags         auth
+// @Accept       application/x-www-form-urlencoded
+// @Produce      html
+// @Param        email       formData  string  true   "Email"
+// @Param        password    formData  string  true   "Password"
+// @Param        return_to   formData  string  false  "Relative URL to continue to after login"
+// @Param        csrf_token  formData  string  true   "Token of the login page, also sent as a cookie"
+// @Success      302  {string}  string  "Redirects to return_to"
+// @Failure      401  {string}  string  "HTML page with the error"
+// @Failure      403  {string}  string  "HTML page, the form did not come from the login page"
+// @Router       /auth/login [post]
+func (h *SessionHandler) Login(c *gin.Context) {
+	email := c.PostForm("email")
+	returnTo := safeReturnTo(c.PostForm("return_to"))
+
+	// SameSite=Lax still lets another site post this form, which would log
+	// the victim into the attacker's account
+	if !h.validCSRFToken(c) {
+		h.renderLogin(c, http.StatusForbidden, returnTo, email, "The form expired, sign in again")
+		return
+	}
+
+	user, err := h.sessionService.Authenticate(c.Request.Context(), email, c.PostForm("password"))
+	if err != nil {
+		h.renderLogin(c, http.StatusUnauthorized, returnTo, email, "Invalid email or password")
+		return
+	}
+
+	raw, _, err := h.sessionService.CreateSession(user, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		h.renderLogin(c, http.StatusInternalServerError, returnTo, email, "Could not sign in, try again later")
+		return
+	}
+
+	setSessionCookie(c, h.config, raw, int(h.sessionService.AbsoluteTimeout().Seconds()))
+	c.Redirect(http.StatusFound, publicURL(h.config, returnTo))
+}
+
+// GetSession godoc
+// @Summary      Get current login session
+// @Description  Returns the login session behind the SSO cookie
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Failure      401  {object}  map[string]string
+// @Router       /auth/session [get]
+func (h *SessionHandler) GetSession(c *gin.Context) {
+	raw, _ := c.Cookie(h.config.Session.CookieName)
+	session, err := h.sessionService.ResolveSession(raw)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "no active session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":           session.ID,
+		"user_id":      session.UserID,
+		"email":        session.User.Email,
+		"auth_time":    session.AuthTime,
+		"last_seen_at": session.LastSeenAt,
+		"expires_at":   session.ExpiresAt,
+	})
+}
+
+// EndSession godoc
+// @Summary      End login session
+// @Description  Revokes the login session behind the SSO cookie and clears it
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Router       /auth/session [delete]
+func (h *SessionHandler) EndSession(c *gin.Context) {
+	raw, err := c.Cookie(h.config.Session.CookieName)
+	if err != nil || raw == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "no active session"})
+		return
+	}
+
+	setSessionCookie(c, h.config, "", -1)
+
+	if err := h.sessionService.RevokeSession(raw); err != nil {
+		if err.Error() == "session not found" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "no active session"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logout successful"})
+}
+
+func (h *SessionHandler) renderLogin(c *gin.Context, status int, returnTo, email, message string) {
+	// The page still works with local accounts when providers can't be listed
+	providers, _ := h.federationService.ListProviders(true)
+
+	csrfToken, err := h.issueCSRFToken(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to render login page"})
+		return
+	}
+
+	var page bytes.Buffer
+	err = loginTemplate.Execute(&page, gin.H{
+		"BaseURL":   strings.TrimRight(h.config.PublicURL, "/"),
+		"ReturnTo":  returnTo,
+		"Email":     email,
+		"Error":     message,
+		"Providers": providers,
+		"CSRFToken": csrfToken,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to render login page"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Frame-Options", "DENY")
+	c.Data(status, "text/html; charset=utf-8", page.Bytes())
+}
+
+// issueCSRFToken sets a fresh token for the login form in a cookie, the form
+// posts it back and Login compares both
+func (h *SessionHandler) issueCSRFToken(c *gin.Context) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(h.csrfCookieName(), token, 0, "/", "", h.config.Session.CookieSecure, true)
+	return token, nil
+}
+
+func (h *SessionHandler) validCSRFToken(c *gin.Context) bool {
+	cookie, err := c.Cookie(h.csrfCookieName())
+	form := c.PostForm("csrf_token")
+	return err == nil && cookie != "" && subtle.ConstantTimeCompare([]byte(cookie), []byte(form)) == 1
+}
+
+func (h *SessionHandler) csrfCookieName() string {
+	return h.config.Session.CookieName + "_csrf"
+}
+
+func setSessionCookie(c *gin.Context, cfg *config.Config, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(cfg.Session.CookieName, value, maxAge, "/", "", cfg.Session.CookieSecure, true)
+}
+
+// publicURL turns a path of this server into the URL the browser reaches it
+// at. Behind Kong that includes the prefix of the API route, which the
+// gateway strips before forwarding.
+func publicURL(cfg *config.Config, path string) string {
+	return strings.TrimRight(cfg.PublicURL, "/") + path
+}
+
+// safeReturnTo only allows redirects back into this server, anything else
+// would turn the login page into an open redirect.
+func safeReturnTo(returnTo string) string {
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.HasPrefix(returnTo, "/\\") {
+		return "/"
+	}
+	return returnTo
+}
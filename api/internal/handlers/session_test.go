@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"auth-service/internal/config"
+	"auth-service/internal/models"
+	"auth-service/internal/services"
+	"auth-service/internal/testdb"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestLoginRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+
+	db := testdb.Open(t)
+	cfg := &config.Config{
+		PublicURL: "https://gateway.test/api/v1/auth",
+		Session:   config.SessionConfig{CookieName: "ccs_session", IdleTimeout: 30, AbsoluteTimeout: 12},
+	}
+	if err := db.Create(&models.User{Email: "ada@example.com", Name: "Ada", Username: "ada", Password: "correct horse"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	sessionService := services.NewSessionService(db, cfg, services.NewLocalAuthenticator(db))
+	handler := NewSessionHandler(sessionService, services.NewFederationService(db, cfg), cfg)
+
+	router := gin.New()
+	router.GET("/auth/login", handler.ShowLoginPage)
+	router.POST("/auth/login", handler.Login)
+	return router
+}
+
+var csrfField = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+func TestLoginPageUsesPublicURL(t *testing.T) {
+	router := newTestLoginRouter(t)
+
+	resp := serve(router, httptest.NewRequest(http.MethodGet, "/auth/login?return_to=/oauth2/authorize", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("got %d", resp.Code)
+	}
+	if !strings.Contains(resp.Body.String(), `action="https://gateway.test/api/v1/auth/auth/login"`) {
+		t.Errorf("form does not post through PUBLIC_URL:\n%s", resp.Body)
+	}
+}
+
+func TestLoginRequiresCSRFToken(t *testing.T) {
+	router := newTestLoginRouter(t)
+
+	page := serve(router, httptest.NewRequest(http.MethodGet, "/auth/login", nil))
+	match := csrfField.FindStringSubmatch(page.Body.String())
+	if match == nil {
+		t.Fatalf("login page has no csrf_token:\n%s", page.Body)
+	}
+	var cookie *http.Cookie
+	for _, c := range page.Result().Cookies() {
+		if c.Name == "ccs_session_csrf" {
+			cookie = c
+		}
+	}
+	if cookie == nil || cookie.Value != match[1] {
+		t.Fatalf("csrf cookie = %v, want %s", cookie, match[1])
+	}
+
+	post := func(token string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		form := url.Values{
+			"email":      {"ada@example.com"},
+			"password":   {"correct horse"},
+			"return_to":  {"/oauth2/authorize?client_id=app"},
+			"csrf_token": {token},
+		}
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		return serve(router, req)
+	}
+
+	// A form posted from another site carries neither the cookie nor its value
+	if resp := post("", nil); resp.Code != http.StatusForbidden {
+		t.Errorf("without token: got %d, want 403", resp.Code)
+	}
+	if resp := post("guessed", cookie); resp.Code != http.StatusForbidden {
+		t.Errorf("wrong token: got %d, want 403", resp.Code)
+	}
+	if resp := post(match[1], nil); resp.Code != http.StatusForbidden {
+		t.Errorf("without cookie: got %d, want 403", resp.Code)
+	}
+
+	resp := post(match[1], cookie)
+	if resp.Code != http.StatusFound {
+		t.Fatalf("valid login: got %d (%s)", resp.Code, resp.Body)
+	}
+	if location := resp.Header().Get("Location"); location != "https://gateway.test/api/v1/auth/oauth2/authorize?client_id=app" {
+		t.Errorf("redirected to %s", location)
+	}
+}
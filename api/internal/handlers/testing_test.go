@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"auth-service/internal/models"
+	"auth-service/internal/seeds"
+	"auth-service/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// authenticateAs stands in for ValidateToken, the user comes from the
+// X-Test-User header
+func authenticateAs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("authenticated_userid", c.GetHeader("X-Test-User"))
+		c.Next()
+	}
+}
+
+// newTestUser creates a user with the given built-in roles, the roles are
+// seeded on first use
+func newTestUser(t *testing.T, db *gorm.DB, roles ...string) uuid.UUID {
+	t.Helper()
+
+	if err := seeds.SeedRoles(db); err != nil {
+		t.Fatal(err)
+	}
+
+	user := models.User{Email: uuid.NewString() + "@example.com", Name: "Test", Username: uuid.NewString(), Password: "x"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	rbac := services.NewRBACService(db)
+	for _, role := range roles {
+		if _, err := rbac.AssignRole(user.ID, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return user.ID
+}
+
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// multipartRequest builds a request uploading each file under its field name
+func multipartRequest(t *testing.T, method, target string, userID uuid.UUID, files map[string][]byte) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for field, data := range files {
+		part, err := writer.CreateFormFile(field, field+".png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(data)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(method, target, &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("X-Test-User", userID.String())
+	return req
+}
+
+func serve(router http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type UserHandler struct {
+	userService *services.UserService
+}
+
+func NewUserHandler(userService *services.UserService) *UserHandler {
+	return &UserHandler{
+		userService: userService,
+	}
+}
+
+// GetMe godoc
+// @Summary      Get own account
+// @Description  Returns the account of the authenticated user
+// @Tags         me
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Success      200  {object}  services.UserResponse
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /me [get]
+func (h *UserHandler) GetMe(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.userService.GetUser(userID)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateMe godoc
+// @Summary      Update own account
+// @Description  Updates the name and/or username of the authenticated user
+// @Tags         me
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        user  body  services.UpdateProfileRequest  true  "Fields to update"
+// @Success      200  {object}  services.UserResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /me [patch]
+func (h *UserHandler) UpdateMe(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	var req services.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	user, err := h.userService.UpdateProfile(userID, &req)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// ChangePassword godoc
+// @Summary      Change own password
+// @Description  Replaces the password of the authenticated user and revokes all other sessions
+// @Tags         me
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        password  body  services.ChangePasswordRequest  true  "Current and new password"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Router       /me/password [post]
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	var req services.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	currentToken := ""
+	if token, exists := c.Get("token"); exists {
+		currentToken = token.(models.OAuth2Token).AccessToken
+	}
+
+	if err := h.userService.ChangePassword(userID, currentToken, &req); err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password updated"})
+}
+
+// ChangeEmail godoc
+// @Summary      Request an email change
+// @Description  Starts an email change for the authenticated user. The new address must be verified before it replaces the current one.
+// @Tags         me
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        email  body  services.ChangeEmailRequest  true  "New email and current password"
+// @Success      202  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /me/email [post]
+func (h *UserHandler) ChangeEmail(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	var req services.ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	verification, err := h.userService.RequestEmailChange(userID, &req)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":    "verification required",
+		"email":      verification.Email,
+		"expires_at": verification.ExpiresAt,
+	})
+}
+
+// VerifyEmail godoc
+// @Summary      Verify an email change
+// @Description  Confirms a pending email change using the verification token
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        token  body  object{token=string}  true  "Verification token"
+// @Success      200  {object}  services.UserResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /auth/verify-email [post]
+func (h *UserHandler) VerifyEmail(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	user, err := h.userService.VerifyEmailChange(req.Token)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// DeleteMe godoc
+// @Summary      Delete own account
+// @Description  Deactivates the authenticated user, revokes its tokens and schedules its images for deletion
+// @Tags         me
+// @Security     ApiKeyAuth
+// @Success      204  "No Content"
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /me [delete]
+func (h *UserHandler) DeleteMe(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.userService.DeactivateUser(userID); err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// CreateUser godoc
+// @Summary      Create a user
+// @Description  Creates an active account with the default role. The password policy applies as on registration.
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        user  body  services.CreateUserRequest  true  "User"
+// @Success      201  {object}  services.UserResponse
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      409  {object}  map[string]string
+// @Router       /admin/users [post]
+func (h *UserHandler) CreateUser(c *gin.Context) {
+	var req services.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	user, err := h.userService.CreateUser(&req)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// DeactivateUser godoc
+// @Summary      Deactivate a user
+// @Description  Deactivates the account and revokes its sessions and tokens. Unlike deleting the own account, nothing is scheduled for deletion.
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Param        user_id  path  string  true  "User ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /admin/users/{user_id}/deactivate [post]
+func (h *UserHandler) DeactivateUser(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID format"})
+		return
+	}
+
+	if err := h.userService.DisableUser(userID); err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeUserTokens godoc
+// @Summary      Revoke a user's tokens
+// @Description  Deletes every token and login session of the user
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        user_id  path  string  true  "User ID"
+// @Success      200  {object}  map[string]int64
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /admin/users/{user_id}/tokens [delete]
+func (h *UserHandler) RevokeUserTokens(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID format"})
+		return
+	}
+
+	revoked, err := h.userService.RevokeUserTokens(userID)
+	if err != nil {
+		h.sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revoked": revoked})
+}
+
+func (h *UserHandler) sendError(c *gin.Context, err error) {
+	if sendPasswordPolicyError(c, err) {
+		return
+	}
+
+	switch err.Error() {
+	case "user not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case "username already taken", "email already taken":
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case "invalid current password":
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case "name cannot be empty", "username cannot be empty", "email unchanged",
+		"invalid verification token", "verification token expired or already used":
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// sendPasswordPolicyError answers 400 with the violated rules when err is a
+// password policy error, and reports whether it did.
+func sendPasswordPolicyError(c *gin.Context, err error) bool {
+	var policyErr *services.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":      policyErr.Error(),
+		"violations": policyErr.Violations,
+	})
+	return true
+}
+
+// authenticatedUserID reads the user set by ValidateToken. It writes the error
+// response itself, so callers only need to return when ok is false.
+func authenticatedUserID(c *gin.Context) (uuid.UUID, bool) {
+	userIDStr := c.GetString("authenticated_userid")
+	if userIDStr == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return uuid.Nil, false
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil || userID == uuid.Nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID in token"})
+		return uuid.Nil, false
+	}
+
+	return userID, true
+}
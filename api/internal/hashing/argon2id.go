@@ -0,0 +1,86 @@
+package hashing
+
+import (
+	"crypto/subtle"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+type Argon2idParams struct {
+	// Memory in KiB
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+}
+
+// DefaultArgon2idParams follows the OWASP minimum recommendation, use
+// cmd/hash-benchmark to find what the server can afford.
+var DefaultArgon2idParams = Argon2idParams{Memory: 19456, Time: 2, Threads: 1}
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+type Argon2idHasher struct {
+	params Argon2idParams
+}
+
+func NewArgon2idHasher(params Argon2idParams) *Argon2idHasher {
+	return &Argon2idHasher{params: params}
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt, err := newSalt(argon2SaltLength)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Time, h.params.Memory, h.params.Threads, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		h.params.Memory, h.params.Time, h.params.Threads, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Verify(password, encoded string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(computed, key) == 1, nil
+}
+
+func (h *Argon2idHasher) Current(encoded string) bool {
+	params, _, key, err := decodeArgon2id(encoded)
+	return err == nil && params == h.params && len(key) == argon2KeyLength
+}
+
+func decodeArgon2id(encoded string) (Argon2idParams, []byte, []byte, error) {
+	var params Argon2idParams
+	var version int
+	if _, err := fmt.Sscanf(encoded, "$argon2id$v=%d$", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2id version")
+	}
+
+	rawParams, rawSalt, rawKey, err := splitPHC(encoded, AlgorithmArgon2id)
+	if err != nil {
+		return params, nil, nil, err
+	}
+
+	if _, err := fmt.Sscanf(rawParams, "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return params, nil, nil, fmt.Errorf("malformed argon2id parameters")
+	}
+
+	salt, err := b64.DecodeString(rawSalt)
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("malformed argon2id salt")
+	}
+	key, err := b64.DecodeString(rawKey)
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("malformed argon2id hash")
+	}
+
+	return params, salt, key, nil
+}
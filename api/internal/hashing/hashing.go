@@ -0,0 +1,183 @@
+// Package hashing turns passwords and client secrets into self-describing
+// PHC strings (https://github.com/P-H-C/phc-string-format) and checks them.
+// Every supported algorithm can be verified at any time, so the algorithm or
+// its parameters can change without invalidating stored hashes; hashes that
+// do not match the current settings are upgraded on the next successful login.
+package hashing
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"auth-service/internal/config"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmScrypt   = "scrypt"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+// Hasher is one password hashing algorithm at fixed parameters.
+type Hasher interface {
+	// Hash returns the encoded hash of the password with a fresh salt
+	Hash(password string) (string, error)
+	// Verify checks the password against a hash this algorithm produced. The
+	// parameters are read from the encoded hash, not from the hasher.
+	Verify(password, encoded string) (bool, error)
+	// Current reports whether the encoded hash uses this algorithm with the
+	// hasher's parameters
+	Current(encoded string) bool
+}
+
+var (
+	mu            sync.RWMutex
+	defaultHasher Hasher = NewArgon2idHasher(DefaultArgon2idParams)
+)
+
+// New builds the hasher selected in the configuration. Parameters out of
+// range are an error here rather than a truncated value or a failure on the
+// first login.
+func New(cfg config.HashingConfig) (Hasher, error) {
+	switch cfg.Algorithm {
+	case AlgorithmArgon2id:
+		if err := validateArgon2id(cfg); err != nil {
+			return nil, err
+		}
+		return NewArgon2idHasher(Argon2idParams{
+			Memory:  uint32(cfg.Argon2Memory),
+			Time:    uint32(cfg.Argon2Time),
+			Threads: uint8(cfg.Argon2Threads),
+		}), nil
+	case AlgorithmScrypt:
+		if err := validateScrypt(cfg); err != nil {
+			return nil, err
+		}
+		return NewScryptHasher(ScryptParams{
+			LogN: uint8(cfg.ScryptLogN),
+			R:    cfg.ScryptR,
+			P:    cfg.ScryptP,
+		}), nil
+	case AlgorithmBcrypt:
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return NewBcryptHasher(cfg.BcryptCost), nil
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q", cfg.Algorithm)
+	}
+}
+
+func validateArgon2id(cfg config.HashingConfig) error {
+	if cfg.Argon2Time < 1 || cfg.Argon2Time > math.MaxUint8 {
+		return fmt.Errorf("ARGON2_TIME must be between 1 and %d", math.MaxUint8)
+	}
+	if cfg.Argon2Threads < 1 || cfg.Argon2Threads > math.MaxUint8 {
+		return fmt.Errorf("ARGON2_THREADS must be between 1 and %d", math.MaxUint8)
+	}
+	// argon2 needs at least 8 KiB per thread
+	if cfg.Argon2Memory < 8*cfg.Argon2Threads || uint64(cfg.Argon2Memory) > math.MaxUint32 {
+		return fmt.Errorf("ARGON2_MEMORY must be between %d and %d KiB", 8*cfg.Argon2Threads, uint32(math.MaxUint32))
+	}
+	return nil
+}
+
+// validateScrypt applies the limits scrypt.Key checks on every hash
+func validateScrypt(cfg config.HashingConfig) error {
+	if cfg.ScryptLogN < 1 || cfg.ScryptLogN > 62 {
+		return errors.New("SCRYPT_LOG_N must be between 1 and 62")
+	}
+	if cfg.ScryptR < 1 || cfg.ScryptP < 1 {
+		return errors.New("SCRYPT_R and SCRYPT_P must be at least 1")
+	}
+	if uint64(cfg.ScryptR)*uint64(cfg.ScryptP) >= 1<<30 || cfg.ScryptR > math.MaxInt/256 || cfg.ScryptR > math.MaxInt/128/cfg.ScryptP {
+		return errors.New("SCRYPT_R * SCRYPT_P is too large")
+	}
+	if 1<<cfg.ScryptLogN > math.MaxInt/128/cfg.ScryptR {
+		return errors.New("SCRYPT_LOG_N is too large for SCRYPT_R")
+	}
+	return nil
+}
+
+// SetDefault replaces the hasher used for new hashes. It is called once at
+// startup with the configured hasher.
+func SetDefault(hasher Hasher) {
+	mu.Lock()
+	defer mu.Unlock()
+	defaultHasher = hasher
+}
+
+func current() Hasher {
+	mu.RLock()
+	defer mu.RUnlock()
+	return defaultHasher
+}
+
+// Hash hashes the password with the default hasher.
+func Hash(password string) (string, error) {
+	return current().Hash(password)
+}
+
+// Verify checks a password against a hash of any supported algorithm.
+func Verify(password, encoded string) bool {
+	hasher := hasherFor(encoded)
+	if hasher == nil {
+		return false
+	}
+
+	ok, err := hasher.Verify(password, encoded)
+	return err == nil && ok
+}
+
+// NeedsRehash reports whether the hash was made with another algorithm or
+// other parameters than the default hasher uses now.
+func NeedsRehash(encoded string) bool {
+	return !current().Current(encoded)
+}
+
+func hasherFor(encoded string) Hasher {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return &Argon2idHasher{}
+	case strings.HasPrefix(encoded, "$scrypt$"):
+		return &ScryptHasher{}
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return &BcryptHasher{}
+	default:
+		return nil
+	}
+}
+
+func newSalt(length int) ([]byte, error) {
+	salt := make([]byte, length)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// PHC strings use unpadded standard base64
+var b64 = base64.RawStdEncoding
+
+// splitPHC splits "$id$v=19$params$salt$hash" into its fields; the version
+// field is optional.
+func splitPHC(encoded, id string) (params, salt, hash string, err error) {
+	fields := strings.Split(encoded, "$")
+	if len(fields) > 0 && fields[0] == "" {
+		fields = fields[1:]
+	}
+	if len(fields) > 1 && strings.HasPrefix(fields[1], "v=") {
+		fields = append(fields[:1], fields[2:]...)
+	}
+	if len(fields) != 4 || fields[0] != id {
+		return "", "", "", fmt.Errorf("malformed %s hash", id)
+	}
+	return fields[1], fields[2], fields[3], nil
+}
@@ -0,0 +1,158 @@
+package hashing
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cheap parameters, the tests check the encoding and not the cost
+var (
+	testArgon2idParams = Argon2idParams{Memory: 64, Time: 1, Threads: 1}
+	testScryptParams   = ScryptParams{LogN: 4, R: 8, P: 1}
+)
+
+// useDefault swaps the default hasher for the rest of the test
+func useDefault(t *testing.T, hasher Hasher) {
+	t.Helper()
+
+	previous := current()
+	SetDefault(hasher)
+	t.Cleanup(func() { SetDefault(previous) })
+}
+
+func mustHash(t *testing.T, hasher Hasher, password string) string {
+	t.Helper()
+
+	encoded, err := hasher.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+func TestSplitPHC(t *testing.T) {
+	cases := []struct {
+		name    string
+		encoded string
+		id      string
+		params  string
+		salt    string
+		hash    string
+		wantErr bool
+	}{
+		{"with version", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$aGFzaA", AlgorithmArgon2id, "m=64,t=1,p=1", "c2FsdA", "aGFzaA", false},
+		{"without version", "$scrypt$ln=4,r=8,p=1$c2FsdA$aGFzaA", AlgorithmScrypt, "ln=4,r=8,p=1", "c2FsdA", "aGFzaA", false},
+		{"other algorithm", "$scrypt$ln=4,r=8,p=1$c2FsdA$aGFzaA", AlgorithmArgon2id, "", "", "", true},
+		{"missing hash", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA", AlgorithmArgon2id, "", "", "", true},
+		{"extra field", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$aGFzaA$more", AlgorithmArgon2id, "", "", "", true},
+		// Five fields are only a version when the second one says so
+		{"five fields without version", "$argon2id$m=64$t=1$c2FsdA$aGFzaA", AlgorithmArgon2id, "", "", "", true},
+		{"empty", "", AlgorithmArgon2id, "", "", "", true},
+	}
+
+	for _, tc := range cases {
+		params, salt, hash, err := splitPHC(tc.encoded, tc.id)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: err = %v", tc.name, err)
+			continue
+		}
+		if params != tc.params || salt != tc.salt || hash != tc.hash {
+			t.Errorf("%s: got %q %q %q", tc.name, params, salt, hash)
+		}
+	}
+}
+
+func TestDecodeArgon2id(t *testing.T) {
+	encoded := mustHash(t, NewArgon2idHasher(testArgon2idParams), "secret")
+
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params != testArgon2idParams || len(salt) != argon2SaltLength || len(key) != argon2KeyLength {
+		t.Errorf("decoded %+v with %d byte salt and %d byte key", params, len(salt), len(key))
+	}
+
+	// Fields are "", "argon2id", "v=19", params, salt, key
+	withField := func(i int, value string) string {
+		fields := strings.Split(encoded, "$")
+		fields[i] = value
+		return strings.Join(fields, "$")
+	}
+	rejected := map[string]string{
+		"other version":     strings.Replace(encoded, "v=19", "v=16", 1),
+		"no version":        strings.Replace(encoded, "$v=19", "", 1),
+		"missing parameter": strings.Replace(encoded, ",p=1", "", 1),
+		"threads overflow":  strings.Replace(encoded, "p=1", "p=300", 1),
+		"bad salt":          withField(4, "!!!"),
+		"padded hash":       withField(5, b64.EncodeToString(make([]byte, 32))+"="),
+		"scrypt hash":       mustHash(t, NewScryptHasher(testScryptParams), "secret"),
+	}
+	for name, encoded := range rejected {
+		if _, _, _, err := decodeArgon2id(encoded); err == nil {
+			t.Errorf("%s: decoded %s", name, encoded)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	useDefault(t, NewArgon2idHasher(testArgon2idParams))
+
+	// Hashes of every algorithm verify whatever the default is
+	hashers := map[string]Hasher{
+		AlgorithmArgon2id: NewArgon2idHasher(testArgon2idParams),
+		AlgorithmScrypt:   NewScryptHasher(testScryptParams),
+		AlgorithmBcrypt:   NewBcryptHasher(bcrypt.MinCost),
+	}
+	for name, hasher := range hashers {
+		encoded := mustHash(t, hasher, "correct horse")
+		if !Verify("correct horse", encoded) {
+			t.Errorf("%s: right password rejected", name)
+		}
+		if Verify("battery staple", encoded) {
+			t.Errorf("%s: wrong password accepted", name)
+		}
+	}
+
+	for _, encoded := range []string{"", "correct horse", "$md5$abc", "$argon2id$v=19$garbage"} {
+		if Verify("correct horse", encoded) {
+			t.Errorf("%q accepted", encoded)
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	useDefault(t, NewArgon2idHasher(testArgon2idParams))
+
+	current := mustHash(t, NewArgon2idHasher(testArgon2idParams), "secret")
+	cases := []struct {
+		name    string
+		encoded string
+		want    bool
+	}{
+		{"current", current, false},
+		{"other memory", mustHash(t, NewArgon2idHasher(Argon2idParams{Memory: 128, Time: 1, Threads: 1}), "secret"), true},
+		{"other time", mustHash(t, NewArgon2idHasher(Argon2idParams{Memory: 64, Time: 2, Threads: 1}), "secret"), true},
+		{"other threads", mustHash(t, NewArgon2idHasher(Argon2idParams{Memory: 64, Time: 1, Threads: 2}), "secret"), true},
+		{"shorter key", current[:strings.LastIndex(current, "$")+1] + b64.EncodeToString(make([]byte, 16)), true},
+		{"scrypt", mustHash(t, NewScryptHasher(testScryptParams), "secret"), true},
+		{"bcrypt", mustHash(t, NewBcryptHasher(bcrypt.MinCost), "secret"), true},
+		{"malformed", "$argon2id$v=19$garbage", true},
+	}
+	for _, tc := range cases {
+		if got := NeedsRehash(tc.encoded); got != tc.want {
+			t.Errorf("%s: NeedsRehash = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// Changing the configured algorithm marks the old hashes for an upgrade
+	useDefault(t, NewBcryptHasher(bcrypt.MinCost))
+	if !NeedsRehash(current) {
+		t.Error("argon2id hash not rehashed after switching to bcrypt")
+	}
+	if NeedsRehash(mustHash(t, NewBcryptHasher(bcrypt.MinCost), "secret")) {
+		t.Error("bcrypt hash at the current cost rehashed")
+	}
+}
@@ -0,0 +1,86 @@
+package hashing
+
+import (
+	"crypto/subtle"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+type ScryptParams struct {
+	// CPU/memory cost as a power of two, N = 2^LogN
+	LogN uint8
+	R    int
+	P    int
+}
+
+const (
+	scryptSaltLength = 16
+	scryptKeyLength  = 32
+)
+
+// ScryptHasher encodes hashes as "$scrypt$ln=15,r=8,p=1$salt$hash", the
+// format passlib uses.
+type ScryptHasher struct {
+	params ScryptParams
+}
+
+func NewScryptHasher(params ScryptParams) *ScryptHasher {
+	return &ScryptHasher{params: params}
+}
+
+func (h *ScryptHasher) Hash(password string) (string, error) {
+	salt, err := newSalt(scryptSaltLength)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := scrypt.Key([]byte(password), salt, 1<<h.params.LogN, h.params.R, h.params.P, scryptKeyLength)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s",
+		h.params.LogN, h.params.R, h.params.P, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (h *ScryptHasher) Verify(password, encoded string) (bool, error) {
+	params, salt, key, err := decodeScrypt(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	computed, err := scrypt.Key([]byte(password), salt, 1<<params.LogN, params.R, params.P, len(key))
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(computed, key) == 1, nil
+}
+
+func (h *ScryptHasher) Current(encoded string) bool {
+	params, _, key, err := decodeScrypt(encoded)
+	return err == nil && params == h.params && len(key) == scryptKeyLength
+}
+
+func decodeScrypt(encoded string) (ScryptParams, []byte, []byte, error) {
+	var params ScryptParams
+	rawParams, rawSalt, rawKey, err := splitPHC(encoded, AlgorithmScrypt)
+	if err != nil {
+		return params, nil, nil, err
+	}
+
+	if _, err := fmt.Sscanf(rawParams, "ln=%d,r=%d,p=%d", &params.LogN, &params.R, &params.P); err != nil || params.LogN >= 32 {
+		return params, nil, nil, fmt.Errorf("malformed scrypt parameters")
+	}
+
+	salt, err := b64.DecodeString(rawSalt)
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("malformed scrypt salt")
+	}
+	key, err := b64.DecodeString(rawKey)
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("malformed scrypt hash")
+	}
+
+	return params, salt, key, nil
+}
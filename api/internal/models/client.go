@@ -1,19 +1,25 @@
 package models
 
 import (
+	"errors"
 	"time"
 
+	"auth-service/internal/hashing"
+
 	"github.com/google/uuid"
 	"github.com/lib/pq"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type Consumer struct {
-	ID        uuid.UUID `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	Username  string    `json:"username" gorm:"uniqueIndex"`
-	CustomID  string    `json:"custom_id" gorm:"uniqueIndex"`
-	CreatedAt time.Time `json:"created_at"`
+	ID       uuid.UUID      `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	Username string         `json:"username" gorm:"uniqueIndex"`
+	CustomID string         `json:"custom_id" gorm:"uniqueIndex"`
+	Tags     pq.StringArray `json:"tags" gorm:"type:text[];index:,type:gin" swaggertype:"array,string"`
+	// Free form key/value pairs, e.g. to reconcile with the gateway
+	Metadata  map[string]string `json:"metadata" gorm:"type:jsonb;serializer:json"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
 }
 
 func (c *Consumer) BeforeCreate(tx *gorm.DB) error {
@@ -24,18 +30,51 @@ func (c *Consumer) BeforeCreate(tx *gorm.DB) error {
 }
 
 type OAuth2Credential struct {
-	ID           uuid.UUID      `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	Name         string         `json:"name" gorm:"not null"`
-	ClientID     string         `json:"client_id" gorm:"uniqueIndex;not null"`
-	ClientSecret string         `json:"client_secret" gorm:"not null"`
+	ID       uuid.UUID `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	Name     string    `json:"name" gorm:"not null"`
+	ClientID string    `json:"client_id" gorm:"uniqueIndex;not null"`
+	// Hash of the single secret clients had before secret rotation, moved
+	// into Secrets at startup and empty afterwards
+	ClientSecret string         `json:"-" gorm:"not null;default:''"`
 	RedirectURIs pq.StringArray `json:"redirect_uris" gorm:"type:text[]" swaggertype:"array,string"`
 	ConsumerID   uuid.UUID      `json:"consumer_id" gorm:"not null;type:uuid"`
 	CreatedAt    time.Time      `json:"created_at"`
 
+	// OAuth2 policy of the client. Zero values fall back to the defaults
+	// from the environment, except for the password grant which a client
+	// only gets when it is listed in GrantTypes.
+	GrantTypes    pq.StringArray `json:"grant_types" gorm:"type:text[]" swaggertype:"array,string"`
+	ResponseTypes pq.StringArray `json:"response_types" gorm:"type:text[]" swaggertype:"array,string"`
+	// Public clients cannot keep a secret, they authenticate with PKCE only
+	Public             bool   `json:"public" gorm:"not null;default:false"`
+	RequirePKCE        bool   `json:"require_pkce" gorm:"not null;default:false"`
+	AccessTokenTTL     int    `json:"access_token_ttl" gorm:"not null;default:0"`
+	RefreshTokenTTL    int    `json:"refresh_token_ttl" gorm:"not null;default:0"`
+	AuthCodeTTL        int    `json:"auth_code_ttl" gorm:"not null;default:0"`
+	RefreshTokenPolicy string `json:"refresh_token_policy" gorm:"not null;default:''"`
+
 	// Relación
-	Consumer Consumer `json:"consumer,omitempty" gorm:"foreignKey:ConsumerID;constraint:OnDelete:CASCADE"`
+	Consumer Consumer       `json:"consumer,omitempty" gorm:"foreignKey:ConsumerID;constraint:OnDelete:CASCADE"`
+	Secrets  []ClientSecret `json:"secrets,omitempty" gorm:"foreignKey:CredentialID;constraint:OnDelete:CASCADE"`
 }
 
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantClientCredentials = "client_credentials"
+	GrantPassword          = "password"
+	GrantRefreshToken      = "refresh_token"
+
+	ResponseTypeCode  = "code"
+	ResponseTypeToken = "token"
+
+	// RefreshTokenRotate replaces the refresh token on every use,
+	// RefreshTokenReuse keeps it until it expires and RefreshTokenNone
+	// issues no usable refresh token at all.
+	RefreshTokenRotate = "rotate"
+	RefreshTokenReuse  = "reuse"
+	RefreshTokenNone   = "none"
+)
+
 func (OAuth2Credential) TableName() string {
 	return "oauth2_credentials"
 }
@@ -47,13 +86,95 @@ func (app *OAuth2Credential) BeforeCreate(tx *gorm.DB) error {
 	if app.ClientID == "" {
 		app.ClientID = uuid.New().String()
 	}
-	if app.ClientSecret == "" {
-		raw := uuid.New().String()
-		hashed, err := bcrypt.GenerateFromPassword([]byte(raw), bcrypt.DefaultCost)
-		if err != nil {
-			return err
+	return nil
+}
+
+// ClientSecret is one of the secrets a client can authenticate with. Several
+// can be active at once so a client can switch to a new secret before the
+// old one expires.
+type ClientSecret struct {
+	ID           uuid.UUID `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	CredentialID uuid.UUID `json:"-" gorm:"not null;type:uuid;index"`
+	SecretHash   string    `json:"-" gorm:"not null"`
+	// Last characters of the plain secret, to tell secrets apart
+	Hint       string     `json:"hint"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (ClientSecret) TableName() string {
+	return "oauth2_client_secrets"
+}
+
+func (s *ClientSecret) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsActive reports whether the secret can still be used at the given time.
+func (s *ClientSecret) IsActive(now time.Time) bool {
+	return s.ExpiresAt == nil || now.Before(*s.ExpiresAt)
+}
+
+// NewClientSecret hashes a plain secret into a ClientSecret.
+func NewClientSecret(credentialID uuid.UUID, plain string, expiresAt *time.Time) (*ClientSecret, error) {
+	hashed, err := hashing.Hash(plain)
+	if err != nil {
+		return nil, err
+	}
+
+	// Short secrets would give away too much of themselves
+	hint := ""
+	if len(plain) >= 16 {
+		hint = plain[len(plain)-4:]
+	}
+
+	return &ClientSecret{
+		CredentialID: credentialID,
+		SecretHash:   hashed,
+		Hint:         hint,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// ValidatePolicy checks the policy settings of a client before it is
+// created or updated, the token endpoint trusts what is stored.
+func (c *OAuth2Credential) ValidatePolicy() error {
+	for _, grantType := range c.GrantTypes {
+		switch grantType {
+		case GrantAuthorizationCode:
+		case GrantClientCredentials:
+			if c.Public {
+				return errors.New("public clients cannot use client_credentials")
+			}
+		case GrantPassword:
+			// Without a secret anyone could send passwords through the client
+			if c.Public {
+				return errors.New("public clients cannot use password")
+			}
+		default:
+			return errors.New("invalid grant_types")
 		}
-		app.ClientSecret = string(hashed)
 	}
+
+	for _, responseType := range c.ResponseTypes {
+		if responseType != ResponseTypeCode && responseType != ResponseTypeToken {
+			return errors.New("invalid response_types")
+		}
+	}
+
+	if c.AccessTokenTTL < 0 || c.RefreshTokenTTL < 0 || c.AuthCodeTTL < 0 {
+		return errors.New("invalid token lifetime")
+	}
+
+	switch c.RefreshTokenPolicy {
+	case "", RefreshTokenRotate, RefreshTokenReuse, RefreshTokenNone:
+	default:
+		return errors.New("invalid refresh_token_policy")
+	}
+
 	return nil
 }
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"auth-service/internal/utils"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// EmailVerification holds a pending email change until the user proves
+// ownership of the new address.
+type EmailVerification struct {
+	ID        uuid.UUID `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserID    uuid.UUID `json:"user_id" gorm:"not null;type:uuid;index"`
+	Email     string    `json:"email" gorm:"not null"`
+	Token     string    `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `json:"expires_at"`
+	IsUsed    bool      `json:"is_used" gorm:"default:false"`
+	CreatedAt time.Time `json:"created_at"`
+
+	User User `json:"user,omitempty" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
+
+func (ev *EmailVerification) BeforeCreate(tx *gorm.DB) error {
+	if ev.ID == uuid.Nil {
+		ev.ID = uuid.New()
+	}
+	if ev.Token == "" {
+		ev.Token = generateRandomToken()
+	}
+	if ev.ExpiresAt.IsZero() {
+		ev.ExpiresAt = utils.GetCurrentTS().Add(24 * time.Hour)
+	}
+	return nil
+}
+
+func (ev *EmailVerification) IsValid() bool {
+	return !ev.IsUsed && utils.GetCurrentTS().Before(ev.ExpiresAt)
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"auth-service/internal/utils"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	ExportStatusPending   = "pending"
+	ExportStatusRunning   = "running"
+	ExportStatusCompleted = "completed"
+	ExportStatusFailed    = "failed"
+)
+
+// ExportJob tracks an asynchronous personal data export and the link used to
+// download the resulting archive.
+type ExportJob struct {
+	ID            uuid.UUID  `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserID        uuid.UUID  `json:"user_id" gorm:"not null;type:uuid;index"`
+	Status        string     `json:"status" gorm:"not null;default:pending"`
+	ObjectName    string     `json:"-"`
+	Size          int64      `json:"size,omitempty"`
+	DownloadToken string     `json:"-" gorm:"uniqueIndex;not null"`
+	Error         string     `json:"error,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	CompletedAt   *time.Time `json:"completed_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+
+	User User `json:"-" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
+
+func (j *ExportJob) BeforeCreate(tx *gorm.DB) error {
+	if j.ID == uuid.Nil {
+		j.ID = uuid.New()
+	}
+	if j.DownloadToken == "" {
+		j.DownloadToken = generateRandomToken()
+	}
+	return nil
+}
+
+func (j *ExportJob) IsDownloadable() bool {
+	return j.Status == ExportStatusCompleted && j.ExpiresAt != nil && utils.GetCurrentTS().Before(*j.ExpiresAt)
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Group is a set of users managed by an external roster system through SCIM,
+// e.g. the students of a course.
+type Group struct {
+	ID          uuid.UUID `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	DisplayName string    `json:"display_name" gorm:"uniqueIndex;not null"`
+	ExternalID  string    `json:"external_id,omitempty" gorm:"index"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	Members []User `json:"members,omitempty" gorm:"many2many:group_members;constraint:OnDelete:CASCADE"`
+}
+
+func (g *Group) BeforeCreate(tx *gorm.DB) error {
+	if g.ID == uuid.Nil {
+		g.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"auth-service/internal/utils"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// IdentityProvider is an upstream OpenID Connect provider users can log in
+// with, such as an institutional account.
+type IdentityProvider struct {
+	ID           uuid.UUID      `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	Slug         string         `json:"slug" gorm:"uniqueIndex;not null"`
+	Name         string         `json:"name" gorm:"not null"`
+	Issuer       string         `json:"issuer" gorm:"not null"`
+	ClientID     string         `json:"client_id" gorm:"not null"`
+	ClientSecret string         `json:"-" gorm:"not null"`
+	Scopes       pq.StringArray `json:"scopes" gorm:"type:text[]" swaggertype:"array,string"`
+	Enabled      bool           `json:"enabled"`
+	// Create a local user on first login when no account can be linked
+	AutoProvision bool `json:"auto_provision"`
+
+	// Claim mapping onto models.User
+	EmailClaim    string `json:"email_claim" gorm:"not null;default:email"`
+	NameClaim     string `json:"name_claim" gorm:"not null;default:name"`
+	UsernameClaim string `json:"username_claim" gorm:"not null;default:preferred_username"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (p *IdentityProvider) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	if len(p.Scopes) == 0 {
+		p.Scopes = pq.StringArray{"openid", "email", "profile"}
+	}
+	return nil
+}
+
+// FederatedIdentity links a subject at an identity provider to a local user
+type FederatedIdentity struct {
+	ID          uuid.UUID `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	ProviderID  uuid.UUID `json:"provider_id" gorm:"not null;type:uuid;uniqueIndex:idx_federated_subject"`
+	Subject     string    `json:"subject" gorm:"not null;uniqueIndex:idx_federated_subject"`
+	UserID      uuid.UUID `json:"user_id" gorm:"not null;type:uuid;index"`
+	Email       string    `json:"email"`
+	LastLoginAt time.Time `json:"last_login_at"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	Provider IdentityProvider `json:"provider,omitempty" gorm:"foreignKey:ProviderID;constraint:OnDelete:CASCADE"`
+	User     User             `json:"-" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
+
+func (f *FederatedIdentity) BeforeCreate(tx *gorm.DB) error {
+	if f.ID == uuid.Nil {
+		f.ID = uuid.New()
+	}
+	return nil
+}
+
+// FederatedLoginState carries a login from the redirect to the identity
+// provider until its callback.
+type FederatedLoginState struct {
+	State        string    `json:"-" gorm:"primaryKey"`
+	ProviderID   uuid.UUID `json:"provider_id" gorm:"not null;type:uuid"`
+	Nonce        string    `json:"-" gorm:"not null"`
+	CodeVerifier string    `json:"-" gorm:"not null"`
+	ReturnTo     string    `json:"return_to"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (s *FederatedLoginState) BeforeCreate(tx *gorm.DB) error {
+	if s.ExpiresAt.IsZero() {
+		s.ExpiresAt = utils.GetCurrentTS().Add(10 * time.Minute)
+	}
+	return nil
+}
+
+func (s *FederatedLoginState) IsExpired() bool {
+	return utils.GetCurrentTS().After(s.ExpiresAt)
+}
@@ -7,14 +7,24 @@ import (
 	"gorm.io/gorm"
 )
 
+// An image is pending from the moment its row is written until both blobs
+// are stored, listings only show ready images
+const (
+	ImageStatusPending = "pending"
+	ImageStatusReady   = "ready"
+)
+
 type Image struct {
-	ID              uuid.UUID `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	UserID          uuid.UUID `json:"user_id" gorm:"not null;type:uuid"`
-	SentImageID     uuid.UUID `json:"sent_image_id" gorm:"uniqueIndex;not null;type:uuid"`
-	ReceivedImageID uuid.UUID `json:"received_image_id" gorm:"uniqueIndex;not null;type:uuid"`
-	CreatedAt       time.Time `json:"created_at"`
+	ID              uuid.UUID      `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserID          uuid.UUID      `json:"user_id" gorm:"not null;type:uuid"`
+	SentImageID     uuid.UUID      `json:"sent_image_id" gorm:"uniqueIndex;not null;type:uuid"`
+	ReceivedImageID uuid.UUID      `json:"received_image_id" gorm:"uniqueIndex;not null;type:uuid"`
+	Status          string         `json:"status" gorm:"not null;default:ready;index"`
+	CreatedAt       time.Time      `json:"created_at"`
+	DeletedAt       gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 
-	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	User      User       `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Inference *Inference `json:"inference,omitempty" gorm:"foreignKey:ImageID;constraint:OnDelete:CASCADE"`
 }
 
 func (i *Image) BeforeCreate(tx *gorm.DB) error {
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Inference is what the segmentation model answered for an image. The class
+// map holds one class per pixel (0 is background, 1-9 the digits 1-9 and 10
+// the digit 0), row by row, zlib compressed.
+type Inference struct {
+	ID           uuid.UUID `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	ImageID      uuid.UUID `json:"image_id" gorm:"uniqueIndex;not null;type:uuid"`
+	ModelVersion string    `json:"model_version"`
+	LatencyMS    int64     `json:"latency_ms"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	ClassMap     []byte    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	Digits []InferenceDigit `json:"digits" gorm:"foreignKey:InferenceID;constraint:OnDelete:CASCADE"`
+}
+
+func (i *Inference) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return nil
+}
+
+// InferenceDigit is one connected region of the class map labelled with the
+// same digit, with the bounding box of the region in pixels
+type InferenceDigit struct {
+	ID          uuid.UUID `json:"-" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	InferenceID uuid.UUID `json:"-" gorm:"not null;type:uuid;index"`
+	Digit       int       `json:"digit" gorm:"not null;index:idx_inference_digits_digit_confidence"`
+	Confidence  float64   `json:"confidence" gorm:"not null;index:idx_inference_digits_digit_confidence"`
+	Pixels      int       `json:"pixels"`
+	X           int       `json:"x"`
+	Y           int       `json:"y"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+}
+
+func (d *InferenceDigit) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+package models
+
+// All lists every model with a table, in the order they are migrated. The
+// server, authctl, bootstrap-admin and the test database all migrate it, so a
+// new model only needs adding here.
+var All = []interface{}{
+	&User{}, &Consumer{}, &OAuth2Token{}, &OAuth2Credential{},
+	&ClientSecret{}, &AuthorizationCode{}, &Image{}, &Inference{},
+	&InferenceDigit{}, &EmailVerification{}, &ExportJob{}, &Permission{},
+	&Role{}, &Session{}, &IdentityProvider{}, &FederatedIdentity{},
+	&FederatedLoginState{}, &Group{},
+}
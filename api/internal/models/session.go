@@ -0,0 +1,43 @@
+package models
+
+import (
+	"auth-service/internal/utils"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Session is a first-party login on the authorization server, referenced by
+// the SSO cookie. Only a hash of the cookie value is stored.
+type Session struct {
+	ID         uuid.UUID  `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserID     uuid.UUID  `json:"user_id" gorm:"not null;type:uuid;index"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex;not null"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	AuthTime   time.Time  `json:"auth_time"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+
+	User User `json:"-" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
+
+func (s *Session) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsActive reports whether the session is neither revoked nor past its
+// absolute or idle timeout.
+func (s *Session) IsActive(idleTimeout time.Duration) bool {
+	now := utils.GetCurrentTS()
+	if s.RevokedAt != nil || now.After(s.ExpiresAt) {
+		return false
+	}
+	return now.Before(s.LastSeenAt.Add(idleTimeout))
+}
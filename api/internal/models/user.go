@@ -3,8 +3,9 @@ package models
 import (
 	"time"
 
+	"auth-service/internal/hashing"
+
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
@@ -17,6 +18,21 @@ type User struct {
 	Username  string    `json:"username" gorm:"uniqueIndex;not null"`
 	IsActive  bool      `json:"is_active" gorm:"default:true"`
 	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Set once the service has confirmed the user owns Email, through
+	// POST /auth/verify-email or an identity provider that verified it.
+	// Federated logins only link to accounts that have it.
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+
+	// Identifier assigned by the provisioning client (SCIM externalId)
+	ExternalID string `json:"external_id,omitempty" gorm:"index"`
+
+	// Set when the account is deactivated by its owner; images and blobs are
+	// purged once this date has passed.
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+
+	Roles []Role `json:"roles,omitempty" gorm:"many2many:user_roles;constraint:OnDelete:CASCADE"`
 }
 
 func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
@@ -32,12 +48,30 @@ func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
 	return nil
 }
 
-
 func (u *User) HashPassword(password string) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := hashing.Hash(password)
 	if err != nil {
 		return err
 	}
-	u.Password = string(hashedPassword)
+	u.Password = hashedPassword
 	return nil
 }
+
+func (u *User) CheckPassword(password string) bool {
+	return hashing.Verify(password, u.Password)
+}
+
+// PasswordNeedsRehash reports whether the stored hash predates the current
+// hashing settings.
+func (u *User) PasswordNeedsRehash() bool {
+	return hashing.NeedsRehash(u.Password)
+}
+
+func (u *User) HasPermission(name string) bool {
+	for _, role := range u.Roles {
+		if role.HasPermission(name) {
+			return true
+		}
+	}
+	return false
+}
@@ -8,16 +8,23 @@ import (
 
 	"auth-service/internal/models"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/lib/pq"
 	"gorm.io/gorm"
 )
 
 type RawClient struct {
-	Name         string `json:"name"`
-	ClientID     string `json:"client_id"`
-	ClientSecret string `json:"client_secret"`
+	Name         string   `json:"name"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	GrantTypes   []string `json:"grant_types"`
+	Public       bool     `json:"public"`
+	// Username of the consumer owning the client, created when missing
+	Consumer string `json:"consumer"`
 }
 
+// defaultConsumer owns the clients that do not name a consumer
+const defaultConsumer = "ccs-global-consumer"
+
 func SeedClients(db *gorm.DB, path string) error {
 
 	data, err := os.ReadFile(path)
@@ -34,33 +41,93 @@ func SeedClients(db *gorm.DB, path string) error {
 		var existing models.OAuth2Credential
 		err := db.Where("client_id = ?", raw.ClientID).First(&existing).Error 
 		if err == nil {
+			// Clients seeded before per client policies keep the grants
+			// the file asks for, the password grant has no default anymore
+			if len(existing.GrantTypes) == 0 && len(raw.GrantTypes) > 0 {
+				existing.GrantTypes = raw.GrantTypes
+				if err := existing.ValidatePolicy(); err != nil {
+					return fmt.Errorf("Invalid client %s: %w", raw.ClientID, err)
+				}
+				if err := db.Model(&existing).Update("grant_types", pq.StringArray(raw.GrantTypes)).Error; err != nil {
+					return fmt.Errorf("Failed to update client grants: %w", err)
+				}
+			}
 			continue
 		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
 			return fmt.Errorf("Failed to check existing client: %w", err)
 		}
 
-		hashed, err := bcrypt.GenerateFromPassword([]byte(raw.ClientSecret), bcrypt.DefaultCost)
-		if err != nil {
-			return fmt.Errorf("Failed to hash secret: %w", err)
+		// The global consumer keeps the custom_id it was first seeded with,
+		// other consumers get their username so custom_id stays unique
+		consumerName, customID := raw.Consumer, raw.Consumer
+		if consumerName == "" || consumerName == defaultConsumer {
+			consumerName, customID = defaultConsumer, "ccs-global-id"
 		}
 
 		var consumer models.Consumer
-		if err := db.FirstOrCreate(&consumer, models.Consumer{
-			Username: "ccs-global-consumer",
-			CustomID: "ccs-global-id",
-		}).Error; err != nil {
+		if err := db.Where(models.Consumer{Username: consumerName}).
+			Attrs(models.Consumer{CustomID: customID}).
+			FirstOrCreate(&consumer).Error; err != nil {
 			return fmt.Errorf("Missing consumer to associate client: %w", err)
 		}
 
 		client := models.OAuth2Credential{
-			Name:         raw.Name,
-			ClientID:     raw.ClientID,
-			ClientSecret: string(hashed),
-			ConsumerID:   consumer.ID,
+			Name:       raw.Name,
+			ClientID:   raw.ClientID,
+			ConsumerID: consumer.ID,
+			GrantTypes: raw.GrantTypes,
+			Public:     raw.Public,
 		}
+		if err := client.ValidatePolicy(); err != nil {
+			return fmt.Errorf("Invalid client %s: %w", raw.ClientID, err)
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&client).Error; err != nil {
+				return fmt.Errorf("Failed to create client: %w", err)
+			}
+			if client.Public {
+				return nil
+			}
 
-		if err := db.Create(&client).Error; err != nil {
-			return fmt.Errorf("Failed to create client: %w", err)
+			secret, err := models.NewClientSecret(client.ID, raw.ClientSecret, nil)
+			if err != nil {
+				return fmt.Errorf("Failed to hash secret: %w", err)
+			}
+			if err := tx.Create(secret).Error; err != nil {
+				return fmt.Errorf("Failed to create secret: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateClientSecrets moves the single secret hash clients had before secret
+// rotation into the secrets table. It does nothing once every client has been
+// migrated.
+func MigrateClientSecrets(db *gorm.DB) error {
+	var clients []models.OAuth2Credential
+	if err := db.Where("client_secret <> ''").Find(&clients).Error; err != nil {
+		return fmt.Errorf("Failed to fetch clients: %w", err)
+	}
+
+	for _, client := range clients {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			secret := models.ClientSecret{
+				CredentialID: client.ID,
+				SecretHash:   client.ClientSecret,
+			}
+			if err := tx.Create(&secret).Error; err != nil {
+				return err
+			}
+			return tx.Model(&client).Update("client_secret", "").Error
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to migrate secret of client %s: %w", client.ClientID, err)
 		}
 	}
 	return nil
@@ -0,0 +1,103 @@
+package seeds
+
+import (
+	"fmt"
+
+	"auth-service/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var permissionDescriptions = map[string]string{
+	models.PermissionClientsRead:    "List and view OAuth2 clients",
+	models.PermissionClientsWrite:   "Create, update and delete OAuth2 clients",
+	models.PermissionConsumersRead:  "List and view consumers",
+	models.PermissionConsumersWrite: "Create, update and delete consumers",
+	models.PermissionTokensRead:     "List and view issued tokens",
+	models.PermissionTokensWrite:    "Create and update tokens for any user",
+	models.PermissionTokensRevoke:   "Revoke tokens",
+	models.PermissionUsersRead:      "List and view user accounts",
+	models.PermissionUsersWrite:     "Create, update and deactivate user accounts",
+	models.PermissionRolesWrite:     "Assign and remove user roles",
+	models.PermissionImagesReadAll:  "Read images owned by any user",
+	models.PermissionImagesWrite:    "Store images with a segmentation that did not come from the model",
+	models.PermissionMetricsRead:    "Read the service metrics",
+
+	models.PermissionIdentityProvidersWrite: "Configure upstream identity providers",
+}
+
+var defaultRoles = []struct {
+	Name        string
+	Description string
+	Permissions []string
+}{
+	{
+		Name:        models.RoleAdmin,
+		Description: "Full access to the admin API",
+		Permissions: []string{
+			models.PermissionClientsRead, models.PermissionClientsWrite,
+			models.PermissionConsumersRead, models.PermissionConsumersWrite,
+			models.PermissionTokensRead, models.PermissionTokensWrite,
+			models.PermissionTokensRevoke,
+			models.PermissionUsersRead, models.PermissionUsersWrite,
+			models.PermissionRolesWrite, models.PermissionImagesReadAll,
+			models.PermissionImagesWrite,
+			models.PermissionMetricsRead, models.PermissionIdentityProvidersWrite,
+		},
+	},
+	{
+		Name:        models.RoleOperator,
+		Description: "Read access to the admin API and token revocation",
+		// No tokens:write, it mints tokens for any user and an operator could
+		// issue itself an admin token
+		Permissions: []string{
+			models.PermissionClientsRead, models.PermissionConsumersRead,
+			models.PermissionTokensRead, models.PermissionTokensRevoke,
+			models.PermissionUsersRead, models.PermissionMetricsRead,
+		},
+	},
+	{
+		Name:        models.RoleUser,
+		Description: "Regular account, owns its own images",
+		Permissions: []string{},
+	},
+}
+
+// SeedRoles makes sure the built-in roles and permissions exist. Permissions
+// added to a built-in role by hand are kept.
+func SeedRoles(db *gorm.DB) error {
+	permissions := map[string]models.Permission{}
+	for name, description := range permissionDescriptions {
+		var permission models.Permission
+		if err := db.Where(models.Permission{Name: name}).
+			Attrs(models.Permission{Description: description}).
+			FirstOrCreate(&permission).Error; err != nil {
+			return fmt.Errorf("Failed to seed permission %s: %w", name, err)
+		}
+		permissions[name] = permission
+	}
+
+	for _, raw := range defaultRoles {
+		var role models.Role
+		if err := db.Preload("Permissions").Where(models.Role{Name: raw.Name}).
+			Attrs(models.Role{Description: raw.Description}).
+			FirstOrCreate(&role).Error; err != nil {
+			return fmt.Errorf("Failed to seed role %s: %w", raw.Name, err)
+		}
+
+		var missing []models.Permission
+		for _, name := range raw.Permissions {
+			if !role.HasPermission(name) {
+				missing = append(missing, permissions[name])
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		if err := db.Model(&role).Association("Permissions").Append(missing); err != nil {
+			return fmt.Errorf("Failed to grant permissions to role %s: %w", raw.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"auth-service/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrUnknownUser is returned by an Authenticator that has no account for the
+// identifier, letting a fallback authenticator try instead.
+var ErrUnknownUser = errors.New("unknown user")
+
+// Authenticator checks a login identifier (usually the email) and password
+// and returns the matching local user.
+type Authenticator interface {
+	Authenticate(ctx context.Context, identifier, password string) (*models.User, error)
+}
+
+// LocalAuthenticator checks credentials against the password hashes in the
+// users table.
+type LocalAuthenticator struct {
+	db *gorm.DB
+}
+
+func NewLocalAuthenticator(db *gorm.DB) *LocalAuthenticator {
+	return &LocalAuthenticator{db: db}
+}
+
+func (a *LocalAuthenticator) Authenticate(ctx context.Context, identifier, password string) (*models.User, error) {
+	var user models.User
+	if err := a.db.WithContext(ctx).Where("email = ?", identifier).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrUnknownUser
+		}
+		return nil, errors.New("failed to fetch user")
+	}
+
+	if !user.CheckPassword(password) {
+		return nil, errors.New("invalid credentials")
+	}
+
+	if !user.IsActive {
+		return nil, errors.New("user is inactive")
+	}
+
+	// The plain password is only available now, so this is where hashes made
+	// with older settings get upgraded
+	if user.PasswordNeedsRehash() {
+		if err := user.HashPassword(password); err == nil {
+			if err := a.db.WithContext(ctx).Model(&user).Update("password", user.Password).Error; err != nil {
+				log.Println("Failed to rehash password:", err)
+			}
+		}
+	}
+
+	return &user, nil
+}
+
+// ChainAuthenticator tries each authenticator in order, moving on only when
+// one does not know the user or cannot be reached.
+type ChainAuthenticator struct {
+	authenticators []Authenticator
+}
+
+func NewChainAuthenticator(authenticators ...Authenticator) *ChainAuthenticator {
+	return &ChainAuthenticator{authenticators: authenticators}
+}
+
+func (a *ChainAuthenticator) Authenticate(ctx context.Context, identifier, password string) (*models.User, error) {
+	for _, authenticator := range a.authenticators {
+		user, err := authenticator.Authenticate(ctx, identifier, password)
+		switch {
+		case err == nil:
+			return user, nil
+		case errors.Is(err, ErrUnknownUser):
+			continue
+		case errors.Is(err, ErrDirectoryUnavailable):
+			log.Println("Directory unavailable, falling back:", err)
+			continue
+		default:
+			return nil, err
+		}
+	}
+
+	return nil, errors.New("invalid credentials")
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+var breachedFilterMagic = [8]byte{'C', 'C', 'S', 'B', 'L', 'O', 'O', 'M'}
+
+// BreachedPasswordFilter is a bloom filter over the SHA-1 digests of breached
+// passwords. It answers "possibly breached" or "definitely not breached"
+// without keeping the corpus, or reaching the network, at runtime. Keys are
+// SHA-1 digests so it can be built straight from the Have I Been Pwned hash
+// lists as well as from plain text password lists.
+type BreachedPasswordFilter struct {
+	bits   []uint64
+	size   uint64
+	hashes uint32
+}
+
+// NewBreachedPasswordFilter sizes a filter for the expected number of entries
+// and false positive rate.
+func NewBreachedPasswordFilter(expected uint64, falsePositiveRate float64) *BreachedPasswordFilter {
+	if expected == 0 {
+		expected = 1
+	}
+	size := uint64(math.Ceil(-float64(expected) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	hashes := uint32(math.Max(1, math.Round(float64(size)/float64(expected)*math.Ln2)))
+
+	return &BreachedPasswordFilter{
+		bits:   make([]uint64, (size+63)/64),
+		size:   size,
+		hashes: hashes,
+	}
+}
+
+// LoadBreachedPasswordFilter reads a filter written by WriteTo.
+func LoadBreachedPasswordFilter(path string) (*BreachedPasswordFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	var header struct {
+		Magic  [8]byte
+		Size   uint64
+		Hashes uint32
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("failed to read filter header: %w", err)
+	}
+	if header.Magic != breachedFilterMagic || header.Size == 0 || header.Hashes == 0 {
+		return nil, errors.New("not a breached password filter")
+	}
+
+	filter := &BreachedPasswordFilter{
+		bits:   make([]uint64, (header.Size+63)/64),
+		size:   header.Size,
+		hashes: header.Hashes,
+	}
+	if err := binary.Read(reader, binary.LittleEndian, filter.bits); err != nil {
+		return nil, fmt.Errorf("failed to read filter: %w", err)
+	}
+
+	return filter, nil
+}
+
+// WriteTo stores the filter in the format LoadBreachedPasswordFilter reads.
+func (f *BreachedPasswordFilter) WriteTo(w io.Writer) (int64, error) {
+	writer := bufio.NewWriter(w)
+	header := struct {
+		Magic  [8]byte
+		Size   uint64
+		Hashes uint32
+	}{breachedFilterMagic, f.size, f.hashes}
+
+	if err := binary.Write(writer, binary.LittleEndian, header); err != nil {
+		return 0, err
+	}
+	if err := binary.Write(writer, binary.LittleEndian, f.bits); err != nil {
+		return 0, err
+	}
+	if err := writer.Flush(); err != nil {
+		return 0, err
+	}
+
+	return int64(binary.Size(header) + 8*len(f.bits)), nil
+}
+
+func (f *BreachedPasswordFilter) Add(password string) {
+	f.AddDigest(sha1.Sum([]byte(password)))
+}
+
+func (f *BreachedPasswordFilter) AddDigest(digest [sha1.Size]byte) {
+	for _, bit := range f.positions(digest) {
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// Contains reports whether the password may be in the corpus. False positives
+// happen at the rate the filter was built for, false negatives never do.
+func (f *BreachedPasswordFilter) Contains(password string) bool {
+	for _, bit := range f.positions(sha1.Sum([]byte(password))) {
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// positions derives the bit indexes by double hashing. SHA-1 output is
+// uniform, so two halves of the digest serve as independent hashes.
+func (f *BreachedPasswordFilter) positions(digest [sha1.Size]byte) []uint64 {
+	h1 := binary.BigEndian.Uint64(digest[0:8])
+	h2 := binary.BigEndian.Uint64(digest[8:16]) | 1
+
+	positions := make([]uint64, f.hashes)
+	for i := range positions {
+		positions[i] = (h1 + uint64(i)*h2) % f.size
+	}
+	return positions
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFilter(t *testing.T, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "breached.bloom")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBreachedPasswordFilterRoundTrip(t *testing.T) {
+	filter := NewBreachedPasswordFilter(1000, 0.001)
+	breached := []string{"password", "123456", "qwerty", "contraseña"}
+	for _, password := range breached {
+		filter.Add(password)
+	}
+	// HIBP lists give the digest instead of the password
+	filter.AddDigest(sha1.Sum([]byte("letmein")))
+
+	var buf bytes.Buffer
+	written, err := filter.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != int64(buf.Len()) {
+		t.Errorf("WriteTo reported %d bytes, wrote %d", written, buf.Len())
+	}
+
+	loaded, err := LoadBreachedPasswordFilter(writeTestFilter(t, buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.size != filter.size || loaded.hashes != filter.hashes {
+		t.Errorf("loaded size %d with %d hashes, want %d with %d", loaded.size, loaded.hashes, filter.size, filter.hashes)
+	}
+	for _, password := range append(breached, "letmein") {
+		if !loaded.Contains(password) {
+			t.Errorf("%q lost in the round trip", password)
+		}
+	}
+
+	// With 1000 slots and a 0.1% rate, hardly any unrelated password matches
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if loaded.Contains(fmt.Sprintf("unrelated-%d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 10 {
+		t.Errorf("%d false positives out of 10000", falsePositives)
+	}
+}
+
+func TestLoadBreachedPasswordFilterRejects(t *testing.T) {
+	var valid bytes.Buffer
+	if _, err := NewBreachedPasswordFilter(10, 0.01).WriteTo(&valid); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"other file", append([]byte("PK\x03\x04"), valid.Bytes()[4:]...)},
+		{"truncated header", valid.Bytes()[:10]},
+		{"truncated bits", valid.Bytes()[:valid.Len()-1]},
+		// The same header with zero hashes would accept every password
+		{"zero hashes", append(append(append([]byte{}, valid.Bytes()[:16]...), 0, 0, 0, 0), valid.Bytes()[20:]...)},
+	}
+
+	for _, tc := range cases {
+		if _, err := LoadBreachedPasswordFilter(writeTestFilter(t, tc.data)); err == nil {
+			t.Errorf("%s: loaded", tc.name)
+		}
+	}
+
+	if _, err := LoadBreachedPasswordFilter(filepath.Join(t.TempDir(), "missing.bloom")); err == nil {
+		t.Error("missing file: loaded")
+	}
+}
@@ -0,0 +1,627 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"auth-service/internal/config"
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// ClientService manages the OAuth2 clients and the Kong consumers they belong
+// to for the admin API.
+type ClientService struct {
+	db     *gorm.DB
+	config *config.Config
+}
+
+func NewClientService(db *gorm.DB, cfg *config.Config) *ClientService {
+	return &ClientService{
+		db:     db,
+		config: cfg,
+	}
+}
+
+type CreateClientRequest struct {
+	Name         string    `json:"name" binding:"required"`
+	ClientID     string    `json:"client_id"`
+	ClientSecret string    `json:"client_secret"`
+	RedirectURIs []string  `json:"redirect_uris" binding:"required" swaggertype:"array,string"`
+	ConsumerID   uuid.UUID `json:"consumer_id" binding:"required"`
+	ClientPolicyFields
+}
+
+// ClientPolicyFields are the per client OAuth2 settings, left empty they use
+// the defaults from the environment.
+type ClientPolicyFields struct {
+	GrantTypes         []string `json:"grant_types,omitempty" swaggertype:"array,string"`
+	ResponseTypes      []string `json:"response_types,omitempty" swaggertype:"array,string"`
+	Public             bool     `json:"public,omitempty"`
+	RequirePKCE        bool     `json:"require_pkce,omitempty"`
+	AccessTokenTTL     int      `json:"access_token_ttl,omitempty"`
+	RefreshTokenTTL    int      `json:"refresh_token_ttl,omitempty"`
+	AuthCodeTTL        int      `json:"auth_code_ttl,omitempty"`
+	RefreshTokenPolicy string   `json:"refresh_token_policy,omitempty"`
+}
+
+// UpdateClientRequest lists the only client fields that can be changed after
+// creation. Credentials and the owning consumer are deliberately left out.
+type UpdateClientRequest struct {
+	Name         *string   `json:"name,omitempty"`
+	RedirectURIs *[]string `json:"redirect_uris,omitempty" swaggertype:"array,string"`
+
+	// An empty list, 0 or "" sets the field back to the default
+	GrantTypes         *[]string `json:"grant_types,omitempty" swaggertype:"array,string"`
+	ResponseTypes      *[]string `json:"response_types,omitempty" swaggertype:"array,string"`
+	Public             *bool     `json:"public,omitempty"`
+	RequirePKCE        *bool     `json:"require_pkce,omitempty"`
+	AccessTokenTTL     *int      `json:"access_token_ttl,omitempty"`
+	RefreshTokenTTL    *int      `json:"refresh_token_ttl,omitempty"`
+	AuthCodeTTL        *int      `json:"auth_code_ttl,omitempty"`
+	RefreshTokenPolicy *string   `json:"refresh_token_policy,omitempty"`
+}
+
+type RotateSecretRequest struct {
+	// Seconds until the new secret expires, it never does when left out
+	ExpiresIn *int `json:"expires_in,omitempty"`
+	// Seconds the current secrets keep working, defaults to
+	// CLIENT_SECRET_ROTATION_OVERLAP; 0 revokes them at once
+	PreviousExpiresIn *int `json:"previous_expires_in,omitempty"`
+}
+
+// CreatedClient is the only response that carries the plain client secret.
+type CreatedClient struct {
+	*models.OAuth2Credential
+	Secret string `json:"client_secret,omitempty"`
+}
+
+// IssuedSecret is the only response that carries a rotated plain secret.
+type IssuedSecret struct {
+	*models.ClientSecret
+	Secret string `json:"client_secret"`
+}
+
+type CreateConsumerRequest struct {
+	Username string            `json:"username" binding:"required"`
+	CustomID string            `json:"custom_id"`
+	Tags     []string          `json:"tags" swaggertype:"array,string"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// UpdateConsumerRequest replaces the fields that are present. Tags and
+// metadata are replaced as a whole, not merged.
+type UpdateConsumerRequest struct {
+	Username *string            `json:"username,omitempty"`
+	CustomID *string            `json:"custom_id,omitempty"`
+	Tags     *[]string          `json:"tags,omitempty" swaggertype:"array,string"`
+	Metadata *map[string]string `json:"metadata,omitempty"`
+}
+
+// ClientFilter narrows ListClients, empty fields match every client.
+type ClientFilter struct {
+	ConsumerID *uuid.UUID
+	// Part of the name, case insensitive
+	Name   string
+	Limit  int
+	Offset int
+}
+
+// ConsumerFilter narrows ListConsumers, empty fields match every consumer.
+type ConsumerFilter struct {
+	Username string
+	CustomID string
+	// Consumers must carry every one of these tags
+	Tags   []string
+	Limit  int
+	Offset int
+}
+
+// ConsumerToken is an active token of one of a consumer's clients, with the
+// token values redacted.
+type ConsumerToken struct {
+	ID                     uuid.UUID `json:"id"`
+	ClientID               string    `json:"client_id"`
+	AuthenticatedUserID    string    `json:"authenticated_userid,omitempty"`
+	AccessToken            string    `json:"access_token"`
+	Scope                  string    `json:"scope,omitempty"`
+	AccessTokenExpiration  time.Time `json:"access_token_expiration"`
+	RefreshTokenExpiration time.Time `json:"refresh_token_expiration"`
+}
+
+func (s *ClientService) ListClients(filter *ClientFilter) ([]models.OAuth2Credential, int64, error) {
+	query := s.db.Model(&models.OAuth2Credential{})
+	if filter.ConsumerID != nil {
+		query = query.Where("consumer_id = ?", *filter.ConsumerID)
+	}
+	if filter.Name != "" {
+		query = query.Where("name ILIKE ?", "%"+escapeLike(filter.Name)+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, errors.New("failed to fetch clients")
+	}
+
+	var clients []models.OAuth2Credential
+	if err := query.Preload("Consumer").Order("created_at").
+		Limit(filter.Limit).Offset(filter.Offset).Find(&clients).Error; err != nil {
+		return nil, 0, errors.New("failed to fetch clients")
+	}
+	return clients, total, nil
+}
+
+func (s *ClientService) GetClient(clientID string) (*models.OAuth2Credential, error) {
+	var client models.OAuth2Credential
+	err := s.db.Preload("Consumer").
+		Preload("Secrets", func(db *gorm.DB) *gorm.DB { return db.Order("created_at") }).
+		Where("client_id = ?", clientID).First(&client).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("client not found")
+		}
+		return nil, errors.New("failed to fetch client")
+	}
+	return &client, nil
+}
+
+// CreateClient registers a client. When no secret is given one is generated
+// and returned in plain text this one time only. Public clients get no
+// secret at all.
+func (s *ClientService) CreateClient(req *CreateClientRequest) (*CreatedClient, error) {
+	if err := validateRedirectURIs(req.RedirectURIs); err != nil {
+		return nil, err
+	}
+
+	client := &models.OAuth2Credential{
+		Name:               req.Name,
+		ClientID:           req.ClientID,
+		RedirectURIs:       req.RedirectURIs,
+		ConsumerID:         req.ConsumerID,
+		GrantTypes:         req.GrantTypes,
+		ResponseTypes:      req.ResponseTypes,
+		Public:             req.Public,
+		RequirePKCE:        req.RequirePKCE,
+		AccessTokenTTL:     req.AccessTokenTTL,
+		RefreshTokenTTL:    req.RefreshTokenTTL,
+		AuthCodeTTL:        req.AuthCodeTTL,
+		RefreshTokenPolicy: req.RefreshTokenPolicy,
+	}
+	if err := client.ValidatePolicy(); err != nil {
+		return nil, err
+	}
+	if req.Public && req.ClientSecret != "" {
+		return nil, errors.New("public clients cannot have a secret")
+	}
+
+	if _, err := s.GetConsumer(req.ConsumerID.String()); err != nil {
+		return nil, err
+	}
+
+	if req.ClientID != "" {
+		var count int64
+		if err := s.db.Model(&models.OAuth2Credential{}).Where("client_id = ?", req.ClientID).Count(&count).Error; err != nil {
+			return nil, errors.New("failed to fetch client")
+		}
+		if count > 0 {
+			return nil, errors.New("client already exists")
+		}
+	}
+
+	plain, generated := req.ClientSecret, false
+	if plain == "" && !req.Public {
+		secret, err := randomURLToken()
+		if err != nil {
+			return nil, errors.New("failed to generate client secret")
+		}
+		plain, generated = secret, true
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(client).Error; err != nil {
+			return err
+		}
+		if req.Public {
+			return nil
+		}
+
+		secret, err := models.NewClientSecret(client.ID, plain, nil)
+		if err != nil {
+			return err
+		}
+		return tx.Create(secret).Error
+	})
+	if err != nil {
+		return nil, errors.New("failed to create client")
+	}
+
+	created, err := s.GetClient(client.ClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &CreatedClient{OAuth2Credential: created}
+	if generated {
+		response.Secret = plain
+	}
+	return response, nil
+}
+
+// RotateSecret issues a new secret and sets the current ones to expire after
+// the overlap, so deployments can switch secrets without downtime.
+func (s *ClientService) RotateSecret(clientID string, req *RotateSecretRequest) (*IssuedSecret, error) {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client.Public {
+		return nil, errors.New("public clients cannot have a secret")
+	}
+
+	overlap := s.config.OAuth2.ClientSecretRotationOverlap
+	if req.PreviousExpiresIn != nil {
+		overlap = *req.PreviousExpiresIn
+	}
+	if overlap < 0 || (req.ExpiresIn != nil && *req.ExpiresIn <= 0) {
+		return nil, errors.New("invalid expiration")
+	}
+
+	now := utils.GetCurrentTS()
+	previousExpiry := now.Add(time.Duration(overlap) * time.Second)
+
+	var expiresAt *time.Time
+	if req.ExpiresIn != nil {
+		expiry := now.Add(time.Duration(*req.ExpiresIn) * time.Second)
+		expiresAt = &expiry
+	}
+
+	plain, err := randomURLToken()
+	if err != nil {
+		return nil, errors.New("failed to generate client secret")
+	}
+	secret, err := models.NewClientSecret(client.ID, plain, expiresAt)
+	if err != nil {
+		return nil, errors.New("failed to generate client secret")
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Secrets already due to expire sooner keep their expiry
+		if err := tx.Model(&models.ClientSecret{}).
+			Where("credential_id = ? AND (expires_at IS NULL OR expires_at > ?)", client.ID, previousExpiry).
+			Update("expires_at", previousExpiry).Error; err != nil {
+			return err
+		}
+		return tx.Create(secret).Error
+	})
+	if err != nil {
+		return nil, errors.New("failed to rotate client secret")
+	}
+
+	return &IssuedSecret{ClientSecret: secret, Secret: plain}, nil
+}
+
+// RevokeClientTokens deletes every token issued to a client and returns how
+// many there were.
+func (s *ClientService) RevokeClientTokens(clientID string) (int64, error) {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return 0, err
+	}
+
+	result := s.db.Where("credential_id = ?", client.ID).Delete(&models.OAuth2Token{})
+	if result.Error != nil {
+		return 0, errors.New("failed to revoke tokens")
+	}
+	return result.RowsAffected, nil
+}
+
+// RevokeSecret expires one secret immediately.
+func (s *ClientService) RevokeSecret(clientID string, secretID uuid.UUID) error {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return err
+	}
+
+	result := s.db.Model(&models.ClientSecret{}).
+		Where("id = ? AND credential_id = ?", secretID, client.ID).
+		Update("expires_at", utils.GetCurrentTS())
+	if result.Error != nil {
+		return errors.New("failed to revoke client secret")
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("secret not found")
+	}
+	return nil
+}
+
+func (s *ClientService) UpdateClient(clientID string, req *UpdateClientRequest) (*models.OAuth2Credential, error) {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		if *req.Name == "" {
+			return nil, errors.New("name cannot be empty")
+		}
+		updates["name"] = *req.Name
+	}
+	if req.RedirectURIs != nil {
+		if err := validateRedirectURIs(*req.RedirectURIs); err != nil {
+			return nil, err
+		}
+		updates["redirect_uris"] = pq.StringArray(*req.RedirectURIs)
+	}
+
+	// The policy is checked as a whole, e.g. a client cannot turn public
+	// while it still has the client_credentials grant
+	policy := *client
+	if req.GrantTypes != nil {
+		policy.GrantTypes = *req.GrantTypes
+		updates["grant_types"] = pq.StringArray(*req.GrantTypes)
+	}
+	if req.ResponseTypes != nil {
+		policy.ResponseTypes = *req.ResponseTypes
+		updates["response_types"] = pq.StringArray(*req.ResponseTypes)
+	}
+	if req.Public != nil {
+		policy.Public = *req.Public
+		updates["public"] = *req.Public
+	}
+	if req.RequirePKCE != nil {
+		policy.RequirePKCE = *req.RequirePKCE
+		updates["require_pkce"] = *req.RequirePKCE
+	}
+	if req.AccessTokenTTL != nil {
+		policy.AccessTokenTTL = *req.AccessTokenTTL
+		updates["access_token_ttl"] = *req.AccessTokenTTL
+	}
+	if req.RefreshTokenTTL != nil {
+		policy.RefreshTokenTTL = *req.RefreshTokenTTL
+		updates["refresh_token_ttl"] = *req.RefreshTokenTTL
+	}
+	if req.AuthCodeTTL != nil {
+		policy.AuthCodeTTL = *req.AuthCodeTTL
+		updates["auth_code_ttl"] = *req.AuthCodeTTL
+	}
+	if req.RefreshTokenPolicy != nil {
+		policy.RefreshTokenPolicy = *req.RefreshTokenPolicy
+		updates["refresh_token_policy"] = *req.RefreshTokenPolicy
+	}
+	if err := policy.ValidatePolicy(); err != nil {
+		return nil, err
+	}
+
+	if len(updates) > 0 {
+		if err := s.db.Model(client).Updates(updates).Error; err != nil {
+			return nil, errors.New("failed to update client")
+		}
+	}
+
+	return s.GetClient(clientID)
+}
+
+// DeleteClient removes a client together with its secrets, tokens and
+// pending authorization codes.
+func (s *ClientService) DeleteClient(clientID string) error {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		return deleteClients(tx, []models.OAuth2Credential{*client})
+	}); err != nil {
+		return errors.New("failed to delete client")
+	}
+	return nil
+}
+
+func (s *ClientService) ListConsumers(filter *ConsumerFilter) ([]models.Consumer, int64, error) {
+	query := s.db.Model(&models.Consumer{})
+	if filter.Username != "" {
+		query = query.Where("username = ?", filter.Username)
+	}
+	if filter.CustomID != "" {
+		query = query.Where("custom_id = ?", filter.CustomID)
+	}
+	if len(filter.Tags) > 0 {
+		query = query.Where("tags @> ?", pq.StringArray(filter.Tags))
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, errors.New("failed to fetch consumers")
+	}
+
+	var consumers []models.Consumer
+	if err := query.Order("created_at").Limit(filter.Limit).Offset(filter.Offset).Find(&consumers).Error; err != nil {
+		return nil, 0, errors.New("failed to fetch consumers")
+	}
+	return consumers, total, nil
+}
+
+func (s *ClientService) GetConsumer(consumerID string) (*models.Consumer, error) {
+	id, err := uuid.Parse(consumerID)
+	if err != nil {
+		return nil, errors.New("consumer not found")
+	}
+
+	var consumer models.Consumer
+	if err := s.db.Where("id = ?", id).First(&consumer).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("consumer not found")
+		}
+		return nil, errors.New("failed to fetch consumer")
+	}
+	return &consumer, nil
+}
+
+func (s *ClientService) CreateConsumer(req *CreateConsumerRequest) (*models.Consumer, error) {
+	// Both columns are unique, an empty custom_id included
+	var count int64
+	if err := s.db.Model(&models.Consumer{}).
+		Where("username = ? OR custom_id = ?", req.Username, req.CustomID).
+		Count(&count).Error; err != nil {
+		return nil, errors.New("failed to fetch consumer")
+	}
+	if count > 0 {
+		return nil, errors.New("consumer already exists")
+	}
+
+	consumer := &models.Consumer{
+		Username: req.Username,
+		CustomID: req.CustomID,
+		Tags:     req.Tags,
+		Metadata: req.Metadata,
+	}
+	if err := s.db.Create(consumer).Error; err != nil {
+		return nil, errors.New("failed to create consumer")
+	}
+
+	return consumer, nil
+}
+
+func (s *ClientService) UpdateConsumer(consumerID string, req *UpdateConsumerRequest) (*models.Consumer, error) {
+	consumer, err := s.GetConsumer(consumerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Username != nil {
+		if *req.Username == "" {
+			return nil, errors.New("username cannot be empty")
+		}
+		consumer.Username = *req.Username
+	}
+	if req.CustomID != nil {
+		consumer.CustomID = *req.CustomID
+	}
+	if req.Tags != nil {
+		consumer.Tags = *req.Tags
+	}
+	if req.Metadata != nil {
+		consumer.Metadata = *req.Metadata
+	}
+
+	var count int64
+	if err := s.db.Model(&models.Consumer{}).
+		Where("id <> ? AND (username = ? OR custom_id = ?)", consumer.ID, consumer.Username, consumer.CustomID).
+		Count(&count).Error; err != nil {
+		return nil, errors.New("failed to fetch consumer")
+	}
+	if count > 0 {
+		return nil, errors.New("consumer already exists")
+	}
+
+	if err := s.db.Select("username", "custom_id", "tags", "metadata", "updated_at").Save(consumer).Error; err != nil {
+		return nil, errors.New("failed to update consumer")
+	}
+
+	return consumer, nil
+}
+
+// DeleteConsumer refuses to delete a consumer that still has clients unless
+// cascade is set, in which case the clients go with it.
+func (s *ClientService) DeleteConsumer(consumerID string, cascade bool) error {
+	consumer, err := s.GetConsumer(consumerID)
+	if err != nil {
+		return err
+	}
+
+	var clients []models.OAuth2Credential
+	if err := s.db.Where("consumer_id = ?", consumer.ID).Find(&clients).Error; err != nil {
+		return errors.New("failed to fetch clients")
+	}
+	if len(clients) > 0 && !cascade {
+		return errors.New("consumer has clients")
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := deleteClients(tx, clients); err != nil {
+			return err
+		}
+		return tx.Delete(consumer).Error
+	})
+	if err != nil {
+		return errors.New("failed to delete consumer")
+	}
+	return nil
+}
+
+// ListConsumerTokens lists the tokens of a consumer's clients whose access
+// token has not expired yet.
+func (s *ClientService) ListConsumerTokens(consumerID string, limit, offset int) ([]ConsumerToken, int64, error) {
+	consumer, err := s.GetConsumer(consumerID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := s.db.Model(&models.OAuth2Token{}).
+		Joins("JOIN oauth2_credentials ON oauth2_credentials.id = oauth2_tokens.credential_id").
+		Where("oauth2_credentials.consumer_id = ? AND oauth2_tokens.access_token_expiration > ?", consumer.ID, utils.GetCurrentTS())
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, errors.New("failed to fetch tokens")
+	}
+
+	var tokens []models.OAuth2Token
+	if err := query.Preload("Credential").Order("oauth2_tokens.created_at DESC").
+		Limit(limit).Offset(offset).Find(&tokens).Error; err != nil {
+		return nil, 0, errors.New("failed to fetch tokens")
+	}
+
+	views := make([]ConsumerToken, 0, len(tokens))
+	for _, token := range tokens {
+		views = append(views, ConsumerToken{
+			ID:                     token.ID,
+			ClientID:               token.Credential.ClientID,
+			AuthenticatedUserID:    token.AuthenticatedUserID,
+			AccessToken:            RedactToken(token.AccessToken),
+			Scope:                  token.Scope,
+			AccessTokenExpiration:  token.AccessTokenExpiration,
+			RefreshTokenExpiration: token.RefreshTokenExpiration,
+		})
+	}
+	return views, total, nil
+}
+
+// deleteClients removes clients and everything issued to them. Secrets go
+// through the foreign key, tokens and codes have to be removed here.
+func deleteClients(tx *gorm.DB, clients []models.OAuth2Credential) error {
+	if len(clients) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(clients))
+	clientIDs := make([]string, 0, len(clients))
+	for _, client := range clients {
+		ids = append(ids, client.ID)
+		clientIDs = append(clientIDs, client.ClientID)
+	}
+
+	if err := tx.Where("credential_id IN ?", ids).Delete(&models.OAuth2Token{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("client_id IN ?", clientIDs).Delete(&models.AuthorizationCode{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("id IN ?", ids).Delete(&models.OAuth2Credential{}).Error
+}
+
+func validateRedirectURIs(uris []string) error {
+	for _, raw := range uris {
+		parsed, err := url.Parse(raw)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" || parsed.Fragment != "" {
+			return errors.New("invalid redirect_uri")
+		}
+	}
+	return nil
+}
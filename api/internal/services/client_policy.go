@@ -0,0 +1,91 @@
+package services
+
+import (
+	"slices"
+	"time"
+
+	"auth-service/internal/config"
+	"auth-service/internal/models"
+)
+
+// ClientPolicy is the OAuth2 policy in effect for one client, its own
+// settings merged with the defaults from the environment.
+type ClientPolicy struct {
+	GrantTypes         []string
+	ResponseTypes      []string
+	Public             bool
+	RequirePKCE        bool
+	AccessTokenTTL     time.Duration
+	RefreshTokenTTL    time.Duration
+	AuthCodeTTL        time.Duration
+	RefreshTokenPolicy string
+}
+
+func resolveClientPolicy(app *models.OAuth2Credential, defaults config.OAuth2Config) *ClientPolicy {
+	policy := &ClientPolicy{
+		GrantTypes:         app.GrantTypes,
+		ResponseTypes:      app.ResponseTypes,
+		Public:             app.Public,
+		RequirePKCE:        app.RequirePKCE || app.Public || defaults.PKCERequired,
+		AccessTokenTTL:     ttlOrDefault(app.AccessTokenTTL, defaults.AccessTokenExpiration),
+		RefreshTokenTTL:    ttlOrDefault(app.RefreshTokenTTL, defaults.RefreshTokenExpiration),
+		AuthCodeTTL:        ttlOrDefault(app.AuthCodeTTL, defaults.AuthCodeExpiration),
+		RefreshTokenPolicy: app.RefreshTokenPolicy,
+	}
+
+	// The password grant is never a default, it hands the user's password
+	// to the client and only first-party clients may ask for it
+	if len(policy.GrantTypes) == 0 {
+		policy.GrantTypes = nil
+		if defaults.EnableAuthorizationCode {
+			policy.GrantTypes = append(policy.GrantTypes, models.GrantAuthorizationCode)
+		}
+		if defaults.EnableClientCredentials && !app.Public {
+			policy.GrantTypes = append(policy.GrantTypes, models.GrantClientCredentials)
+		}
+	}
+
+	if len(policy.ResponseTypes) == 0 {
+		policy.ResponseTypes = nil
+		if slices.Contains(policy.GrantTypes, models.GrantAuthorizationCode) {
+			policy.ResponseTypes = append(policy.ResponseTypes, models.ResponseTypeCode)
+		}
+		if defaults.EnableImplicitGrant {
+			policy.ResponseTypes = append(policy.ResponseTypes, models.ResponseTypeToken)
+		}
+	}
+
+	if policy.RefreshTokenPolicy == "" {
+		policy.RefreshTokenPolicy = models.RefreshTokenRotate
+		if defaults.ReuseRefreshToken {
+			policy.RefreshTokenPolicy = models.RefreshTokenReuse
+		}
+	}
+
+	return policy
+}
+
+// AllowsGrant reports whether the client may use the grant at the token
+// endpoint.
+func (p *ClientPolicy) AllowsGrant(grantType string) bool {
+	if grantType == models.GrantRefreshToken {
+		return p.RefreshTokenPolicy != models.RefreshTokenNone
+	}
+	return slices.Contains(p.GrantTypes, grantType)
+}
+
+// AllowsResponseType also requires the authorization code grant for "code",
+// a code the client cannot exchange is of no use.
+func (p *ClientPolicy) AllowsResponseType(responseType string) bool {
+	if responseType == models.ResponseTypeCode && !p.AllowsGrant(models.GrantAuthorizationCode) {
+		return false
+	}
+	return slices.Contains(p.ResponseTypes, responseType)
+}
+
+func ttlOrDefault(seconds, fallback int) time.Duration {
+	if seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return time.Duration(fallback) * time.Second
+}
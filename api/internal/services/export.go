@@ -0,0 +1,535 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"auth-service/internal/config"
+	"auth-service/internal/models"
+	"auth-service/internal/storage"
+	"auth-service/internal/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type ExportService struct {
+	db         *gorm.DB
+	config     *config.Config
+	store      storage.BlobStore
+	httpClient *http.Client
+}
+
+func NewExportService(db *gorm.DB, cfg *config.Config, store storage.BlobStore) *ExportService {
+	return &ExportService{
+		db:         db,
+		config:     cfg,
+		store:      store,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type ExportManifest struct {
+	ExportID    uuid.UUID             `json:"export_id"`
+	UserID      uuid.UUID             `json:"user_id"`
+	GeneratedAt time.Time             `json:"generated_at"`
+	Files       []ExportManifestEntry `json:"files"`
+	Warnings    []string              `json:"warnings,omitempty"`
+}
+
+type ExportManifestEntry struct {
+	Path        string `json:"path"`
+	Description string `json:"description"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+}
+
+type exportedToken struct {
+	ID                     uuid.UUID `json:"id"`
+	ClientID               string    `json:"client_id"`
+	ClientName             string    `json:"client_name"`
+	AccessToken            string    `json:"access_token"`
+	RefreshToken           string    `json:"refresh_token,omitempty"`
+	Scope                  string    `json:"scope,omitempty"`
+	AccessTokenExpiration  time.Time `json:"access_token_expiration"`
+	RefreshTokenExpiration time.Time `json:"refresh_token_expiration"`
+}
+
+type exportedConsent struct {
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scopes     []string  `json:"scopes"`
+	GrantedAt  time.Time `json:"granted_at"`
+}
+
+// RequestExport creates a pending export for the user and starts building it
+// in the background.
+func (s *ExportService) RequestExport(userID uuid.UUID) (*models.ExportJob, error) {
+	var user models.User
+	if err := s.db.Where("id = ? AND is_active = ?", userID, true).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("user not found")
+		}
+		return nil, errors.New("failed to fetch user")
+	}
+
+	if err := s.failStaleExports(userID); err != nil {
+		return nil, errors.New("failed to check pending exports")
+	}
+
+	var running int64
+	if err := s.db.Model(&models.ExportJob{}).
+		Where("user_id = ? AND status IN ?", userID, []string{models.ExportStatusPending, models.ExportStatusRunning}).
+		Count(&running).Error; err != nil {
+		return nil, errors.New("failed to check pending exports")
+	}
+	if running > 0 {
+		return nil, errors.New("export already in progress")
+	}
+
+	job := &models.ExportJob{
+		UserID: userID,
+		Status: models.ExportStatusPending,
+	}
+	if err := s.db.Create(job).Error; err != nil {
+		return nil, errors.New("failed to create export")
+	}
+
+	go s.runExport(job.ID)
+
+	return job, nil
+}
+
+func (s *ExportService) GetExport(userID, exportID uuid.UUID) (*models.ExportJob, error) {
+	var job models.ExportJob
+	if err := s.db.Where("id = ? AND user_id = ?", exportID, userID).First(&job).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("export not found")
+		}
+		return nil, errors.New("failed to fetch export")
+	}
+
+	return &job, nil
+}
+
+// OpenDownload resolves a download token into the export archive. The caller
+// must close the returned object.
+func (s *ExportService) OpenDownload(ctx context.Context, token string) (*models.ExportJob, storage.Object, error) {
+	var job models.ExportJob
+	if err := s.db.Where("download_token = ?", token).First(&job).Error; err != nil {
+		return nil, nil, errors.New("export not found")
+	}
+
+	if !job.IsDownloadable() {
+		return nil, nil, errors.New("export not found")
+	}
+
+	obj, _, err := s.store.Get(ctx, job.ObjectName)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, errors.New("export not found")
+	}
+	if err != nil {
+		return nil, nil, errors.New("failed to open export")
+	}
+
+	return &job, obj, nil
+}
+
+// failStaleExports marks pending and running exports older than
+// EXPORT_JOB_TIMEOUT as failed, of one user or of everyone with uuid.Nil. The
+// goroutine building them died with the process that started it, otherwise
+// they would block new exports of their user forever.
+func (s *ExportService) failStaleExports(userID uuid.UUID) error {
+	cutoff := utils.GetCurrentTS().Add(-time.Duration(s.config.Export.JobTimeout) * time.Minute)
+	query := s.db.Model(&models.ExportJob{}).
+		Where("status IN ? AND created_at < ?", []string{models.ExportStatusPending, models.ExportStatusRunning}, cutoff)
+	if userID != uuid.Nil {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	return query.Updates(map[string]interface{}{
+		"status": models.ExportStatusFailed,
+		"error":  "export did not finish in time",
+	}).Error
+}
+
+// PurgeExpiredExports deletes the archive and the row of every export whose
+// link has expired, and of failed exports once they are as old as a link
+// would be. A failing export is logged and retried on the next run.
+func (s *ExportService) PurgeExpiredExports(ctx context.Context) (int, error) {
+	if err := s.failStaleExports(uuid.Nil); err != nil {
+		return 0, fmt.Errorf("failed to fail stale exports: %w", err)
+	}
+
+	now := utils.GetCurrentTS()
+	var jobs []models.ExportJob
+	if err := s.db.Where("(status = ? AND expires_at <= ?) OR (status = ? AND created_at <= ?)",
+		models.ExportStatusCompleted, now,
+		models.ExportStatusFailed, now.Add(-time.Duration(s.config.Export.LinkExpiration)*time.Hour)).
+		Find(&jobs).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch expired exports: %w", err)
+	}
+
+	purged := 0
+	for _, job := range jobs {
+		if err := removeExport(ctx, s.db, s.store, &job); err != nil {
+			log.Printf("Failed to purge export %s: %v", job.ID, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// StartCleanupWorker runs PurgeExpiredExports on the given interval until the
+// context is cancelled.
+func (s *ExportService) StartCleanupWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purged, err := s.PurgeExpiredExports(ctx)
+				if err != nil {
+					log.Println("Export cleanup failed:", err)
+				} else if purged > 0 {
+					log.Printf("Purged %d expired exports", purged)
+				}
+			}
+		}
+	}()
+}
+
+// removeUserExports deletes every export of a user, archive and row, for
+// account deletion
+func removeUserExports(ctx context.Context, db *gorm.DB, store storage.BlobStore, userID uuid.UUID) error {
+	var jobs []models.ExportJob
+	if err := db.Where("user_id = ?", userID).Find(&jobs).Error; err != nil {
+		return fmt.Errorf("failed to fetch exports: %w", err)
+	}
+
+	for _, job := range jobs {
+		if err := removeExport(ctx, db, store, &job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeExport deletes the archive before the row, so a failure leaves the
+// row behind to retry with
+func removeExport(ctx context.Context, db *gorm.DB, store storage.BlobStore, job *models.ExportJob) error {
+	if err := store.Delete(ctx, exportObjectName(job.ID)); err != nil {
+		return fmt.Errorf("failed to remove archive of export %s: %w", job.ID, err)
+	}
+	if err := db.Delete(job).Error; err != nil {
+		return fmt.Errorf("failed to delete export %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+func exportObjectName(exportID uuid.UUID) string {
+	return fmt.Sprintf("exports/%s.zip", exportID)
+}
+
+// DownloadURL is where the browser downloads a completed export. Like signed
+// blob URLs it is built from PUBLIC_URL, so it goes through Kong's API route.
+func (s *ExportService) DownloadURL(job *models.ExportJob) string {
+	return strings.TrimRight(s.config.PublicURL, "/") + "/api/v1/exports/" + job.DownloadToken
+}
+
+func (s *ExportService) runExport(exportID uuid.UUID) {
+	ctx := context.Background()
+
+	var job models.ExportJob
+	if err := s.db.Where("id = ?", exportID).First(&job).Error; err != nil {
+		log.Printf("Export %s vanished before it could run: %v", exportID, err)
+		return
+	}
+
+	// Every update below only applies while the job is still ours, a job
+	// that took longer than EXPORT_JOB_TIMEOUT has been marked failed
+	started := s.db.Model(&job).Where("status = ?", models.ExportStatusPending).Update("status", models.ExportStatusRunning)
+	if started.Error != nil || started.RowsAffected == 0 {
+		log.Printf("Export %s was no longer pending", job.ID)
+		return
+	}
+
+	size, err := s.buildExport(ctx, &job)
+	if err != nil {
+		log.Printf("Export %s failed: %v", job.ID, err)
+		s.db.Model(&job).Where("status = ?", models.ExportStatusRunning).Updates(map[string]interface{}{
+			"status": models.ExportStatusFailed,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	now := utils.GetCurrentTS()
+	expiresAt := now.Add(time.Duration(s.config.Export.LinkExpiration) * time.Hour)
+	completed := s.db.Model(&job).Where("status = ?", models.ExportStatusRunning).Updates(map[string]interface{}{
+		"status":       models.ExportStatusCompleted,
+		"object_name":  job.ObjectName,
+		"size":         size,
+		"completed_at": now,
+		"expires_at":   expiresAt,
+	})
+	if completed.Error != nil || completed.RowsAffected == 0 {
+		log.Printf("Export %s finished after it was marked failed, discarding the archive", job.ID)
+		if err := s.store.Delete(ctx, job.ObjectName); err != nil {
+			log.Printf("Failed to remove archive of export %s: %v", job.ID, err)
+		}
+	}
+}
+
+func (s *ExportService) buildExport(ctx context.Context, job *models.ExportJob) (int64, error) {
+	tmp, err := os.CreateTemp("", "export-*.zip")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	archive := zip.NewWriter(tmp)
+	manifest := &ExportManifest{
+		ExportID:    job.ID,
+		UserID:      job.UserID,
+		GeneratedAt: utils.GetCurrentTS(),
+	}
+
+	var user models.User
+	if err := s.db.Where("id = ?", job.UserID).First(&user).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch user: %w", err)
+	}
+	if err := writeJSONEntry(archive, manifest, "user.json", "Account record", user); err != nil {
+		return 0, err
+	}
+
+	var images []models.Image
+	if err := s.db.Unscoped().Preload("Inference.Digits").Where("user_id = ?", job.UserID).Order("created_at ASC").Find(&images).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch images: %w", err)
+	}
+	if err := writeJSONEntry(archive, manifest, "images.json", "Image records", images); err != nil {
+		return 0, err
+	}
+
+	for _, image := range images {
+		blobs := []struct {
+			id          uuid.UUID
+			description string
+		}{
+			{image.SentImageID, "Original drawing"},
+			{image.ReceivedImageID, "Inference result"},
+		}
+		for _, blob := range blobs {
+			objectName := fmt.Sprintf("%s.png", blob.id)
+			obj, _, err := s.store.Get(ctx, objectName)
+			if errors.Is(err, storage.ErrNotFound) {
+				manifest.Warnings = append(manifest.Warnings, fmt.Sprintf("blob %s is missing from storage", objectName))
+				continue
+			}
+			if err != nil {
+				return 0, fmt.Errorf("failed to get blob %s: %w", blob.id, err)
+			}
+			if err := writeEntry(archive, manifest, "images/"+objectName, blob.description, obj); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	var tokens []models.OAuth2Token
+	if err := s.db.Preload("Credential").
+		Where("authenticated_userid = ? AND refresh_token_expiration > ?", job.UserID.String(), utils.GetCurrentTS()).
+		Find(&tokens).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch tokens: %w", err)
+	}
+
+	exportedTokens := make([]exportedToken, len(tokens))
+	consents := map[string]*exportedConsent{}
+	for i, token := range tokens {
+		exportedTokens[i] = exportedToken{
+			ID:                     token.ID,
+			ClientID:               token.Credential.ClientID,
+			ClientName:             token.Credential.Name,
+			AccessToken:            RedactToken(token.AccessToken),
+			RefreshToken:           RedactToken(token.RefreshToken),
+			Scope:                  token.Scope,
+			AccessTokenExpiration:  token.AccessTokenExpiration,
+			RefreshTokenExpiration: token.RefreshTokenExpiration,
+		}
+
+		// There is no consent table yet, a client holding a live token for
+		// the user is what the user has agreed to.
+		grantedAt := time.UnixMilli(token.CreatedAt).UTC()
+		consent, ok := consents[token.Credential.ClientID]
+		if !ok {
+			consent = &exportedConsent{
+				ClientID:   token.Credential.ClientID,
+				ClientName: token.Credential.Name,
+				GrantedAt:  grantedAt,
+			}
+			consents[token.Credential.ClientID] = consent
+		}
+		if grantedAt.Before(consent.GrantedAt) {
+			consent.GrantedAt = grantedAt
+		}
+		consent.Scopes = appendUnique(consent.Scopes, token.Scope)
+	}
+	if err := writeJSONEntry(archive, manifest, "tokens.json", "Active tokens (redacted)", exportedTokens); err != nil {
+		return 0, err
+	}
+
+	consentList := make([]*exportedConsent, 0, len(consents))
+	for _, consent := range consents {
+		consentList = append(consentList, consent)
+	}
+	if err := writeJSONEntry(archive, manifest, "consents.json", "Clients with active access", consentList); err != nil {
+		return 0, err
+	}
+
+	gatewayLogs, err := s.fetchGatewayLogs(ctx, job.UserID)
+	if err != nil {
+		manifest.Warnings = append(manifest.Warnings, "gateway logs unavailable: "+err.Error())
+	} else if err := writeEntry(archive, manifest, "gateway_logs.json", "Gateway request logs", gatewayLogs); err != nil {
+		return 0, err
+	}
+
+	manifestFile, err := archive.Create("manifest.json")
+	if err != nil {
+		return 0, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	encoder := json.NewEncoder(manifestFile)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return 0, fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	if err := archive.Close(); err != nil {
+		return 0, fmt.Errorf("failed to finalize archive: %w", err)
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, fmt.Errorf("failed to size archive: %w", err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to rewind archive: %w", err)
+	}
+
+	job.ObjectName = exportObjectName(job.ID)
+	if err := s.store.Put(ctx, job.ObjectName, tmp, size, "application/zip"); err != nil {
+		return 0, fmt.Errorf("failed to upload archive: %w", err)
+	}
+
+	return size, nil
+}
+
+// fetchGatewayLogs asks the gateway logger for every request attributed to
+// the user. The raw JSON is returned so the logger's schema is kept as is.
+func (s *ExportService) fetchGatewayLogs(ctx context.Context, userID uuid.UUID) (io.Reader, error) {
+	endpoint := fmt.Sprintf("%s/logs?authenticated_userid=%s", s.config.Export.LoggerURL, url.QueryEscape(userID.String()))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.config.Export.LoggerToken)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("logger responded with %d", resp.StatusCode)
+	}
+
+	tmp, err := os.CreateTemp("", "export-logs-*.json")
+	if err != nil {
+		return nil, err
+	}
+	// Unlinked right away, the open descriptor keeps the data readable
+	os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+
+	return tmp, nil
+}
+
+func writeJSONEntry(archive *zip.Writer, manifest *ExportManifest, path, description string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	return writeEntry(archive, manifest, path, description, bytes.NewReader(data))
+}
+
+func writeEntry(archive *zip.Writer, manifest *ExportManifest, path, description string, src io.Reader) error {
+	if closer, ok := src.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	w, err := archive.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %w", path, err)
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(w, hash), src)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	manifest.Files = append(manifest.Files, ExportManifestEntry{
+		Path:        path,
+		Description: description,
+		Size:        size,
+		SHA256:      hex.EncodeToString(hash.Sum(nil)),
+	})
+	return nil
+}
+
+// RedactToken keeps only enough of a token for the user to recognise it
+func RedactToken(token string) string {
+	if token == "" {
+		return ""
+	}
+	if len(token) <= 8 {
+		return "********"
+	}
+	return token[:4] + "********" + token[len(token)-4:]
+}
+
+func appendUnique(values []string, value string) []string {
+	if value == "" {
+		return values
+	}
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
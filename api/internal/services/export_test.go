@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-service/internal/config"
+	"auth-service/internal/models"
+	"auth-service/internal/storage"
+	"auth-service/internal/testdb"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func newTestExportService(t *testing.T) (*ExportService, *gorm.DB, storage.BlobStore) {
+	t.Helper()
+
+	db := testdb.Open(t)
+	store := storage.NewMemoryStore()
+	cfg := &config.Config{
+		PublicURL: "https://gateway.test/api/v1/auth",
+		Export:    config.ExportConfig{LinkExpiration: 24, JobTimeout: 30},
+	}
+	return NewExportService(db, cfg, store), db, store
+}
+
+// waitForExport waits until the goroutine building an export is done with it
+func waitForExport(t *testing.T, db *gorm.DB, exportID uuid.UUID) models.ExportJob {
+	t.Helper()
+
+	var job models.ExportJob
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if err := db.First(&job, "id = ?", exportID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == models.ExportStatusCompleted || job.Status == models.ExportStatusFailed {
+			return job
+		}
+	}
+	t.Fatalf("export %s still %s", exportID, job.Status)
+	return job
+}
+
+func TestRequestExportFailsStaleJobs(t *testing.T) {
+	service, db, _ := newTestExportService(t)
+	userID := newTestUser(t, db)
+
+	stale := models.ExportJob{UserID: userID, Status: models.ExportStatusRunning, CreatedAt: time.Now().Add(-time.Hour)}
+	if err := db.Create(&stale).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := service.RequestExport(userID)
+	if err != nil {
+		t.Fatalf("stale export blocked a new one: %v", err)
+	}
+	if err := db.First(&stale, "id = ?", stale.ID).Error; err != nil || stale.Status != models.ExportStatusFailed {
+		t.Errorf("stale export is %s, want failed (err = %v)", stale.Status, err)
+	}
+
+	// A recent export still blocks the next one
+	if _, err := service.RequestExport(userID); err == nil || err.Error() != "export already in progress" {
+		t.Errorf("err = %v, want export already in progress", err)
+	}
+
+	if finished := waitForExport(t, db, job.ID); finished.Status != models.ExportStatusCompleted {
+		t.Errorf("export %s: %s", finished.Status, finished.Error)
+	}
+}
+
+func TestDownloadURLUsesPublicURL(t *testing.T) {
+	service, _, _ := newTestExportService(t)
+
+	url := service.DownloadURL(&models.ExportJob{DownloadToken: "token"})
+	if url != "https://gateway.test/api/v1/auth/api/v1/exports/token" {
+		t.Errorf("url = %s", url)
+	}
+}
+
+func TestPurgeExpiredExports(t *testing.T) {
+	service, db, store := newTestExportService(t)
+	userID := newTestUser(t, db)
+	ctx := context.Background()
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	jobs := map[string]*models.ExportJob{
+		"expired":     {UserID: userID, Status: models.ExportStatusCompleted, ExpiresAt: &past},
+		"live":        {UserID: userID, Status: models.ExportStatusCompleted, ExpiresAt: &future},
+		"old failure": {UserID: userID, Status: models.ExportStatusFailed, CreatedAt: time.Now().Add(-48 * time.Hour)},
+		"new failure": {UserID: userID, Status: models.ExportStatusFailed},
+	}
+	for name, job := range jobs {
+		if err := db.Create(job).Error; err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == models.ExportStatusCompleted {
+			if err := store.Put(ctx, exportObjectName(job.ID), strings.NewReader(name), int64(len(name)), "application/zip"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	purged, err := service.PurgeExpiredExports(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 2 {
+		t.Errorf("purged %d exports, want 2", purged)
+	}
+
+	for name, job := range jobs {
+		var count int64
+		db.Model(&models.ExportJob{}).Where("id = ?", job.ID).Count(&count)
+		kept := name == "live" || name == "new failure"
+		if (count == 1) != kept {
+			t.Errorf("%s: row kept = %v, want %v", name, count == 1, kept)
+		}
+	}
+	if keys := storedKeys(t, store); len(keys) != 1 || keys[0] != exportObjectName(jobs["live"].ID) {
+		t.Errorf("stored %v, want only the live archive", keys)
+	}
+}
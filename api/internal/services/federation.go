@@ -0,0 +1,501 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"auth-service/internal/config"
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+type FederationService struct {
+	db         *gorm.DB
+	config     *config.Config
+	httpClient *http.Client
+	providers  *oidcProviderCache
+}
+
+func NewFederationService(db *gorm.DB, cfg *config.Config) *FederationService {
+	return &FederationService{
+		db:         db,
+		config:     cfg,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		providers:  newOIDCProviderCache(),
+	}
+}
+
+type IdentityProviderRequest struct {
+	Slug          *string  `json:"slug,omitempty"`
+	Name          *string  `json:"name,omitempty"`
+	Issuer        *string  `json:"issuer,omitempty"`
+	ClientID      *string  `json:"client_id,omitempty"`
+	ClientSecret  *string  `json:"client_secret,omitempty"`
+	Scopes        []string `json:"scopes,omitempty"`
+	Enabled       *bool    `json:"enabled,omitempty"`
+	AutoProvision *bool    `json:"auto_provision,omitempty"`
+	EmailClaim    *string  `json:"email_claim,omitempty"`
+	NameClaim     *string  `json:"name_claim,omitempty"`
+	UsernameClaim *string  `json:"username_claim,omitempty"`
+}
+
+func (s *FederationService) ListProviders(enabledOnly bool) ([]models.IdentityProvider, error) {
+	var providers []models.IdentityProvider
+	query := s.db.Order("name ASC")
+	if enabledOnly {
+		query = query.Where("enabled = ?", true)
+	}
+	if err := query.Find(&providers).Error; err != nil {
+		return nil, errors.New("failed to fetch identity providers")
+	}
+	return providers, nil
+}
+
+func (s *FederationService) CreateProvider(req *IdentityProviderRequest) (*models.IdentityProvider, error) {
+	if req.Slug == nil || req.Name == nil || req.Issuer == nil || req.ClientID == nil || req.ClientSecret == nil {
+		return nil, errors.New("slug, name, issuer, client_id and client_secret are required")
+	}
+
+	provider := &models.IdentityProvider{
+		EmailClaim:    "email",
+		NameClaim:     "name",
+		UsernameClaim: "preferred_username",
+		Enabled:       true,
+		AutoProvision: true,
+	}
+	applyProviderRequest(provider, req)
+
+	if err := s.db.Create(provider).Error; err != nil {
+		var count int64
+		s.db.Model(&models.IdentityProvider{}).Where("slug = ?", provider.Slug).Count(&count)
+		if count > 0 {
+			return nil, errors.New("identity provider already exists")
+		}
+		return nil, errors.New("failed to create identity provider")
+	}
+
+	return provider, nil
+}
+
+func (s *FederationService) UpdateProvider(providerID uuid.UUID, req *IdentityProviderRequest) (*models.IdentityProvider, error) {
+	var provider models.IdentityProvider
+	if err := s.db.Where("id = ?", providerID).First(&provider).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("identity provider not found")
+		}
+		return nil, errors.New("failed to fetch identity provider")
+	}
+
+	applyProviderRequest(&provider, req)
+
+	if err := s.db.Save(&provider).Error; err != nil {
+		return nil, errors.New("failed to update identity provider")
+	}
+
+	return &provider, nil
+}
+
+func (s *FederationService) DeleteProvider(providerID uuid.UUID) error {
+	result := s.db.Where("id = ?", providerID).Delete(&models.IdentityProvider{})
+	if result.Error != nil {
+		return errors.New("failed to delete identity provider")
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("identity provider not found")
+	}
+
+	return nil
+}
+
+// BeginLogin prepares the redirect to the provider's authorization endpoint,
+// remembering state, nonce and PKCE verifier for the callback.
+func (s *FederationService) BeginLogin(ctx context.Context, slug, returnTo string) (string, error) {
+	provider, err := s.findEnabledProvider(slug)
+	if err != nil {
+		return "", err
+	}
+
+	discovery, err := s.providers.discover(ctx, s.httpClient, provider.Issuer)
+	if err != nil {
+		log.Printf("Identity provider %s unavailable: %v", provider.Slug, err)
+		return "", errors.New("identity provider unavailable")
+	}
+
+	state, err := randomURLToken()
+	if err != nil {
+		return "", errors.New("failed to start login")
+	}
+	nonce, err := randomURLToken()
+	if err != nil {
+		return "", errors.New("failed to start login")
+	}
+	verifier, err := randomURLToken()
+	if err != nil {
+		return "", errors.New("failed to start login")
+	}
+
+	loginState := &models.FederatedLoginState{
+		State:        state,
+		ProviderID:   provider.ID,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ReturnTo:     returnTo,
+	}
+	if err := s.db.Create(loginState).Error; err != nil {
+		return "", errors.New("failed to start login")
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+
+	authURL, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", errors.New("identity provider unavailable")
+	}
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.ClientID)
+	query.Set("redirect_uri", s.callbackURL(provider))
+	query.Set("scope", strings.Join(provider.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+
+	return authURL.String(), nil
+}
+
+// CompleteLogin exchanges the authorization code, verifies the ID token and
+// resolves the local user, linking or provisioning it when needed. It returns
+// the user and where the login should continue.
+func (s *FederationService) CompleteLogin(ctx context.Context, slug, state, code string) (*models.User, string, error) {
+	provider, err := s.findEnabledProvider(slug)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var loginState models.FederatedLoginState
+	if err := s.db.Where("state = ? AND provider_id = ?", state, provider.ID).First(&loginState).Error; err != nil {
+		return nil, "", errors.New("invalid login state")
+	}
+	// A state is single use, consumed even when the login fails below
+	if err := s.db.Delete(&loginState).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to consume login state: %w", err)
+	}
+	if loginState.IsExpired() {
+		return nil, "", errors.New("invalid login state")
+	}
+
+	discovery, err := s.providers.discover(ctx, s.httpClient, provider.Issuer)
+	if err != nil {
+		log.Printf("Identity provider %s unavailable: %v", provider.Slug, err)
+		return nil, "", errors.New("identity provider unavailable")
+	}
+
+	idToken, err := s.exchangeCode(ctx, provider, discovery, code, loginState.CodeVerifier)
+	if err != nil {
+		log.Printf("Code exchange with %s failed: %v", provider.Slug, err)
+		return nil, "", errors.New("identity provider rejected the login")
+	}
+
+	claims, err := s.providers.verifyIDToken(ctx, s.httpClient, discovery, idToken, provider.ClientID, loginState.Nonce)
+	if err != nil {
+		log.Printf("ID token from %s rejected: %v", provider.Slug, err)
+		return nil, "", errors.New("identity provider rejected the login")
+	}
+
+	user, err := s.resolveUser(provider, claims)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return user, loginState.ReturnTo, nil
+}
+
+// PurgeExpiredLoginStates deletes the login states of logins that never came
+// back from the provider
+func (s *FederationService) PurgeExpiredLoginStates() (int64, error) {
+	result := s.db.Where("expires_at <= ?", utils.GetCurrentTS()).Delete(&models.FederatedLoginState{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete expired login states: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// StartCleanupWorker runs PurgeExpiredLoginStates on the given interval until
+// the context is cancelled.
+func (s *FederationService) StartCleanupWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := s.PurgeExpiredLoginStates(); err != nil {
+					log.Println("Login state cleanup failed:", err)
+				}
+			}
+		}
+	}()
+}
+
+func (s *FederationService) exchangeCode(ctx context.Context, provider *models.IdentityProvider, discovery *oidcDiscovery, code, verifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", s.callbackURL(provider))
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(provider.ClientID), url.QueryEscape(provider.ClientSecret))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint responded with %d", resp.StatusCode)
+	}
+
+	var body struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.IDToken == "" {
+		return "", errors.New("token response has no id_token")
+	}
+
+	return body.IDToken, nil
+}
+
+// resolveUser finds the user linked to the subject. Otherwise, when the
+// provider verified the email, it links the existing account with that email,
+// if the service verified it as well, or provisions a new one.
+func (s *FederationService) resolveUser(provider *models.IdentityProvider, claims map[string]interface{}) (*models.User, error) {
+	subject, _ := claims["sub"].(string)
+	email, _ := claims[provider.EmailClaim].(string)
+	emailVerified, _ := claims["email_verified"].(bool)
+
+	var identity models.FederatedIdentity
+	err := s.db.Preload("User").Where("provider_id = ? AND subject = ?", provider.ID, subject).First(&identity).Error
+	if err == nil {
+		if !identity.User.IsActive {
+			return nil, errors.New("user is inactive")
+		}
+		s.db.Model(&identity).Updates(map[string]interface{}{
+			"email":         email,
+			"last_login_at": utils.GetCurrentTS(),
+		})
+		return &identity.User, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, errors.New("failed to fetch federated identity")
+	}
+
+	if email == "" {
+		return nil, errors.New("identity provider did not share an email")
+	}
+	// Linking or provisioning by email is only safe when the provider vouches
+	// for it, an account created with someone else's email would be linked
+	// to their later logins
+	if !emailVerified {
+		return nil, errors.New("email not verified by identity provider")
+	}
+
+	var user models.User
+	err = s.db.Where("email = ?", email).First(&user).Error
+	switch {
+	case err == nil:
+		// Local registration does not verify the email, whoever registered
+		// the address first could otherwise log in to the linked account
+		// with their own password
+		if user.EmailVerifiedAt == nil {
+			return nil, errors.New("account email not verified")
+		}
+		if !user.IsActive {
+			return nil, errors.New("user is inactive")
+		}
+	case err == gorm.ErrRecordNotFound:
+		if !provider.AutoProvision {
+			return nil, errors.New("no account linked to this identity")
+		}
+		provisioned, err := s.provisionUser(provider, claims, email)
+		if err != nil {
+			return nil, err
+		}
+		user = *provisioned
+	default:
+		return nil, errors.New("failed to fetch user")
+	}
+
+	identity = models.FederatedIdentity{
+		ProviderID:  provider.ID,
+		Subject:     subject,
+		UserID:      user.ID,
+		Email:       email,
+		LastLoginAt: utils.GetCurrentTS(),
+	}
+	if err := s.db.Create(&identity).Error; err != nil {
+		return nil, errors.New("failed to link federated identity")
+	}
+
+	return &user, nil
+}
+
+func (s *FederationService) provisionUser(provider *models.IdentityProvider, claims map[string]interface{}, email string) (*models.User, error) {
+	name, _ := claims[provider.NameClaim].(string)
+	if name == "" {
+		name = email
+	}
+
+	username, _ := claims[provider.UsernameClaim].(string)
+	if username == "" {
+		username = strings.Split(email, "@")[0]
+	}
+	username, err := availableUsername(s.db, username)
+	if err != nil {
+		return nil, err
+	}
+
+	// Federated users never log in with a local password
+	password, err := randomURLToken()
+	if err != nil {
+		return nil, errors.New("failed to provision user")
+	}
+
+	verifiedAt := utils.GetCurrentTS()
+	user := &models.User{
+		Email:           email,
+		Name:            name,
+		Username:        username,
+		Password:        password,
+		IsActive:        true,
+		EmailVerifiedAt: &verifiedAt,
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		var role models.Role
+		if err := tx.Where("name = ?", models.RoleUser).First(&role).Error; err == nil {
+			return tx.Model(user).Association("Roles").Append(&role)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.New("failed to provision user")
+	}
+
+	log.Printf("Provisioned user %s from identity provider %s", user.ID, provider.Slug)
+	return user, nil
+}
+
+// availableUsername returns base, or base with a random suffix when a user
+// already has it. Directory and identity provider users share it.
+func availableUsername(db *gorm.DB, base string) (string, error) {
+	candidate := base
+	for attempt := 0; attempt < 5; attempt++ {
+		var count int64
+		if err := db.Model(&models.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", errors.New("failed to provision user")
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+
+		suffix := make([]byte, 2)
+		if _, err := rand.Read(suffix); err != nil {
+			return "", errors.New("failed to provision user")
+		}
+		candidate = base + "-" + hex.EncodeToString(suffix)
+	}
+	return "", errors.New("failed to provision user")
+}
+
+func (s *FederationService) findEnabledProvider(slug string) (*models.IdentityProvider, error) {
+	var provider models.IdentityProvider
+	if err := s.db.Where("slug = ? AND enabled = ?", slug, true).First(&provider).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("identity provider not found")
+		}
+		return nil, errors.New("failed to fetch identity provider")
+	}
+	return &provider, nil
+}
+
+func (s *FederationService) callbackURL(provider *models.IdentityProvider) string {
+	return strings.TrimSuffix(s.config.PublicURL, "/") + "/auth/federated/" + provider.Slug + "/callback"
+}
+
+func applyProviderRequest(provider *models.IdentityProvider, req *IdentityProviderRequest) {
+	if req.Slug != nil {
+		provider.Slug = *req.Slug
+	}
+	if req.Name != nil {
+		provider.Name = *req.Name
+	}
+	if req.Issuer != nil {
+		provider.Issuer = *req.Issuer
+	}
+	if req.ClientID != nil {
+		provider.ClientID = *req.ClientID
+	}
+	if req.ClientSecret != nil {
+		provider.ClientSecret = *req.ClientSecret
+	}
+	if req.Scopes != nil {
+		provider.Scopes = pq.StringArray(req.Scopes)
+	}
+	if req.Enabled != nil {
+		provider.Enabled = *req.Enabled
+	}
+	if req.AutoProvision != nil {
+		provider.AutoProvision = *req.AutoProvision
+	}
+	if req.EmailClaim != nil {
+		provider.EmailClaim = *req.EmailClaim
+	}
+	if req.NameClaim != nil {
+		provider.NameClaim = *req.NameClaim
+	}
+	if req.UsernameClaim != nil {
+		provider.UsernameClaim = *req.UsernameClaim
+	}
+}
+
+func randomURLToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
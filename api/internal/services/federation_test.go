@@ -0,0 +1,335 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"auth-service/internal/config"
+	"auth-service/internal/models"
+	"auth-service/internal/testdb"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// testOIDCProvider serves discovery, JWKS and a token endpoint that answers
+// with an ID token for the claims the test sets
+type testOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]interface{}
+}
+
+func newTestOIDCProvider(t *testing.T) *testOIDCProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testOIDCProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(p.discovery())
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []jsonWebKey{{
+				Kid: "test",
+				Kty: "RSA",
+				Alg: "RS256",
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "code" || r.PostFormValue("code_verifier") == "" {
+			http.Error(w, "invalid_grant", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": p.sign(t, "RS256", p.key, p.claims)})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *testOIDCProvider) discovery() *oidcDiscovery {
+	return &oidcDiscovery{
+		Issuer:                p.server.URL,
+		AuthorizationEndpoint: p.server.URL + "/authorize",
+		TokenEndpoint:         p.server.URL + "/token",
+		JWKSURI:               p.server.URL + "/jwks",
+	}
+}
+
+func (p *testOIDCProvider) sign(t *testing.T, alg string, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": "test", "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// idClaims are valid ID token claims for the test client and nonce
+func (p *testOIDCProvider) idClaims(nonce string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":   p.server.URL,
+		"aud":   "client",
+		"sub":   "subject",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": nonce,
+	}
+}
+
+func newTestFederation(t *testing.T, provider *testOIDCProvider, autoProvision bool) (*FederationService, *gorm.DB) {
+	t.Helper()
+
+	db := testdb.Open(t)
+	service := NewFederationService(db, &config.Config{PublicURL: "http://api.test"})
+	_, err := service.CreateProvider(&IdentityProviderRequest{
+		Slug:          stringPtr("test"),
+		Name:          stringPtr("Test"),
+		Issuer:        stringPtr(provider.server.URL),
+		ClientID:      stringPtr("client"),
+		ClientSecret:  stringPtr("secret"),
+		AutoProvision: &autoProvision,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service, db
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+// login runs BeginLogin and CompleteLogin with the provider answering with
+// valid claims plus extra
+func login(t *testing.T, service *FederationService, db *gorm.DB, provider *testOIDCProvider, extra map[string]interface{}) (*models.User, error) {
+	t.Helper()
+
+	authURL, err := service.BeginLogin(context.Background(), "test", "/home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := parsed.Query().Get("state")
+
+	var loginState models.FederatedLoginState
+	if err := db.First(&loginState, "state = ?", state).Error; err != nil {
+		t.Fatal(err)
+	}
+	provider.claims = provider.idClaims(loginState.Nonce)
+	for name, value := range extra {
+		provider.claims[name] = value
+	}
+
+	user, returnTo, err := service.CompleteLogin(context.Background(), "test", state, "code")
+	if err == nil && returnTo != "/home" {
+		t.Errorf("returnTo = %q, want /home", returnTo)
+	}
+	return user, err
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	with := func(name string, value interface{}) map[string]interface{} {
+		claims := provider.idClaims("nonce")
+		claims[name] = value
+		return claims
+	}
+
+	cases := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"valid", provider.sign(t, "RS256", provider.key, provider.idClaims("nonce")), true},
+		{"audience list", provider.sign(t, "RS256", provider.key, with("aud", []string{"other", "client"})), true},
+		{"other key", provider.sign(t, "RS256", otherKey, provider.idClaims("nonce")), false},
+		{"other algorithm", provider.sign(t, "RS512", provider.key, provider.idClaims("nonce")), false},
+		{"other issuer", provider.sign(t, "RS256", provider.key, with("iss", "https://evil.test")), false},
+		{"other audience", provider.sign(t, "RS256", provider.key, with("aud", "other")), false},
+		{"expired", provider.sign(t, "RS256", provider.key, with("exp", time.Now().Add(-2*time.Minute).Unix())), false},
+		{"other nonce", provider.sign(t, "RS256", provider.key, with("nonce", "replayed")), false},
+		{"no subject", provider.sign(t, "RS256", provider.key, with("sub", "")), false},
+		{"malformed", "not.a-token", false},
+	}
+
+	cache := newOIDCProviderCache()
+	for _, tc := range cases {
+		_, err := cache.verifyIDToken(context.Background(), provider.server.Client(), provider.discovery(), tc.token, "client", "nonce")
+		if (err == nil) != tc.valid {
+			t.Errorf("%s: err = %v", tc.name, err)
+		}
+	}
+}
+
+func TestCompleteLoginProvisionsAndResolves(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	service, db := newTestFederation(t, provider, true)
+	claims := map[string]interface{}{
+		"email":              "ada@example.com",
+		"email_verified":     true,
+		"name":               "Ada",
+		"preferred_username": "ada",
+	}
+
+	provisioned, err := login(t, service, db, provider, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provisioned.Email != "ada@example.com" || provisioned.Username != "ada" || provisioned.Name != "Ada" || provisioned.EmailVerifiedAt == nil {
+		t.Errorf("provisioned %+v", provisioned)
+	}
+
+	// The second login finds the linked identity
+	resolved, err := login(t, service, db, provider, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.ID != provisioned.ID {
+		t.Errorf("resolved %s, want %s", resolved.ID, provisioned.ID)
+	}
+
+	var users int64
+	db.Model(&models.User{}).Count(&users)
+	if users != 1 {
+		t.Errorf("%d users, want 1", users)
+	}
+}
+
+func TestCompleteLoginLinksVerifiedEmail(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	service, db := newTestFederation(t, provider, false)
+
+	verifiedAt := time.Now()
+	existing := models.User{Email: "ada@example.com", Name: "Ada", Username: "ada", Password: "x", EmailVerifiedAt: &verifiedAt}
+	if err := db.Create(&existing).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := login(t, service, db, provider, map[string]interface{}{"email": "ada@example.com", "email_verified": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != existing.ID {
+		t.Errorf("linked %s, want %s", user.ID, existing.ID)
+	}
+
+	var identity models.FederatedIdentity
+	if err := db.First(&identity, "subject = ?", "subject").Error; err != nil || identity.UserID != existing.ID {
+		t.Errorf("identity = %+v, err = %v", identity, err)
+	}
+}
+
+func TestCompleteLoginRejects(t *testing.T) {
+	cases := []struct {
+		name          string
+		autoProvision bool
+		existing      bool
+		claims        map[string]interface{}
+		want          string
+	}{
+		{"unverified email of an account", true, true, map[string]interface{}{"email": "ada@example.com", "email_verified": false}, "email not verified by identity provider"},
+		// Registered locally with the victim's address, never verified
+		{"account with unverified email", true, true, map[string]interface{}{"email": "ada@example.com", "email_verified": true}, "account email not verified"},
+		{"unverified new email", true, false, map[string]interface{}{"email": "ada@example.com"}, "email not verified by identity provider"},
+		{"no email", true, false, map[string]interface{}{}, "identity provider did not share an email"},
+		{"provisioning disabled", false, false, map[string]interface{}{"email": "ada@example.com", "email_verified": true}, "no account linked to this identity"},
+		{"token for another client", true, false, map[string]interface{}{"email": "ada@example.com", "email_verified": true, "aud": "other"}, "identity provider rejected the login"},
+	}
+
+	for _, tc := range cases {
+		provider := newTestOIDCProvider(t)
+		service, db := newTestFederation(t, provider, tc.autoProvision)
+		if tc.existing {
+			if err := db.Create(&models.User{Email: "ada@example.com", Name: "Ada", Username: "ada", Password: "x"}).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		_, err := login(t, service, db, provider, tc.claims)
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("%s: err = %v, want %q", tc.name, err, tc.want)
+		}
+
+		var users, identities int64
+		db.Model(&models.User{}).Count(&users)
+		db.Model(&models.FederatedIdentity{}).Count(&identities)
+		if identities != 0 || (users != 0) != tc.existing {
+			t.Errorf("%s: %d users and %d identities left", tc.name, users, identities)
+		}
+	}
+}
+
+func TestLoginStatesAreRemoved(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	service, db := newTestFederation(t, provider, true)
+
+	if _, err := login(t, service, db, provider, map[string]interface{}{"email": "ada@example.com", "email_verified": true}); err != nil {
+		t.Fatal(err)
+	}
+	var remaining int64
+	db.Model(&models.FederatedLoginState{}).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("%d login states left after the callback, want 0", remaining)
+	}
+
+	// Logins abandoned at the provider are swept once they expire
+	var providerID uuid.UUID
+	db.Model(&models.IdentityProvider{}).Select("id").Where("slug = ?", "test").Scan(&providerID)
+	states := []models.FederatedLoginState{
+		{State: "abandoned", ProviderID: providerID, Nonce: "n", CodeVerifier: "v", ExpiresAt: time.Now().Add(-time.Minute)},
+		{State: "pending", ProviderID: providerID, Nonce: "n", CodeVerifier: "v"},
+	}
+	if err := db.Create(&states).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	purged, err := service.PurgeExpiredLoginStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 1 {
+		t.Errorf("purged %d login states, want 1", purged)
+	}
+	var kept models.FederatedLoginState
+	if err := db.First(&kept).Error; err != nil || kept.State != "pending" {
+		t.Errorf("kept %q (err = %v), want pending", kept.State, err)
+	}
+}
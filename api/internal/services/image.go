@@ -1,37 +1,90 @@
 package services
 
 import (
+	"auth-service/internal/config"
 	"auth-service/internal/models"
+	"auth-service/internal/storage"
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"log"
 
 	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
 	"gorm.io/gorm"
 )
 
 type ImageService struct {
-	db *gorm.DB
+	db          *gorm.DB
+	config      *config.Config
+	store       storage.BlobStore
+	signer      *storage.URLSigner
+	rbacService *RBACService
+	// Deduplicates concurrent renders of the same derivative
+	derivatives singleflight.Group
 }
 
-func NewImageService(db *gorm.DB) *ImageService {
+func NewImageService(db *gorm.DB, cfg *config.Config, store storage.BlobStore, rbacService *RBACService) *ImageService {
 	return &ImageService{
-		db: db,
+		db:          db,
+		config:      cfg,
+		store:       store,
+		signer:      storage.NewURLSigner(cfg.Storage.SigningKey),
+		rbacService: rbacService,
 	}
 }
 
+// CreateImageRequest carries the already validated PNGs of a new image
 type CreateImageRequest struct {
-	SentImageID     *uuid.UUID `json:"sent_image_id,omitempty"`
-	ReceivedImageID *uuid.UUID `json:"received_image_id,omitempty"`
+	Drawing      []byte
+	Segmentation []byte
+	// Inference is stored in the same transaction as the image when set
+	Inference *models.Inference
 }
 
 type ImageResponse struct {
-	ID              uuid.UUID `json:"id"`
-	UserID          uuid.UUID `json:"user_id"`
-	SentImageID     uuid.UUID `json:"sent_image_id"`
-	ReceivedImageID uuid.UUID `json:"received_image_id"`
-	CreatedAt       string    `json:"created_at"`
+	ID              uuid.UUID        `json:"id"`
+	UserID          uuid.UUID        `json:"user_id"`
+	SentImageID     uuid.UUID        `json:"sent_image_id"`
+	ReceivedImageID uuid.UUID        `json:"received_image_id"`
+	CreatedAt       string           `json:"created_at"`
+	Inference       *InferenceResult `json:"inference,omitempty"`
+	// Only set for images in the trash
+	DeletedAt string `json:"deleted_at,omitempty"`
+	PurgeAt   string `json:"purge_at,omitempty"`
 }
 
-func (s *ImageService) CreateImage(userID uuid.UUID, req *CreateImageRequest) (*ImageResponse, error) {
+// ImageFilter narrows GetAllImages. Digit and MinConfidence match images with
+// at least one detected digit meeting both.
+type ImageFilter struct {
+	UserID        *uuid.UUID
+	Digit         *int
+	MinConfidence *float64
+	Limit         int
+	Offset        int
+}
+
+func newImageResponse(image *models.Image, withClassMap bool) ImageResponse {
+	response := ImageResponse{
+		ID:              image.ID,
+		UserID:          image.UserID,
+		SentImageID:     image.SentImageID,
+		ReceivedImageID: image.ReceivedImageID,
+		CreatedAt:       image.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+	if image.Inference != nil {
+		response.Inference = newInferenceResult(image.Inference, withClassMap)
+	}
+	return response
+}
+
+// CreateImage stores both blobs and the image row so that either all of it
+// exists or none of it does. The row is written first as pending, then the
+// blobs are uploaded and the row is marked ready. A failure on the way undoes
+// what was done, and if the process dies in between the reconciler finds the
+// pending row once it times out.
+func (s *ImageService) CreateImage(ctx context.Context, userID uuid.UUID, req *CreateImageRequest) (*ImageResponse, error) {
 	// Validate user exists
 	var user models.User
 	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
@@ -41,42 +94,116 @@ func (s *ImageService) CreateImage(userID uuid.UUID, req *CreateImageRequest) (*
 		return nil, errors.New("failed to validate user")
 	}
 
-	// Create image record
 	image := &models.Image{
-		UserID: userID,
+		UserID:          userID,
+		SentImageID:     uuid.New(),
+		ReceivedImageID: uuid.New(),
+		Status:          models.ImageStatusPending,
 	}
 
-	// Use provided IDs or generate new ones
-	if req.SentImageID != nil {
-		image.SentImageID = *req.SentImageID
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(image).Error; err != nil {
+			return err
+		}
+		if req.Inference != nil {
+			req.Inference.ImageID = image.ID
+			if err := tx.Create(req.Inference).Error; err != nil {
+				return err
+			}
+			image.Inference = req.Inference
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.New("failed to create image record")
 	}
-	if req.ReceivedImageID != nil {
-		image.ReceivedImageID = *req.ReceivedImageID
+
+	if err := s.putBlob(ctx, image.SentImageID, req.Drawing); err != nil {
+		s.discardImage(image)
+		return nil, errors.New("failed to upload original image")
+	}
+	if err := s.putBlob(ctx, image.ReceivedImageID, req.Segmentation); err != nil {
+		s.discardImage(image)
+		return nil, errors.New("failed to upload inference image")
 	}
 
-	if err := s.db.Create(image).Error; err != nil {
+	if err := s.db.Model(image).Update("status", models.ImageStatusReady).Error; err != nil {
+		s.discardImage(image)
 		return nil, errors.New("failed to create image record")
 	}
 
-	response := &ImageResponse{
-		ID:              image.ID,
-		UserID:          image.UserID,
-		SentImageID:     image.SentImageID,
-		ReceivedImageID: image.ReceivedImageID,
-		CreatedAt:       image.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	if s.config.Images.DerivativesOnUpload {
+		go s.generateDerivatives(context.Background(), image)
+	}
+
+	response := newImageResponse(image, false)
+	return &response, nil
+}
+
+func (s *ImageService) putBlob(ctx context.Context, id uuid.UUID, data []byte) error {
+	return s.store.Put(ctx, blobName(id), bytes.NewReader(data), int64(len(data)), "image/png")
+}
+
+// OpenBlob opens a blob of an image the viewer may see, the caller must close
+// it
+func (s *ImageService) OpenBlob(ctx context.Context, viewer *ImageViewer, blobID uuid.UUID) (storage.Object, *storage.ObjectInfo, error) {
+	if err := s.CheckBlob(viewer, blobID); err != nil {
+		return nil, nil, err
+	}
+
+	obj, info, err := s.store.Get(ctx, blobName(blobID))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, errors.New("image not found")
+	}
+	if err != nil {
+		return nil, nil, errors.New("failed to get image")
 	}
+	return obj, info, nil
+}
 
-	return response, nil
+// discardImage is the compensation of a failed CreateImage. It runs on a
+// fresh context, the request one may be what failed. Whatever it cannot
+// remove is left to the reconciler.
+func (s *ImageService) discardImage(image *models.Image) {
+	if _, err := s.removeImage(context.Background(), image); err != nil {
+		log.Printf("Failed to discard image, left to the reconciler: %v", err)
+	}
 }
 
-func (s *ImageService) GetAllImages(userID *uuid.UUID, limit, offset int) ([]ImageResponse, int64, error) {
+// removeBlob deletes a blob, a blob that is already gone is not an error
+func (s *ImageService) removeBlob(ctx context.Context, id uuid.UUID) error {
+	return s.store.Delete(ctx, blobName(id))
+}
+
+func blobName(id uuid.UUID) string {
+	return fmt.Sprintf("%s.png", id)
+}
+
+// GetAllImages lists the images the viewer may see. Asking for the images of
+// another user without images:read_all answers "user not found".
+func (s *ImageService) GetAllImages(viewer *ImageViewer, filter *ImageFilter) ([]ImageResponse, int64, error) {
 	var images []models.Image
 	var total int64
 
-	query := s.db.Model(&models.Image{}).Preload("User")
-	
-	if userID != nil {
-		query = query.Where("user_id = ?", *userID)
+	if filter.UserID != nil && !viewer.CanSee(*filter.UserID) {
+		return nil, 0, errors.New("user not found")
+	}
+
+	query := s.visibleImages(viewer).Preload("Inference.Digits")
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.Digit != nil || filter.MinConfidence != nil {
+		digits := s.db.Table("inference_digits").Select("1").
+			Joins("JOIN inferences ON inferences.id = inference_digits.inference_id").
+			Where("inferences.image_id = images.id")
+		if filter.Digit != nil {
+			digits = digits.Where("inference_digits.digit = ?", *filter.Digit)
+		}
+		if filter.MinConfidence != nil {
+			digits = digits.Where("inference_digits.confidence >= ?", *filter.MinConfidence)
+		}
+		query = query.Where("EXISTS (?)", digits)
 	}
 
 	// total
@@ -85,82 +212,33 @@ func (s *ImageService) GetAllImages(userID *uuid.UUID, limit, offset int) ([]Ima
 	}
 
 	// paginated
-	if err := query.Limit(limit).Offset(offset).Order("created_at DESC").Find(&images).Error; err != nil {
+	if err := query.Limit(filter.Limit).Offset(filter.Offset).Order("created_at DESC").Find(&images).Error; err != nil {
 		return nil, 0, errors.New("failed to fetch images")
 	}
 
 	responses := make([]ImageResponse, len(images))
-	for i, img := range images {
-		responses[i] = ImageResponse{
-			ID:              img.ID,
-			UserID:          img.UserID,
-			SentImageID:     img.SentImageID,
-			ReceivedImageID: img.ReceivedImageID,
-			CreatedAt:       img.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		}
+	for i := range images {
+		responses[i] = newImageResponse(&images[i], false)
 	}
 
 	return responses, total, nil
 }
 
-func (s *ImageService) GetImageByID(imageID uuid.UUID) (*ImageResponse, error) {
-	var image models.Image
-	if err := s.db.Preload("User").Where("id = ?", imageID).First(&image).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, errors.New("image not found")
-		}
-		return nil, errors.New("failed to fetch image")
-	}
-
-	response := &ImageResponse{
-		ID:              image.ID,
-		UserID:          image.UserID,
-		SentImageID:     image.SentImageID,
-		ReceivedImageID: image.ReceivedImageID,
-		CreatedAt:       image.CreatedAt.Format("2006-01-02T15:04:05Z"),
-	}
-
-	return response, nil
+func (s *ImageService) GetImageByID(viewer *ImageViewer, imageID uuid.UUID) (*ImageResponse, error) {
+	return s.findImage(viewer, "id", imageID)
 }
 
-func (s *ImageService) GetImageBySentID(sentImageID uuid.UUID) (*ImageResponse, error) {
-	var image models.Image
-	if err := s.db.Preload("User").Where("sent_image_id = ?", sentImageID).First(&image).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, errors.New("image not found")
-		}
-		return nil, errors.New("failed to fetch image")
-	}
-
-	return &ImageResponse{
-		ID:              image.ID,
-		UserID:          image.UserID,
-		SentImageID:     image.SentImageID,
-		ReceivedImageID: image.ReceivedImageID,
-		CreatedAt:       image.CreatedAt.Format("2006-01-02T15:04:05Z"),
-	}, nil
+func (s *ImageService) GetImageBySentID(viewer *ImageViewer, sentImageID uuid.UUID) (*ImageResponse, error) {
+	return s.findImage(viewer, "sent_image_id", sentImageID)
 }
 
-func (s *ImageService) GetImageByReceivedID(receivedImageID uuid.UUID) (*ImageResponse, error) {
-	var image models.Image
-	if err := s.db.Preload("User").Where("received_image_id = ?", receivedImageID).First(&image).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, errors.New("image not found")
-		}
-		return nil, errors.New("failed to fetch image")
-	}
-
-	return &ImageResponse{
-		ID:              image.ID,
-		UserID:          image.UserID,
-		SentImageID:     image.SentImageID,
-		ReceivedImageID: image.ReceivedImageID,
-		CreatedAt:       image.CreatedAt.Format("2006-01-02T15:04:05Z"),
-	}, nil
+func (s *ImageService) GetImageByReceivedID(viewer *ImageViewer, receivedImageID uuid.UUID) (*ImageResponse, error) {
+	return s.findImage(viewer, "received_image_id", receivedImageID)
 }
 
-
-func (s *ImageService) DeleteImage(imageID uuid.UUID, userID uuid.UUID) error {
+// DeleteImage moves the image to the trash, its blobs stay until the purge
+// worker removes them after IMAGE_TRASH_RETENTION hours
+func (s *ImageService) DeleteImage(ctx context.Context, imageID uuid.UUID, userID uuid.UUID) error {
 	result := s.db.Where("id = ? AND user_id = ?", imageID, userID).Delete(&models.Image{})
 	if result.Error != nil {
 		return errors.New("failed to delete image")
@@ -170,5 +248,11 @@ func (s *ImageService) DeleteImage(imageID uuid.UUID, userID uuid.UUID) error {
 		return errors.New("image not found")
 	}
 
+	// Derivatives are cheap to render again after a restore, the purge and
+	// the reconciler catch any left behind here
+	if err := removeDerivatives(ctx, s.store, imageID); err != nil {
+		log.Printf("Failed to remove derivatives of image %s: %v", imageID, err)
+	}
+
 	return nil
 }
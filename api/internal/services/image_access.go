@@ -0,0 +1,70 @@
+package services
+
+import (
+	"auth-service/internal/models"
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ImageViewer is the caller an image read is made for. Without ReadAll only
+// the viewer's own images exist as far as the read is concerned, anything
+// else is "image not found" rather than forbidden, so ids of other users'
+// images cannot be probed.
+type ImageViewer struct {
+	UserID  uuid.UUID
+	ReadAll bool
+}
+
+// Viewer builds the ImageViewer of an authenticated user, ReadAll comes from
+// the images:read_all permission of their roles
+func (s *ImageService) Viewer(userID uuid.UUID) (*ImageViewer, error) {
+	readAll, err := s.rbacService.HasPermission(userID, models.PermissionImagesReadAll)
+	if err != nil {
+		return nil, err
+	}
+	return &ImageViewer{UserID: userID, ReadAll: readAll}, nil
+}
+
+// CanSee reports whether the viewer may read images owned by userID
+func (v *ImageViewer) CanSee(userID uuid.UUID) bool {
+	return v.ReadAll || v.UserID == userID
+}
+
+// visibleImages is the base query of every image read, ready images the
+// viewer may see
+func (s *ImageService) visibleImages(viewer *ImageViewer) *gorm.DB {
+	query := s.db.Model(&models.Image{}).Where("status = ?", models.ImageStatusReady)
+	if !viewer.ReadAll {
+		query = query.Where("user_id = ?", viewer.UserID)
+	}
+	return query
+}
+
+// findImage loads one visible image by id, sent_image_id or received_image_id
+func (s *ImageService) findImage(viewer *ImageViewer, column string, id uuid.UUID) (*ImageResponse, error) {
+	var image models.Image
+	if err := s.visibleImages(viewer).Preload("Inference.Digits").Where(column+" = ?", id).First(&image).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("image not found")
+		}
+		return nil, errors.New("failed to fetch image")
+	}
+
+	response := newImageResponse(&image, true)
+	return &response, nil
+}
+
+// findImageRow is findImage for reads that only need the row, such as
+// serving its blobs
+func (s *ImageService) findImageRow(viewer *ImageViewer, column string, id uuid.UUID) (*models.Image, error) {
+	var image models.Image
+	if err := s.visibleImages(viewer).Where(column+" = ?", id).First(&image).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("image not found")
+		}
+		return nil, errors.New("failed to fetch image")
+	}
+	return &image, nil
+}
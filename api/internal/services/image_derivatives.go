@@ -0,0 +1,326 @@
+package services
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/storage"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// VariantComposite is the drawing next to its segmentation, one per image
+	VariantComposite = "composite"
+	thumbnailPrefix  = "thumb_"
+	// The composite is as tall as the segmentation, up to this many pixels
+	maxCompositeHeight = 400
+	// Derivatives of an image live under derived/<image id>/, away from the
+	// <uuid>.png blobs the reconciler matches
+	derivativeRoot = "derived/"
+	// A shared render is not tied to any one request, this bounds it instead
+	derivativeRenderTimeout = 30 * time.Second
+)
+
+// thumbnailSizes parses IMAGE_THUMBNAIL_SIZES, entries that are not a
+// positive number are skipped
+func (s *ImageService) thumbnailSizes() []int {
+	var sizes []int
+	for _, entry := range strings.Split(s.config.Images.ThumbnailSizes, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(entry))
+		if err == nil && size > 0 {
+			sizes = append(sizes, size)
+		}
+	}
+	return sizes
+}
+
+// thumbnailSize returns the size of a thumb_<size> variant, if that size is
+// configured
+func (s *ImageService) thumbnailSize(variant string) (int, bool) {
+	size, err := strconv.Atoi(strings.TrimPrefix(variant, thumbnailPrefix))
+	if err != nil || !strings.HasPrefix(variant, thumbnailPrefix) {
+		return 0, false
+	}
+	for _, configured := range s.thumbnailSizes() {
+		if configured == size {
+			return size, true
+		}
+	}
+	return 0, false
+}
+
+// checkVariant accepts the original (an empty variant), the composite and
+// the configured thumbnails
+func (s *ImageService) checkVariant(variant string) error {
+	if variant == "" || variant == VariantComposite {
+		return nil
+	}
+	if _, ok := s.thumbnailSize(variant); !ok {
+		return errors.New("unknown variant")
+	}
+	return nil
+}
+
+// blobKind defaults an empty kind to the drawing
+func blobKind(kind string) (string, error) {
+	switch kind {
+	case "", BlobKindSent:
+		return BlobKindSent, nil
+	case BlobKindReceived:
+		return BlobKindReceived, nil
+	default:
+		return "", errors.New("kind must be sent or received")
+	}
+}
+
+func blobOf(image *models.Image, kind string) uuid.UUID {
+	if kind == BlobKindReceived {
+		return image.ReceivedImageID
+	}
+	return image.SentImageID
+}
+
+// variantKey is the storage key of a variant, the blob itself for the
+// original. The composite does not depend on the kind.
+func variantKey(image *models.Image, kind, variant string) string {
+	switch variant {
+	case "":
+		return blobName(blobOf(image, kind))
+	case VariantComposite:
+		return fmt.Sprintf("%s%s/%s.png", derivativeRoot, image.ID, VariantComposite)
+	default:
+		return fmt.Sprintf("%s%s/%s_%s.png", derivativeRoot, image.ID, kind, variant)
+	}
+}
+
+// OpenImageBlob opens the sent or received blob of an image the viewer may
+// see, or one of its derivatives when variant is set. The caller must close
+// it.
+func (s *ImageService) OpenImageBlob(ctx context.Context, viewer *ImageViewer, imageID uuid.UUID, kind, variant string) (storage.Object, *storage.ObjectInfo, error) {
+	kind, err := blobKind(kind)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.checkVariant(variant); err != nil {
+		return nil, nil, err
+	}
+
+	image, err := s.findImageRow(viewer, "id", imageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.openVariant(ctx, image, kind, variant)
+}
+
+// openVariant opens a variant of an image, rendering a derivative that does
+// not exist yet
+func (s *ImageService) openVariant(ctx context.Context, image *models.Image, kind, variant string) (storage.Object, *storage.ObjectInfo, error) {
+	if variant != "" {
+		if err := s.ensureDerivative(ctx, image, kind, variant); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				return nil, nil, errors.New("image not found")
+			}
+			log.Printf("Failed to render %s of image %s: %v", variant, image.ID, err)
+			return nil, nil, errors.New("failed to render image variant")
+		}
+	}
+
+	obj, info, err := s.store.Get(ctx, variantKey(image, kind, variant))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, errors.New("image not found")
+	}
+	if err != nil {
+		return nil, nil, errors.New("failed to get image")
+	}
+	return obj, info, nil
+}
+
+// ensureDerivative renders and stores a derivative unless it is already
+// stored. Concurrent requests for the same derivative share one render, which
+// runs detached from ctx so the first caller going away does not fail the
+// others; each caller still stops waiting when its own ctx ends.
+func (s *ImageService) ensureDerivative(ctx context.Context, image *models.Image, kind, variant string) error {
+	key := variantKey(image, kind, variant)
+	result := s.derivatives.DoChan(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), derivativeRenderTimeout)
+		defer cancel()
+
+		if _, err := s.store.Stat(ctx, key); err == nil || !errors.Is(err, storage.ErrNotFound) {
+			return nil, err
+		}
+
+		data, err := s.renderDerivative(ctx, image, kind, variant)
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "image/png")
+	})
+
+	select {
+	case res := <-result:
+		return res.Err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *ImageService) renderDerivative(ctx context.Context, image *models.Image, kind, variant string) ([]byte, error) {
+	if variant == VariantComposite {
+		drawing, err := s.loadBlobImage(ctx, image.SentImageID)
+		if err != nil {
+			return nil, err
+		}
+		segmentation, err := s.loadBlobImage(ctx, image.ReceivedImageID)
+		if err != nil {
+			return nil, err
+		}
+		return encodePNG(composeSideBySide(drawing, segmentation))
+	}
+
+	size, _ := s.thumbnailSize(variant)
+	src, err := s.loadBlobImage(ctx, blobOf(image, kind))
+	if err != nil {
+		return nil, err
+	}
+	return encodePNG(thumbnail(src, size))
+}
+
+func (s *ImageService) loadBlobImage(ctx context.Context, blobID uuid.UUID) (image.Image, error) {
+	obj, _, err := s.store.Get(ctx, blobName(blobID))
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	return png.Decode(obj)
+}
+
+// generateDerivatives renders every derivative of a new image, for
+// IMAGE_DERIVATIVES_ON_UPLOAD. A failure is only logged, the derivative is
+// rendered on its first request instead.
+func (s *ImageService) generateDerivatives(ctx context.Context, image *models.Image) {
+	variants := []string{VariantComposite}
+	for _, size := range s.thumbnailSizes() {
+		variants = append(variants, thumbnailPrefix+strconv.Itoa(size))
+	}
+
+	for _, variant := range variants {
+		kinds := []string{BlobKindSent, BlobKindReceived}
+		if variant == VariantComposite {
+			kinds = kinds[:1]
+		}
+		for _, kind := range kinds {
+			if err := s.ensureDerivative(ctx, image, kind, variant); err != nil {
+				log.Printf("Failed to render %s of image %s: %v", variant, image.ID, err)
+			}
+		}
+	}
+}
+
+// removeDerivatives deletes every derivative of an image, they are rendered
+// again if the image comes back
+func removeDerivatives(ctx context.Context, store storage.BlobStore, imageID uuid.UUID) error {
+	var keys []string
+	err := store.List(ctx, fmt.Sprintf("%s%s/", derivativeRoot, imageID), func(object storage.ObjectInfo) error {
+		keys = append(keys, object.Key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := store.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// derivativeImageID returns the image a derivative key belongs to
+func derivativeImageID(key string) (uuid.UUID, bool) {
+	rest, ok := strings.CutPrefix(key, derivativeRoot)
+	if !ok {
+		return uuid.Nil, false
+	}
+	dir, _, _ := strings.Cut(rest, "/")
+	id, err := uuid.Parse(dir)
+	return id, err == nil
+}
+
+// thumbnail scales img down to fit in a size x size square, keeping its
+// aspect ratio. Images that already fit are only re-encoded.
+func thumbnail(img image.Image, size int) *image.RGBA {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(height*size/width, 1)
+		} else {
+			width, height = max(width*size/height, 1), size
+		}
+	}
+	return resize(img, width, height)
+}
+
+// composeSideBySide puts the drawing left of its segmentation. The drawing is
+// scaled to the segmentation's height so both read at the same size.
+func composeSideBySide(drawing, segmentation image.Image) *image.RGBA {
+	height := min(segmentation.Bounds().Dy(), maxCompositeHeight)
+	left := resize(drawing, max(drawing.Bounds().Dx()*height/drawing.Bounds().Dy(), 1), height)
+	right := resize(segmentation, max(segmentation.Bounds().Dx()*height/segmentation.Bounds().Dy(), 1), height)
+
+	composite := image.NewRGBA(image.Rect(0, 0, left.Bounds().Dx()+right.Bounds().Dx(), height))
+	draw.Draw(composite, composite.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(composite, left.Bounds(), left, image.Point{}, draw.Over)
+	draw.Draw(composite, right.Bounds().Add(image.Pt(left.Bounds().Dx(), 0)), right, image.Point{}, draw.Over)
+	return composite
+}
+
+// resize scales img to width x height. Each output pixel is the average of
+// the source pixels it covers, which keeps the thin strokes of a drawing
+// when scaling down and repeats pixels when scaling up.
+func resize(img image.Image, width, height int) *image.RGBA {
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := max((y+1)*srcHeight/height, y0+1)
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := max((x+1)*srcWidth/width, x0+1)
+
+			// Premultiplied channels, so transparent pixels do not darken
+			// the average
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					for c := range sum {
+						sum[c] += int(row[sx*4+c])
+					}
+				}
+			}
+
+			count := (y1 - y0) * (x1 - x0)
+			pixel := dst.Pix[y*dst.Stride+x*4:]
+			for c := range sum {
+				pixel[c] = uint8((sum[c] + count/2) / count)
+			}
+		}
+	}
+	return dst
+}
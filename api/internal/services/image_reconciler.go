@@ -0,0 +1,263 @@
+package services
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/storage"
+	"auth-service/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ReconcileReport counts what one reconciler run cleaned up
+type ReconcileReport struct {
+	// Pending images older than the timeout, with whatever blobs they had
+	StalePending int
+	// Ready images with a blob missing from storage
+	DanglingRows int
+	// Image blobs no row points at
+	OrphanBlobs int
+	// Images gone from the database whose derivatives were still stored
+	OrphanDerivatives int
+	// Set when IMAGE_RECONCILE_MAX_DELETIONS stopped the run, what is left
+	// waits for the next one
+	LimitReached bool
+}
+
+// reconcileBatchSize is how many image rows are read at a time
+const reconcileBatchSize = 500
+
+// ReconcileImages brings the image rows and the blobs in storage back in
+// line after a failed CreateImage the compensation could not undo:
+//
+//   - pending rows past IMAGE_PENDING_TIMEOUT are removed with their blobs
+//   - ready rows older than the timeout whose blobs are gone are removed with
+//     the remaining blob, once a Stat confirms the blob is missing
+//   - <uuid>.png blobs older than the timeout that no row references are
+//     removed
+//   - derived/<image id>/ derivatives of images without a row are removed
+//     once the newest of them is older than the timeout
+//
+// At most IMAGE_RECONCILE_MAX_DELETIONS images and blobs are removed per run.
+// An empty listing while ready rows exist is taken as a storage problem and
+// nothing past the pending rows is touched. Other blobs, such as exports/,
+// are never touched.
+func (s *ImageService) ReconcileImages(ctx context.Context) (*ReconcileReport, error) {
+	report := &ReconcileReport{}
+	cutoff := utils.GetCurrentTS().Add(-time.Duration(s.config.Images.PendingTimeout) * time.Minute)
+
+	remaining := s.config.Images.ReconcileMaxDeletions
+	allow := func() bool {
+		if remaining <= 0 {
+			report.LimitReached = true
+			return false
+		}
+		remaining--
+		return true
+	}
+
+	var stale []models.Image
+	if err := s.db.Unscoped().Where("status = ? AND created_at < ?", models.ImageStatusPending, cutoff).Find(&stale).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch pending images: %w", err)
+	}
+	for i := range stale {
+		if !allow() {
+			return report, nil
+		}
+		if _, err := s.removeImage(ctx, &stale[i]); err != nil {
+			return nil, err
+		}
+		report.StalePending++
+	}
+
+	// Blob name to last modification, only the image blobs at the top level,
+	// and image id to the newest of its derivatives
+	blobs := map[uuid.UUID]time.Time{}
+	derivatives := map[uuid.UUID]time.Time{}
+	err := s.store.List(ctx, "", func(object storage.ObjectInfo) error {
+		if imageID, ok := derivativeImageID(object.Key); ok {
+			if object.LastModified.After(derivatives[imageID]) {
+				derivatives[imageID] = object.LastModified
+			}
+			return nil
+		}
+
+		id, err := uuid.Parse(strings.TrimSuffix(object.Key, ".png"))
+		if err != nil || !strings.HasSuffix(object.Key, ".png") {
+			return nil
+		}
+		blobs[id] = object.LastModified
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blobs: %w", err)
+	}
+
+	if len(blobs) == 0 {
+		var ready int64
+		if err := s.db.Unscoped().Model(&models.Image{}).Where("status = ?", models.ImageStatusReady).Count(&ready).Error; err != nil {
+			return nil, fmt.Errorf("failed to count images: %w", err)
+		}
+		if ready > 0 {
+			return nil, fmt.Errorf("storage listed no blobs but %d images are ready, skipping", ready)
+		}
+	}
+
+	// Images in the trash still own their blobs until they are purged. The
+	// table is read in batches, only the suspects are kept.
+	var dangling []models.Image
+	var batch []models.Image
+	err = s.db.Unscoped().Order("id").FindInBatches(&batch, reconcileBatchSize, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			image := &batch[i]
+			_, hasSent := blobs[image.SentImageID]
+			_, hasReceived := blobs[image.ReceivedImageID]
+			delete(blobs, image.SentImageID)
+			delete(blobs, image.ReceivedImageID)
+			delete(derivatives, image.ID)
+
+			// Rows younger than the timeout may have been marked ready after
+			// the listing, and pending ones may still be uploading
+			if image.Status != models.ImageStatusReady || image.CreatedAt.After(cutoff) || (hasSent && hasReceived) {
+				continue
+			}
+			dangling = append(dangling, *image)
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch images: %w", err)
+	}
+
+	for i := range dangling {
+		image := &dangling[i]
+		// The listing may have missed a blob, only a blob Stat cannot find
+		// either makes the row dangling
+		missing, err := s.blobMissing(ctx, image)
+		if err != nil {
+			return nil, err
+		}
+		if !missing {
+			continue
+		}
+		if !allow() {
+			return report, nil
+		}
+		if _, err := s.removeImage(ctx, image); err != nil {
+			return nil, err
+		}
+		report.DanglingRows++
+	}
+
+	// What is left in blobs belongs to no row. Recent blobs are skipped, their
+	// row may have been written after the listing above.
+	for id, modified := range blobs {
+		if modified.After(cutoff) {
+			continue
+		}
+		if !allow() {
+			return report, nil
+		}
+		if err := s.removeBlob(ctx, id); err != nil {
+			return nil, fmt.Errorf("failed to remove orphan blob %s: %w", id, err)
+		}
+		report.OrphanBlobs++
+	}
+
+	// A render racing with a purge can store a derivative after its image
+	// is gone
+	for id, modified := range derivatives {
+		if modified.After(cutoff) {
+			continue
+		}
+		if !allow() {
+			return report, nil
+		}
+		if err := removeDerivatives(ctx, s.store, id); err != nil {
+			return nil, fmt.Errorf("failed to remove derivatives of image %s: %w", id, err)
+		}
+		report.OrphanDerivatives++
+	}
+
+	return report, nil
+}
+
+// blobMissing asks the store for each blob of an image and reports whether
+// one of them is gone
+func (s *ImageService) blobMissing(ctx context.Context, image *models.Image) (bool, error) {
+	for _, id := range []uuid.UUID{image.SentImageID, image.ReceivedImageID} {
+		_, err := s.store.Stat(ctx, blobName(id))
+		if errors.Is(err, storage.ErrNotFound) {
+			return true, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to check blob %s of image %s: %w", id, image.ID, err)
+		}
+	}
+	return false, nil
+}
+
+// removeImage deletes both blobs of an image and then its row, so a failure
+// halfway leaves a row the next run can find again. It returns how many of
+// the blobs were still stored and got deleted.
+func (s *ImageService) removeImage(ctx context.Context, image *models.Image) (int, error) {
+	deleted := 0
+	for _, id := range []uuid.UUID{image.SentImageID, image.ReceivedImageID} {
+		_, err := s.store.Stat(ctx, blobName(id))
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err == nil {
+			err = s.removeBlob(ctx, id)
+		}
+		if err != nil {
+			return deleted, fmt.Errorf("failed to remove blob %s of image %s: %w", id, image.ID, err)
+		}
+		deleted++
+	}
+	if err := removeDerivatives(ctx, s.store, image.ID); err != nil {
+		return deleted, fmt.Errorf("failed to remove derivatives of image %s: %w", image.ID, err)
+	}
+	if err := s.db.Unscoped().Delete(&models.Image{}, "id = ?", image.ID).Error; err != nil {
+		return deleted, fmt.Errorf("failed to delete image %s: %w", image.ID, err)
+	}
+	return deleted, nil
+}
+
+// StartReconcileWorker runs ReconcileImages on the given interval until the
+// context is cancelled. An interval of zero or less disables it.
+func (s *ImageService) StartReconcileWorker(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		log.Println("Image reconciler disabled, IMAGE_RECONCILE_INTERVAL is not positive")
+		return
+	}
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report, err := s.ReconcileImages(ctx)
+				if err != nil {
+					log.Println("Image reconciliation failed:", err)
+					continue
+				}
+				if report.StalePending+report.DanglingRows+report.OrphanBlobs+report.OrphanDerivatives > 0 {
+					log.Printf("Image reconciliation removed %d stale pending images, %d dangling rows, %d orphan blobs and the derivatives of %d missing images",
+						report.StalePending, report.DanglingRows, report.OrphanBlobs, report.OrphanDerivatives)
+				}
+				if report.LimitReached {
+					log.Printf("Image reconciliation stopped at IMAGE_RECONCILE_MAX_DELETIONS=%d, the rest is left to the next run", s.config.Images.ReconcileMaxDeletions)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"auth-service/internal/config"
+	"auth-service/internal/models"
+	"auth-service/internal/storage"
+	"auth-service/internal/testdb"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// flakyStore fails the Put with the given number, counting from 1
+type flakyStore struct {
+	*storage.MemoryStore
+	failPut int
+	puts    int
+}
+
+func (s *flakyStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	s.puts++
+	if s.puts == s.failPut {
+		return errors.New("storage unavailable")
+	}
+	return s.MemoryStore.Put(ctx, key, r, size, contentType)
+}
+
+func newTestUser(t *testing.T, db *gorm.DB) uuid.UUID {
+	t.Helper()
+
+	user := models.User{Email: uuid.NewString() + "@example.com", Name: "Test", Username: uuid.NewString(), Password: "x"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user.ID
+}
+
+func storedKeys(t *testing.T, store storage.BlobStore) []string {
+	t.Helper()
+
+	var keys []string
+	err := store.List(context.Background(), "", func(object storage.ObjectInfo) error {
+		keys = append(keys, object.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestCreateImageStoresRowAndBlobs(t *testing.T) {
+	db := testdb.Open(t)
+	store := storage.NewMemoryStore()
+	service := NewImageService(db, &config.Config{}, store, nil)
+	userID := newTestUser(t, db)
+
+	created, err := service.CreateImage(context.Background(), userID, &CreateImageRequest{
+		Drawing:      testPNG(t, 112, 112),
+		Segmentation: testPNG(t, 4, 4),
+		Inference:    &models.Inference{ModelVersion: "test", Width: 4, Height: 4},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var image models.Image
+	if err := db.Preload("Inference").First(&image, "id = ?", created.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if image.Status != models.ImageStatusReady || image.Inference == nil {
+		t.Errorf("image = %+v, want ready with its inference", image)
+	}
+	for _, id := range []uuid.UUID{image.SentImageID, image.ReceivedImageID} {
+		if _, err := store.Stat(context.Background(), blobName(id)); err != nil {
+			t.Errorf("blob %s: %v", id, err)
+		}
+	}
+}
+
+func TestCreateImageLeavesNothingOnUploadFailure(t *testing.T) {
+	for _, failPut := range []int{1, 2} {
+		db := testdb.Open(t)
+		store := &flakyStore{MemoryStore: storage.NewMemoryStore(), failPut: failPut}
+		service := NewImageService(db, &config.Config{}, store, nil)
+		userID := newTestUser(t, db)
+
+		_, err := service.CreateImage(context.Background(), userID, &CreateImageRequest{
+			Drawing:      testPNG(t, 112, 112),
+			Segmentation: testPNG(t, 4, 4),
+			Inference:    &models.Inference{ModelVersion: "test", Width: 4, Height: 4},
+		})
+		if err == nil {
+			t.Fatalf("put %d failing: CreateImage succeeded", failPut)
+		}
+
+		var images, inferences int64
+		db.Unscoped().Model(&models.Image{}).Count(&images)
+		db.Model(&models.Inference{}).Count(&inferences)
+		if images != 0 || inferences != 0 {
+			t.Errorf("put %d failing: %d image rows and %d inferences left", failPut, images, inferences)
+		}
+		if keys := storedKeys(t, store); len(keys) != 0 {
+			t.Errorf("put %d failing: blobs left %v", failPut, keys)
+		}
+	}
+}
+
+func TestCreateInferenceStoresTheSegmentation(t *testing.T) {
+	db := testdb.Open(t)
+	store := storage.NewMemoryStore()
+	images := NewImageService(db, &config.Config{}, store, nil)
+	server, _ := modelServer(t, http.StatusOK)
+	service := NewInferenceService(images, newTestInferenceClient(server.URL, 0, 5, 0))
+	userID := newTestUser(t, db)
+
+	response, err := service.CreateInference(context.Background(), userID, testPNG(t, 112, 112))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.SegmentationBase64 == "" || response.Inference == nil || response.Inference.ModelVersion != "test" {
+		t.Errorf("response = %+v", response)
+	}
+	if keys := storedKeys(t, store); len(keys) != 2 {
+		t.Errorf("stored %v, want the drawing and the segmentation", keys)
+	}
+}
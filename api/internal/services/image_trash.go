@@ -0,0 +1,168 @@
+package services
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Published under image_purge in GET /admin/metrics
+var purgeMetrics = expvar.NewMap("image_purge")
+
+func (s *ImageService) trashRetention() time.Duration {
+	return time.Duration(s.config.Images.TrashRetention) * time.Hour
+}
+
+// ListTrash returns the deleted images of a user that are not purged yet,
+// most recently deleted first
+func (s *ImageService) ListTrash(userID uuid.UUID, limit, offset int) ([]ImageResponse, int64, error) {
+	var images []models.Image
+	var total int64
+
+	query := s.db.Unscoped().Model(&models.Image{}).Preload("Inference.Digits").
+		Where("user_id = ? AND deleted_at IS NOT NULL", userID)
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, errors.New("failed to count images")
+	}
+	if err := query.Limit(limit).Offset(offset).Order("deleted_at DESC").Find(&images).Error; err != nil {
+		return nil, 0, errors.New("failed to fetch images")
+	}
+
+	responses := make([]ImageResponse, len(images))
+	for i := range images {
+		responses[i] = newImageResponse(&images[i], false)
+		deletedAt := images[i].DeletedAt.Time
+		responses[i].DeletedAt = deletedAt.Format("2006-01-02T15:04:05Z")
+		responses[i].PurgeAt = deletedAt.Add(s.trashRetention()).Format("2006-01-02T15:04:05Z")
+	}
+
+	return responses, total, nil
+}
+
+// RestoreImage takes an image of the user out of the trash
+func (s *ImageService) RestoreImage(imageID, userID uuid.UUID) (*ImageResponse, error) {
+	result := s.db.Unscoped().Model(&models.Image{}).
+		Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", imageID, userID).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return nil, errors.New("failed to restore image")
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("image not found")
+	}
+
+	return s.GetImageByID(&ImageViewer{UserID: userID}, imageID)
+}
+
+// CheckBlob makes sure a blob belongs to an image the viewer may see that is
+// ready and not in the trash, so blobs of deleted images are no longer served
+func (s *ImageService) CheckBlob(viewer *ImageViewer, blobID uuid.UUID) error {
+	var count int64
+	err := s.visibleImages(viewer).
+		Where("(sent_image_id = ? OR received_image_id = ?)", blobID, blobID).
+		Count(&count).Error
+	if err != nil {
+		return errors.New("failed to fetch image")
+	}
+	if count == 0 {
+		return errors.New("image not found")
+	}
+	return nil
+}
+
+// PurgeReport counts what one purge run did
+type PurgeReport struct {
+	ImagesPurged int
+	// Blobs that were still stored, a blob already gone is not counted
+	BlobsDeleted int
+	// Images that could not be purged, they are tried again on the next run
+	Failures int
+}
+
+// PurgeDeletedImages removes the blobs and rows of images that have been in
+// the trash longer than IMAGE_TRASH_RETENTION hours. An image that fails is
+// logged and skipped so it does not hold back the rest.
+func (s *ImageService) PurgeDeletedImages(ctx context.Context) (*PurgeReport, error) {
+	cutoff := utils.GetCurrentTS().Add(-s.trashRetention())
+
+	var images []models.Image
+	if err := s.db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Find(&images).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch deleted images: %w", err)
+	}
+
+	report := &PurgeReport{}
+	for i := range images {
+		deleted, err := s.removeImage(ctx, &images[i])
+		report.BlobsDeleted += deleted
+		if err != nil {
+			log.Println("Failed to purge image:", err)
+			report.Failures++
+			continue
+		}
+		report.ImagesPurged++
+	}
+	return report, nil
+}
+
+// StartPurgeWorker runs PurgeDeletedImages on the given interval until the
+// context is cancelled. An interval of zero or less disables it.
+func (s *ImageService) StartPurgeWorker(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		log.Println("Image purge disabled, IMAGE_PURGE_INTERVAL is not positive")
+		return
+	}
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.runPurge(ctx)
+			}
+		}
+	}()
+}
+
+func (s *ImageService) runPurge(ctx context.Context) {
+	start := time.Now()
+	report, err := s.PurgeDeletedImages(ctx)
+	if err != nil {
+		report = &PurgeReport{Failures: 1}
+	}
+
+	purgeMetrics.Add("runs", 1)
+	purgeMetrics.Add("images_purged", int64(report.ImagesPurged))
+	purgeMetrics.Add("blobs_deleted", int64(report.BlobsDeleted))
+	purgeMetrics.Add("failures", int64(report.Failures))
+	purgeMetrics.Set("last_run_unix", intVar(start.Unix()))
+	purgeMetrics.Set("last_duration_ms", intVar(time.Since(start).Milliseconds()))
+
+	var pending int64
+	if countErr := s.db.Unscoped().Model(&models.Image{}).Where("deleted_at IS NOT NULL").Count(&pending).Error; countErr == nil {
+		purgeMetrics.Set("trash_size", intVar(pending))
+	}
+
+	if err != nil {
+		log.Println("Image purge failed:", err)
+		return
+	}
+	if report.ImagesPurged > 0 {
+		log.Printf("Purged %d images from the trash", report.ImagesPurged)
+	}
+}
+
+func intVar(value int64) *expvar.Int {
+	v := new(expvar.Int)
+	v.Set(value)
+	return v
+}
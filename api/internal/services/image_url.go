@@ -0,0 +1,115 @@
+package services
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/storage"
+	"auth-service/internal/utils"
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	BlobKindSent     = "sent"
+	BlobKindReceived = "received"
+)
+
+// BlobURLResponse is a short-lived URL the browser can load a blob from
+// without the access token
+type BlobURLResponse struct {
+	URL       string `json:"url"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// BlobURL returns a URL for the sent or received blob of an image the viewer
+// may see, or for one of its derivatives. MinIO presigns it so the download
+// skips the API; with STORAGE_URL_MODE=signed, or a backend that cannot
+// presign, the API signs a URL to /api/v1/blobs/{id} and serves the blob
+// itself.
+func (s *ImageService) BlobURL(ctx context.Context, viewer *ImageViewer, imageID uuid.UUID, kind, variant string) (*BlobURLResponse, error) {
+	kind, err := blobKind(kind)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkVariant(variant); err != nil {
+		return nil, err
+	}
+
+	image, err := s.findImageRow(viewer, "id", imageID)
+	if err != nil {
+		return nil, err
+	}
+
+	expiry := time.Duration(s.config.Storage.URLExpiry) * time.Second
+	expiresAt := utils.GetCurrentTS().Add(expiry)
+	response := &BlobURLResponse{ExpiresAt: expiresAt.Format("2006-01-02T15:04:05Z")}
+
+	if s.config.Storage.URLMode != storage.URLModeSigned {
+		// A presigned URL points at the stored object, so the derivative has
+		// to exist before the browser asks for it
+		if variant != "" {
+			if err := s.ensureDerivative(ctx, image, kind, variant); err != nil {
+				log.Printf("Failed to render %s of image %s: %v", variant, image.ID, err)
+				return nil, errors.New("failed to render image variant")
+			}
+		}
+
+		url, err := s.store.PresignGet(ctx, variantKey(image, kind, variant), expiry)
+		if err == nil {
+			response.URL = url
+			return response, nil
+		}
+		if !errors.Is(err, storage.ErrPresignUnsupported) {
+			return nil, errors.New("failed to sign image URL")
+		}
+	}
+
+	path := signedBlobPath(blobOf(image, kind), variant)
+	response.URL = s.signer.Sign(strings.TrimRight(s.config.PublicURL, "/")+path, path, expiresAt)
+	return response, nil
+}
+
+// OpenSignedBlob opens a blob, or a derivative of it, requested through a URL
+// from BlobURL. The signature stands in for the access token, the image still
+// has to be ready and out of the trash.
+func (s *ImageService) OpenSignedBlob(ctx context.Context, blobID uuid.UUID, variant, expires, signature string) (storage.Object, *storage.ObjectInfo, error) {
+	if err := s.signer.Verify(signedBlobPath(blobID, variant), expires, signature, utils.GetCurrentTS()); err != nil {
+		return nil, nil, err
+	}
+	if err := s.checkVariant(variant); err != nil {
+		return nil, nil, err
+	}
+
+	var image models.Image
+	err := s.visibleImages(&ImageViewer{ReadAll: true}).
+		Where("(sent_image_id = ? OR received_image_id = ?)", blobID, blobID).
+		First(&image).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil, errors.New("image not found")
+		}
+		return nil, nil, errors.New("failed to fetch image")
+	}
+
+	kind := BlobKindSent
+	if image.ReceivedImageID == blobID {
+		kind = BlobKindReceived
+	}
+	return s.openVariant(ctx, &image, kind, variant)
+}
+
+// signedBlobPath is what a signature covers, the variant is part of it so a
+// thumbnail URL cannot be turned into one for the original
+func signedBlobPath(blobID uuid.UUID, variant string) string {
+	path := "/api/v1/blobs/" + blobID.String()
+	if variant != "" {
+		path += "?variant=" + url.QueryEscape(variant)
+	}
+	return path
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+)
+
+const (
+	ImageEmpty             = "image_empty"
+	ImageTooLarge          = "image_too_large"
+	ImageNotPNG            = "image_not_png"
+	ImageInvalidDimensions = "image_invalid_dimensions"
+)
+
+const (
+	// The frontend and the model work on a 112x112 grid
+	drawingSize = 112
+	// A 112x112 PNG is a few KB, anything much larger is not a drawing
+	maxDrawingBytes = 1 << 20
+	// The segmentation is the model's rendered figure, 400x400 today
+	maxSegmentationSize  = 1024
+	maxSegmentationBytes = 4 << 20
+)
+
+// ImageValidationError says why an uploaded image was refused, Field is the
+// form field it came in.
+type ImageValidationError struct {
+	Field   string                 `json:"field"`
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Params  map[string]interface{} `json:"params,omitempty"`
+}
+
+func (e *ImageValidationError) Error() string {
+	return e.Message
+}
+
+// NormalizeDrawing checks that r holds a 112x112 PNG no larger than the byte
+// cap and re-encodes it as 8-bit grayscale. The new PNG only has the pixel
+// data, any metadata chunks of the upload are gone.
+func NormalizeDrawing(field string, r io.Reader) ([]byte, error) {
+	img, err := decodePNG(field, r, maxDrawingBytes, func(width, height int) bool {
+		return width == drawingSize && height == drawingSize
+	}, fmt.Sprintf("image must be %dx%d pixels", drawingSize, drawingSize))
+	if err != nil {
+		return nil, err
+	}
+
+	gray := image.NewGray(img.Bounds())
+	draw.Draw(gray, gray.Bounds(), img, img.Bounds().Min, draw.Src)
+	return encodePNG(gray)
+}
+
+// NormalizeSegmentation checks a segmentation rendered by the model, which
+// keeps its colours, and re-encodes it without metadata.
+func NormalizeSegmentation(field string, r io.Reader) ([]byte, error) {
+	img, err := decodePNG(field, r, maxSegmentationBytes, func(width, height int) bool {
+		return width > 0 && height > 0 && width <= maxSegmentationSize && height <= maxSegmentationSize
+	}, fmt.Sprintf("image must be at most %dx%d pixels", maxSegmentationSize, maxSegmentationSize))
+	if err != nil {
+		return nil, err
+	}
+
+	rgba := image.NewNRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return encodePNG(rgba)
+}
+
+// decodePNG reads at most maxBytes and checks the dimensions from the header
+// before decoding, so a small file claiming a huge canvas (a decompression
+// bomb) is refused without allocating it.
+func decodePNG(field string, r io.Reader, maxBytes int64, validSize func(width, height int) bool, sizeMessage string) (image.Image, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, &ImageValidationError{Field: field, Code: ImageNotPNG, Message: "image could not be read"}
+	}
+	if len(data) == 0 {
+		return nil, &ImageValidationError{Field: field, Code: ImageEmpty, Message: "image is empty"}
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, &ImageValidationError{
+			Field:   field,
+			Code:    ImageTooLarge,
+			Message: fmt.Sprintf("image must be at most %d bytes", maxBytes),
+			Params:  map[string]interface{}{"max_bytes": maxBytes},
+		}
+	}
+
+	cfg, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, &ImageValidationError{Field: field, Code: ImageNotPNG, Message: "image must be a PNG"}
+	}
+	if !validSize(cfg.Width, cfg.Height) {
+		return nil, &ImageValidationError{
+			Field:   field,
+			Code:    ImageInvalidDimensions,
+			Message: sizeMessage,
+			Params:  map[string]interface{}{"width": cfg.Width, "height": cfg.Height},
+		}
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, &ImageValidationError{Field: field, Code: ImageNotPNG, Message: "image must be a PNG"}
+	}
+	return img, nil
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+
+	"github.com/google/uuid"
+)
+
+// InferenceService runs the model on a drawing and stores the drawing, the
+// segmentation, the Image row that links them and the structured Inference.
+type InferenceService struct {
+	imageService *ImageService
+	client       InferenceClient
+}
+
+func NewInferenceService(imageService *ImageService, client InferenceClient) *InferenceService {
+	return &InferenceService{
+		imageService: imageService,
+		client:       client,
+	}
+}
+
+type InferenceResponse struct {
+	*ImageResponse
+	SegmentationBase64 string `json:"segmentation_base64"`
+}
+
+func (s *InferenceService) CreateInference(ctx context.Context, userID uuid.UUID, drawing []byte) (*InferenceResponse, error) {
+	drawing, err := NormalizeDrawing("drawing", bytes.NewReader(drawing))
+	if err != nil {
+		return nil, err
+	}
+
+	segmentation, err := s.client.Segment(ctx, drawing)
+	if err != nil {
+		return nil, err
+	}
+	if segmentation.Image, err = NormalizeSegmentation("segmentation", bytes.NewReader(segmentation.Image)); err != nil {
+		return nil, ErrInferenceBadResponse
+	}
+
+	inference, err := newInference(segmentation)
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := s.imageService.CreateImage(ctx, userID, &CreateImageRequest{
+		Drawing:      drawing,
+		Segmentation: segmentation.Image,
+		Inference:    inference,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &InferenceResponse{
+		ImageResponse:      image,
+		SegmentationBase64: base64.StdEncoding.EncodeToString(segmentation.Image),
+	}, nil
+}
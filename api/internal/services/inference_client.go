@@ -0,0 +1,236 @@
+package services
+
+import (
+	"auth-service/internal/config"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInferenceUnavailable is returned while the circuit breaker is open
+	// or when every attempt failed on the service side
+	ErrInferenceUnavailable = errors.New("inference service unavailable")
+	// ErrInferenceRejected is returned when the model answered 4xx, retrying
+	// the same drawing would not help
+	ErrInferenceRejected = errors.New("inference service rejected the drawing")
+	// ErrInferenceBadResponse is returned when the model answered 2xx with a
+	// body that is not a segmentation
+	ErrInferenceBadResponse = errors.New("invalid response from inference service")
+)
+
+// InferenceClient sends a drawing to the segmentation model and returns its
+// segmentation
+type InferenceClient interface {
+	Segment(ctx context.Context, drawing []byte) (*Segmentation, error)
+}
+
+// Segmentation is the rendered segmentation plus the raw per-pixel classes
+// behind it. Older model versions only send the image, ClassMap is empty then.
+type Segmentation struct {
+	Image        []byte
+	ClassMap     []byte
+	Width        int
+	Height       int
+	Confidences  map[string]float64
+	ModelVersion string
+	Latency      time.Duration
+}
+
+// HTTPInferenceClient talks to the FastAPI model service in ia/. Failed calls
+// are retried with exponential backoff and a circuit breaker stops calling a
+// service that keeps failing.
+type HTTPInferenceClient struct {
+	url          string
+	httpClient   *http.Client
+	maxRetries   int
+	retryBackoff time.Duration
+	breaker      *circuitBreaker
+}
+
+func NewHTTPInferenceClient(cfg config.InferenceConfig) *HTTPInferenceClient {
+	return &HTTPInferenceClient{
+		url:          cfg.URL,
+		httpClient:   &http.Client{Timeout: time.Duration(cfg.Timeout) * time.Second},
+		maxRetries:   cfg.MaxRetries,
+		retryBackoff: time.Duration(cfg.RetryBackoff) * time.Millisecond,
+		breaker:      newCircuitBreaker(cfg.BreakerThreshold, time.Duration(cfg.BreakerCooldown)*time.Second),
+	}
+}
+
+type segmentationResponse struct {
+	SegmentationBase64 string             `json:"segmentation_base64"`
+	ClassMapBase64     string             `json:"class_map_base64"`
+	Width              int                `json:"width"`
+	Height             int                `json:"height"`
+	Confidences        map[string]float64 `json:"confidences"`
+	ModelVersion       string             `json:"model_version"`
+}
+
+// retryableError marks failures worth another attempt, network errors and
+// 5xx answers
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+
+func (c *HTTPInferenceClient) Segment(ctx context.Context, drawing []byte) (*Segmentation, error) {
+	if !c.breaker.allow() {
+		return nil, ErrInferenceUnavailable
+	}
+
+	backoff := c.retryBackoff
+	for attempt := 0; ; attempt++ {
+		segmentation, err := c.call(ctx, drawing)
+
+		var retryable *retryableError
+		if err == nil || !errors.As(err, &retryable) {
+			// Only failures of the service count against the breaker, a
+			// rejected drawing says nothing about its health
+			c.breaker.success()
+			return segmentation, err
+		}
+
+		// A caller that gave up says nothing about the service either
+		if ctx.Err() != nil {
+			c.breaker.release()
+			return nil, fmt.Errorf("%w: %v", ErrInferenceUnavailable, ctx.Err())
+		}
+		if attempt >= c.maxRetries {
+			c.breaker.failure()
+			return nil, fmt.Errorf("%w: %v", ErrInferenceUnavailable, retryable.err)
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			c.breaker.release()
+			return nil, fmt.Errorf("%w: %v", ErrInferenceUnavailable, ctx.Err())
+		}
+		backoff *= 2
+	}
+}
+
+func (c *HTTPInferenceClient) call(ctx context.Context, drawing []byte) (*Segmentation, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("image", "drawing.png")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(drawing); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, &retryableError{err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return nil, &retryableError{fmt.Errorf("inference service answered %s", resp.Status)}
+	}
+	if resp.StatusCode >= 400 {
+		return nil, ErrInferenceRejected
+	}
+
+	var result segmentationResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(&result); err != nil {
+		return nil, ErrInferenceBadResponse
+	}
+	latency := time.Since(start)
+
+	image, err := base64.StdEncoding.DecodeString(result.SegmentationBase64)
+	if err != nil || len(image) == 0 {
+		return nil, ErrInferenceBadResponse
+	}
+	classMap, err := base64.StdEncoding.DecodeString(result.ClassMapBase64)
+	if err != nil || len(classMap) != result.Width*result.Height {
+		return nil, ErrInferenceBadResponse
+	}
+
+	return &Segmentation{
+		Image:        image,
+		ClassMap:     classMap,
+		Width:        result.Width,
+		Height:       result.Height,
+		Confidences:  result.Confidences,
+		ModelVersion: result.ModelVersion,
+		Latency:      latency,
+	}, nil
+}
+
+// circuitBreaker opens after threshold consecutive failures. Once cooldown
+// has passed a single trial call is let through (half-open), its result
+// closes the breaker again or restarts the cooldown.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+	trial     bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return true
+	}
+	if b.trial || time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.trial = false
+}
+
+// release ends a call that neither succeeded nor failed, letting the next
+// trial through when it was the half-open one
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.trial = false
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
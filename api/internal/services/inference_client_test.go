@@ -0,0 +1,184 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"auth-service/internal/config"
+)
+
+// modelServer answers each call with the next status of statuses, repeating
+// the last one, and counts the calls. 200 answers carry a 4x4 segmentation.
+func modelServer(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := int(calls.Add(1)) - 1
+		status := statuses[min(call, len(statuses)-1)]
+		if status != http.StatusOK {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		if _, _, err := r.FormFile("image"); err != nil {
+			http.Error(w, "no image", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(segmentationResponse{
+			SegmentationBase64: base64.StdEncoding.EncodeToString(testPNG(t, 4, 4)),
+			ClassMapBase64:     base64.StdEncoding.EncodeToString(make([]byte, 16)),
+			Width:              4,
+			Height:             4,
+			ModelVersion:       "test",
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newTestInferenceClient(url string, maxRetries, threshold int, cooldown time.Duration) *HTTPInferenceClient {
+	client := NewHTTPInferenceClient(config.InferenceConfig{
+		URL:          url,
+		Timeout:      5,
+		MaxRetries:   maxRetries,
+		RetryBackoff: 1,
+	})
+	client.breaker = newCircuitBreaker(threshold, cooldown)
+	return client
+}
+
+func TestSegmentRetriesServerErrors(t *testing.T) {
+	server, calls := modelServer(t, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK)
+	client := newTestInferenceClient(server.URL, 2, 5, time.Minute)
+
+	segmentation, err := client.Segment(context.Background(), testPNG(t, 112, 112))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("calls = %d, want 3", calls.Load())
+	}
+	if segmentation.Width != 4 || segmentation.ModelVersion != "test" {
+		t.Errorf("segmentation = %+v", segmentation)
+	}
+}
+
+func TestSegmentGivesUpAfterMaxRetries(t *testing.T) {
+	server, calls := modelServer(t, http.StatusInternalServerError)
+	client := newTestInferenceClient(server.URL, 2, 5, time.Minute)
+
+	_, err := client.Segment(context.Background(), testPNG(t, 112, 112))
+	if !errors.Is(err, ErrInferenceUnavailable) {
+		t.Fatalf("err = %v, want ErrInferenceUnavailable", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("calls = %d, want 3", calls.Load())
+	}
+}
+
+func TestSegmentDoesNotRetryRejections(t *testing.T) {
+	server, calls := modelServer(t, http.StatusBadRequest)
+	client := newTestInferenceClient(server.URL, 3, 1, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		_, err := client.Segment(context.Background(), testPNG(t, 112, 112))
+		if !errors.Is(err, ErrInferenceRejected) {
+			t.Fatalf("err = %v, want ErrInferenceRejected", err)
+		}
+	}
+	// A rejected drawing is not a failure of the service, the breaker with
+	// a threshold of 1 stays closed
+	if calls.Load() != 3 {
+		t.Errorf("calls = %d, want 3", calls.Load())
+	}
+}
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	server, calls := modelServer(t, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusOK)
+	cooldown := 50 * time.Millisecond
+	client := newTestInferenceClient(server.URL, 0, 2, cooldown)
+	drawing := testPNG(t, 112, 112)
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Segment(context.Background(), drawing); !errors.Is(err, ErrInferenceUnavailable) {
+			t.Fatalf("call %d: err = %v", i, err)
+		}
+	}
+
+	// Open: answered without calling the model
+	if _, err := client.Segment(context.Background(), drawing); !errors.Is(err, ErrInferenceUnavailable) {
+		t.Fatalf("open breaker: err = %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("open breaker called the model, calls = %d", calls.Load())
+	}
+
+	// Half-open: one trial, which fails and restarts the cooldown
+	time.Sleep(cooldown)
+	if _, err := client.Segment(context.Background(), drawing); !errors.Is(err, ErrInferenceUnavailable) {
+		t.Fatalf("failed trial: err = %v", err)
+	}
+	if _, err := client.Segment(context.Background(), drawing); !errors.Is(err, ErrInferenceUnavailable) || calls.Load() != 3 {
+		t.Fatalf("breaker did not reopen after the failed trial, calls = %d", calls.Load())
+	}
+
+	// The next trial succeeds and closes the breaker
+	time.Sleep(cooldown)
+	if _, err := client.Segment(context.Background(), drawing); err != nil {
+		t.Fatalf("successful trial: err = %v", err)
+	}
+	if _, err := client.Segment(context.Background(), drawing); err != nil {
+		t.Fatalf("closed breaker: err = %v", err)
+	}
+	if calls.Load() != 5 {
+		t.Errorf("calls = %d, want 5", calls.Load())
+	}
+}
+
+func TestSegmentCancellationIsNotAFailure(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		http.Error(w, "too late", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := newTestInferenceClient(server.URL, 3, 1, time.Minute)
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err := client.Segment(ctx, testPNG(t, 112, 112))
+		cancel()
+		if !errors.Is(err, ErrInferenceUnavailable) {
+			t.Fatalf("err = %v, want ErrInferenceUnavailable", err)
+		}
+	}
+
+	if !client.breaker.allow() {
+		t.Error("cancelled calls opened the breaker")
+	}
+}
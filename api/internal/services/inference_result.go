@@ -0,0 +1,155 @@
+package services
+
+import (
+	"auth-service/internal/models"
+	"bytes"
+	"compress/zlib"
+	"io"
+	"strconv"
+)
+
+// Regions smaller than this many pixels are speckles of the model, not digits
+const minDigitPixels = 16
+
+// InferenceResult is the structured model output exposed on ImageResponse.
+// ClassMap is only filled when a single image is fetched.
+type InferenceResult struct {
+	ModelVersion string                  `json:"model_version"`
+	LatencyMS    int64                   `json:"latency_ms"`
+	Width        int                     `json:"width"`
+	Height       int                     `json:"height"`
+	Digits       []models.InferenceDigit `json:"digits"`
+	ClassMap     []byte                  `json:"class_map,omitempty"`
+}
+
+// newInference turns a segmentation into the record stored next to its
+// image, the class map is split into one region per connected digit
+func newInference(segmentation *Segmentation) (*models.Inference, error) {
+	classMap, err := compressClassMap(segmentation.ClassMap)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Inference{
+		ModelVersion: segmentation.ModelVersion,
+		LatencyMS:    segmentation.Latency.Milliseconds(),
+		Width:        segmentation.Width,
+		Height:       segmentation.Height,
+		ClassMap:     classMap,
+		Digits:       findDigits(segmentation.ClassMap, segmentation.Width, segmentation.Height, segmentation.Confidences),
+	}, nil
+}
+
+func newInferenceResult(inference *models.Inference, withClassMap bool) *InferenceResult {
+	result := &InferenceResult{
+		ModelVersion: inference.ModelVersion,
+		LatencyMS:    inference.LatencyMS,
+		Width:        inference.Width,
+		Height:       inference.Height,
+		Digits:       inference.Digits,
+	}
+	if result.Digits == nil {
+		result.Digits = []models.InferenceDigit{}
+	}
+	if withClassMap {
+		// A corrupt map only costs the map, the rest is still worth showing
+		result.ClassMap, _ = decompressClassMap(inference.ClassMap)
+	}
+	return result
+}
+
+// classDigit maps a model class to the digit it stands for, class 0 is the
+// background and class 10 the digit 0
+func classDigit(class byte) (int, bool) {
+	if class == 0 || class > 10 {
+		return 0, false
+	}
+	return int(class) % 10, true
+}
+
+// findDigits labels the 4-connected regions of each class and returns the
+// ones large enough to be a digit, in reading order of their first pixel.
+// The model reports one confidence per digit, every region of that digit
+// gets it.
+func findDigits(classMap []byte, width, height int, confidences map[string]float64) []models.InferenceDigit {
+	digits := []models.InferenceDigit{}
+	visited := make([]bool, len(classMap))
+	stack := []int{}
+
+	for start := range classMap {
+		digit, ok := classDigit(classMap[start])
+		if visited[start] || !ok {
+			continue
+		}
+
+		region := models.InferenceDigit{
+			Digit:      digit,
+			Confidence: confidences[strconv.Itoa(digit)],
+			X:          width,
+			Y:          height,
+		}
+		maxX, maxY := -1, -1
+
+		visited[start] = true
+		stack = append(stack[:0], start)
+		for len(stack) > 0 {
+			pixel := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			x, y := pixel%width, pixel/width
+			region.Pixels++
+			region.X = min(region.X, x)
+			region.Y = min(region.Y, y)
+			maxX = max(maxX, x)
+			maxY = max(maxY, y)
+
+			for _, next := range [4][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+				if next[0] < 0 || next[0] >= width || next[1] < 0 || next[1] >= height {
+					continue
+				}
+				neighbour := next[1]*width + next[0]
+				if !visited[neighbour] && classMap[neighbour] == classMap[start] {
+					visited[neighbour] = true
+					stack = append(stack, neighbour)
+				}
+			}
+		}
+
+		if region.Pixels < minDigitPixels {
+			continue
+		}
+		region.Width = maxX - region.X + 1
+		region.Height = maxY - region.Y + 1
+		digits = append(digits, region)
+	}
+
+	return digits
+}
+
+// The class map is mostly background, zlib gets it to a few hundred bytes
+func compressClassMap(classMap []byte) ([]byte, error) {
+	if len(classMap) == 0 {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	writer := zlib.NewWriter(&buf)
+	if _, err := writer.Write(classMap); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompressClassMap(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"auth-service/internal/config"
+	"auth-service/internal/models"
+
+	"github.com/go-ldap/ldap/v3"
+	"gorm.io/gorm"
+)
+
+// ErrDirectoryUnavailable is returned when the LDAP server cannot be reached
+// or the service account cannot bind.
+var ErrDirectoryUnavailable = errors.New("directory unavailable")
+
+// LDAPAuthenticator authenticates against a directory with the usual search
+// then bind: the service account finds the user's DN, then the user's
+// password is checked by binding as that DN. Directory users are mirrored into
+// the users table and their groups into roles.
+type LDAPAuthenticator struct {
+	db         *gorm.DB
+	config     config.LDAPConfig
+	groupRoles map[string]string
+}
+
+func NewLDAPAuthenticator(db *gorm.DB, cfg config.LDAPConfig) *LDAPAuthenticator {
+	return &LDAPAuthenticator{
+		db:         db,
+		config:     cfg,
+		groupRoles: parseGroupRoles(cfg.GroupRoles),
+	}
+}
+
+type directoryUser struct {
+	DN       string
+	Email    string
+	Name     string
+	Username string
+	Groups   []string
+}
+
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, identifier, password string) (*models.User, error) {
+	// An empty password would be an unauthenticated bind, which succeeds
+	if identifier == "" || password == "" {
+		return nil, errors.New("invalid credentials")
+	}
+
+	// A directory that hangs must not hold the login, the local users
+	// are tried once it gives up
+	timeout := time.Duration(a.config.Timeout) * time.Second
+	conn, err := ldap.DialURL(a.config.URL, ldap.DialWithDialer(&net.Dialer{Timeout: timeout}))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDirectoryUnavailable, err)
+	}
+	defer conn.Close()
+	conn.SetTimeout(timeout)
+
+	if err := conn.Bind(a.config.BindDN, a.config.BindPassword); err != nil {
+		return nil, fmt.Errorf("%w: service bind failed: %v", ErrDirectoryUnavailable, err)
+	}
+
+	entry, err := a.findEntry(conn, identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, errors.New("invalid credentials")
+		}
+		return nil, fmt.Errorf("%w: %v", ErrDirectoryUnavailable, err)
+	}
+
+	return a.syncUser(ctx, entry)
+}
+
+func (a *LDAPAuthenticator) findEntry(conn *ldap.Conn, identifier string) (*directoryUser, error) {
+	filter := strings.ReplaceAll(a.config.UserFilter, "%s", ldap.EscapeFilter(identifier))
+	request := ldap.NewSearchRequest(
+		a.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 10, false,
+		filter,
+		[]string{a.config.EmailAttr, a.config.NameAttr, a.config.UsernameAttr, a.config.GroupAttr},
+		nil,
+	)
+
+	result, err := conn.Search(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: search failed: %v", ErrDirectoryUnavailable, err)
+	}
+
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrUnknownUser
+	case 1:
+	default:
+		// Ambiguous identifiers must not pick an arbitrary account
+		return nil, errors.New("invalid credentials")
+	}
+
+	entry := result.Entries[0]
+	user := &directoryUser{
+		DN:       entry.DN,
+		Email:    entry.GetAttributeValue(a.config.EmailAttr),
+		Name:     entry.GetAttributeValue(a.config.NameAttr),
+		Username: entry.GetAttributeValue(a.config.UsernameAttr),
+		Groups:   entry.GetAttributeValues(a.config.GroupAttr),
+	}
+	if user.Email == "" {
+		return nil, errors.New("directory entry has no email")
+	}
+	if user.Name == "" {
+		user.Name = user.Email
+	}
+	if user.Username == "" {
+		user.Username = strings.Split(user.Email, "@")[0]
+	}
+
+	return user, nil
+}
+
+// syncUser creates or refreshes the local copy of a directory user and
+// reconciles the roles managed through group mappings. Roles granted by hand
+// that no mapping covers are left alone.
+func (a *LDAPAuthenticator) syncUser(ctx context.Context, entry *directoryUser) (*models.User, error) {
+	var user models.User
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Preload("Roles").Where("email = ?", entry.Email).First(&user).Error
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			// The directory's username may already belong to a local user
+			username, err := availableUsername(tx, entry.Username)
+			if err != nil {
+				return err
+			}
+			password, err := randomURLToken()
+			if err != nil {
+				return err
+			}
+			user = models.User{
+				Email:    entry.Email,
+				Name:     entry.Name,
+				Username: username,
+				Password: password,
+				IsActive: true,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			log.Printf("Provisioned user %s from directory entry %s", user.ID, entry.DN)
+		case err != nil:
+			return err
+		default:
+			if err := tx.Model(&user).Update("name", entry.Name).Error; err != nil {
+				return err
+			}
+		}
+
+		return a.syncRoles(tx, &user, entry.Groups)
+	})
+	if err != nil {
+		return nil, errors.New("failed to sync directory user")
+	}
+
+	if !user.IsActive {
+		return nil, errors.New("user is inactive")
+	}
+
+	return &user, nil
+}
+
+func (a *LDAPAuthenticator) syncRoles(tx *gorm.DB, user *models.User, groups []string) error {
+	wanted := map[string]bool{models.RoleUser: true}
+	for _, group := range groups {
+		if role, ok := a.groupRoles[groupCN(group)]; ok {
+			wanted[role] = true
+		}
+	}
+
+	managed := map[string]bool{}
+	for _, role := range a.groupRoles {
+		managed[role] = true
+	}
+
+	current := map[string]bool{}
+	var remove []models.Role
+	for _, role := range user.Roles {
+		current[role.Name] = true
+		if managed[role.Name] && !wanted[role.Name] {
+			remove = append(remove, role)
+		}
+	}
+
+	var missing []string
+	for name := range wanted {
+		if !current[name] {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(remove) > 0 {
+		if err := tx.Model(user).Association("Roles").Delete(remove); err != nil {
+			return err
+		}
+	}
+
+	if len(missing) > 0 {
+		var roles []models.Role
+		if err := tx.Where("name IN ?", missing).Find(&roles).Error; err != nil {
+			return err
+		}
+		if len(roles) > 0 {
+			if err := tx.Model(user).Association("Roles").Append(roles); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// groupCN extracts the common name of a group DN, or returns the value as is
+// when it is not a DN (e.g. posixGroup memberships).
+func groupCN(group string) string {
+	dn, err := ldap.ParseDN(group)
+	if err != nil || len(dn.RDNs) == 0 {
+		return group
+	}
+	for _, attr := range dn.RDNs[0].Attributes {
+		if strings.EqualFold(attr.Type, "cn") {
+			return attr.Value
+		}
+	}
+	return group
+}
+
+func parseGroupRoles(raw string) map[string]string {
+	mapping := map[string]string{}
+	for _, pair := range strings.Split(raw, ",") {
+		group, role, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || group == "" || role == "" {
+			continue
+		}
+		mapping[group] = role
+	}
+	return mapping
+}
@@ -0,0 +1,341 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"auth-service/internal/config"
+	"auth-service/internal/models"
+	"auth-service/internal/testdb"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	testServiceDN       = "cn=svc,dc=school,dc=test"
+	testServicePassword = "svc-secret"
+)
+
+type testDirectoryEntry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+// testDirectory is an LDAP server that answers simple binds and searches
+// whose filter matches one of its keys exactly. It records every bind so
+// tests can check the order of the search-then-bind.
+type testDirectory struct {
+	listener net.Listener
+	// Filter to the entries it returns
+	entries map[string][]testDirectoryEntry
+
+	mu    sync.Mutex
+	binds []string
+}
+
+func newTestDirectory(t *testing.T, entries map[string][]testDirectoryEntry) *testDirectory {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	directory := &testDirectory{listener: listener, entries: entries}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go directory.serve(conn)
+		}
+	}()
+	return directory
+}
+
+func (d *testDirectory) URL() string {
+	return "ldap://" + d.listener.Addr().String()
+}
+
+func (d *testDirectory) Binds() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.binds...)
+}
+
+func (d *testDirectory) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		request, err := ber.ReadPacket(conn)
+		if err != nil || len(request.Children) < 2 {
+			return
+		}
+		id := request.Children[0].Value.(int64)
+		op := request.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			d.mu.Lock()
+			d.binds = append(d.binds, dn)
+			d.mu.Unlock()
+
+			code := int64(ldap.LDAPResultInvalidCredentials)
+			if d.checkPassword(dn, password) {
+				code = ldap.LDAPResultSuccess
+			}
+			conn.Write(ldapResult(id, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			filter, err := ldap.DecompileFilter(op.Children[6])
+			if err != nil {
+				conn.Write(ldapResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError).Bytes())
+				continue
+			}
+			for _, entry := range d.entries[filter] {
+				conn.Write(ldapEntry(id, entry).Bytes())
+			}
+			conn.Write(ldapResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+		default:
+			return
+		}
+	}
+}
+
+func (d *testDirectory) checkPassword(dn, password string) bool {
+	if dn == testServiceDN {
+		return password == testServicePassword
+	}
+	for _, entries := range d.entries {
+		for _, entry := range entries {
+			if entry.DN == dn {
+				return password == entry.Password
+			}
+		}
+	}
+	return false
+}
+
+func ldapResult(id int64, tag ber.Tag, code int64) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return ldapMessage(id, op)
+}
+
+func ldapEntry(id int64, entry testDirectoryEntry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "Object Name"))
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range entry.Attributes {
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	op.AppendChild(attributes)
+	return ldapMessage(id, op)
+}
+
+func ldapMessage(id int64, op *ber.Packet) *ber.Packet {
+	message := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Message")
+	message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+	message.AppendChild(op)
+	return message
+}
+
+func newTestLDAPAuthenticator(t *testing.T, url string) *LDAPAuthenticator {
+	t.Helper()
+
+	db := testdb.Open(t)
+	for _, name := range []string{models.RoleUser, models.RoleAdmin} {
+		if err := db.Create(&models.Role{Name: name}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewLDAPAuthenticator(db, config.LDAPConfig{
+		URL:          url,
+		BindDN:       testServiceDN,
+		BindPassword: testServicePassword,
+		BaseDN:       "dc=school,dc=test",
+		UserFilter:   "(mail=%s)",
+		EmailAttr:    "mail",
+		NameAttr:     "cn",
+		UsernameAttr: "uid",
+		GroupAttr:    "memberOf",
+		GroupRoles:   "teachers:admin",
+		Timeout:      2,
+	})
+}
+
+func TestLDAPAuthenticator(t *testing.T) {
+	ada := testDirectoryEntry{
+		DN:       "uid=ada,ou=people,dc=school,dc=test",
+		Password: "analytical",
+		Attributes: map[string][]string{
+			"mail":     {"ada@school.test"},
+			"cn":       {"Ada Lovelace"},
+			"uid":      {"ada"},
+			"memberOf": {"cn=teachers,ou=groups,dc=school,dc=test"},
+		},
+	}
+	twin := testDirectoryEntry{DN: "uid=twin,ou=people,dc=school,dc=test", Password: "twin", Attributes: map[string][]string{"mail": {"twin@school.test"}}}
+	directory := newTestDirectory(t, map[string][]testDirectoryEntry{
+		"(mail=ada@school.test)":  {ada},
+		"(mail=twin@school.test)": {twin, twin},
+		// What an unescaped wildcard would turn the filter into
+		"(mail=*)": {ada},
+	})
+
+	cases := []struct {
+		name       string
+		identifier string
+		password   string
+		wantErr    error
+		wantMsg    string
+		// DNs bound as, in order
+		wantBinds []string
+	}{
+		{"valid", "ada@school.test", "analytical", nil, "", []string{testServiceDN, ada.DN}},
+		{"wrong password", "ada@school.test", "babbage", nil, "invalid credentials", []string{testServiceDN, ada.DN}},
+		{"empty password", "ada@school.test", "", nil, "invalid credentials", nil},
+		{"unknown user", "grace@school.test", "navy", ErrUnknownUser, "", []string{testServiceDN}},
+		{"wildcard is escaped", "*", "analytical", ErrUnknownUser, "", []string{testServiceDN}},
+		{"ambiguous", "twin@school.test", "twin", nil, "invalid credentials", []string{testServiceDN}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			authenticator := newTestLDAPAuthenticator(t, directory.URL())
+			before := len(directory.Binds())
+
+			user, err := authenticator.Authenticate(context.Background(), tc.identifier, tc.password)
+			switch {
+			case tc.wantErr != nil:
+				if !errors.Is(err, tc.wantErr) {
+					t.Errorf("err = %v, want %v", err, tc.wantErr)
+				}
+			case tc.wantMsg != "":
+				if err == nil || err.Error() != tc.wantMsg {
+					t.Errorf("err = %v, want %s", err, tc.wantMsg)
+				}
+			case err != nil:
+				t.Fatal(err)
+			default:
+				if user.Email != "ada@school.test" || user.Name != "Ada Lovelace" || user.Username != "ada" {
+					t.Errorf("user = %+v", user)
+				}
+				var synced models.User
+				if err := authenticator.db.Preload("Roles").First(&synced, "id = ?", user.ID).Error; err != nil {
+					t.Fatal(err)
+				}
+				roles := map[string]bool{}
+				for _, role := range synced.Roles {
+					roles[role.Name] = true
+				}
+				if len(roles) != 2 || !roles[models.RoleAdmin] || !roles[models.RoleUser] {
+					t.Errorf("roles = %v, want admin and user", roles)
+				}
+			}
+
+			binds := directory.Binds()[before:]
+			if len(binds) != len(tc.wantBinds) {
+				t.Fatalf("binds = %v, want %v", binds, tc.wantBinds)
+			}
+			for i := range binds {
+				if binds[i] != tc.wantBinds[i] {
+					t.Errorf("binds = %v, want %v", binds, tc.wantBinds)
+				}
+			}
+		})
+	}
+}
+
+func TestLDAPAuthenticatorUnavailable(t *testing.T) {
+	directory := newTestDirectory(t, nil)
+
+	// The service account cannot bind
+	authenticator := newTestLDAPAuthenticator(t, directory.URL())
+	authenticator.config.BindPassword = "rotated"
+	if _, err := authenticator.Authenticate(context.Background(), "ada@school.test", "analytical"); !errors.Is(err, ErrDirectoryUnavailable) {
+		t.Errorf("bad service password: err = %v, want directory unavailable", err)
+	}
+
+	// Nothing listens on the port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := "ldap://" + listener.Addr().String()
+	listener.Close()
+	if _, err := newTestLDAPAuthenticator(t, closed).Authenticate(context.Background(), "ada@school.test", "analytical"); !errors.Is(err, ErrDirectoryUnavailable) {
+		t.Errorf("no server: err = %v, want directory unavailable", err)
+	}
+}
+
+// stubAuthenticator answers every login with the same result and counts calls
+type stubAuthenticator struct {
+	user  *models.User
+	err   error
+	calls int
+}
+
+func (a *stubAuthenticator) Authenticate(ctx context.Context, identifier, password string) (*models.User, error) {
+	a.calls++
+	return a.user, a.err
+}
+
+func TestChainAuthenticator(t *testing.T) {
+	local := &models.User{Email: "ada@school.test"}
+
+	cases := []struct {
+		name       string
+		first      error
+		wantUser   bool
+		wantMsg    string
+		wantCalled bool
+	}{
+		{"unknown to the directory", ErrUnknownUser, true, "", true},
+		{"directory unavailable", ErrDirectoryUnavailable, true, "", true},
+		{"wrapped unavailable", errors.Join(ErrDirectoryUnavailable, errors.New("i/o timeout")), true, "", true},
+		{"wrong directory password", errors.New("invalid credentials"), false, "invalid credentials", false},
+		{"inactive directory user", errors.New("user is inactive"), false, "user is inactive", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			directory := &stubAuthenticator{err: tc.first}
+			fallback := &stubAuthenticator{user: local}
+
+			user, err := NewChainAuthenticator(directory, fallback).Authenticate(context.Background(), "ada@school.test", "pw")
+			if tc.wantUser && (err != nil || user != local) {
+				t.Errorf("user = %v, err = %v, want the fallback's user", user, err)
+			}
+			if !tc.wantUser && (err == nil || err.Error() != tc.wantMsg) {
+				t.Errorf("err = %v, want %s", err, tc.wantMsg)
+			}
+			if (fallback.calls == 1) != tc.wantCalled {
+				t.Errorf("fallback called %d times", fallback.calls)
+			}
+		})
+	}
+
+	// Nobody knows the user
+	chain := NewChainAuthenticator(&stubAuthenticator{err: ErrUnknownUser}, &stubAuthenticator{err: ErrUnknownUser})
+	if _, err := chain.Authenticate(context.Background(), "nobody@school.test", "pw"); err == nil || err.Error() != "invalid credentials" {
+		t.Errorf("err = %v, want invalid credentials", err)
+	}
+}
@@ -1,19 +1,26 @@
 package services
 
 import (
-	"github.com/minio/minio-go/v7"
+	"auth-service/internal/storage"
+	"context"
+	"io"
 )
 
 type MinioService struct {
-	MinioClient *minio.Client
+	Store storage.BlobStore
 }
 
-func NewMinioService(minioClient *minio.Client) *MinioService {
+func NewMinioService(store storage.BlobStore) *MinioService {
 	return &MinioService{
-		MinioClient: minioClient,
+		Store: store,
 	}
 }
 
-func (ms *MinioService) StoreImage() {
+func (ms *MinioService) StoreImage(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	return ms.Store.Put(ctx, key, r, size, contentType)
+}
 
+// GetImage opens a stored object, the caller must close it
+func (ms *MinioService) GetImage(ctx context.Context, key string) (storage.Object, *storage.ObjectInfo, error) {
+	return ms.Store.Get(ctx, key)
 }
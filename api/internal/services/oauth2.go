@@ -1,6 +1,10 @@
 package services
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"log"
@@ -9,25 +13,27 @@ import (
 	"time"
 
 	"auth-service/internal/config"
+	"auth-service/internal/hashing"
 	"auth-service/internal/models"
 	"auth-service/internal/utils"
 
 	"slices"
 
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type OAuth2Service struct {
-	db     *gorm.DB
-	config *config.Config
+	db            *gorm.DB
+	config        *config.Config
+	authenticator Authenticator
 }
 
-func NewOAuth2Service(db *gorm.DB, cfg *config.Config) *OAuth2Service {
+func NewOAuth2Service(db *gorm.DB, cfg *config.Config, authenticator Authenticator) *OAuth2Service {
 	return &OAuth2Service{
-		db:     db,
-		config: cfg,
+		db:            db,
+		config:        cfg,
+		authenticator: authenticator,
 	}
 }
 
@@ -39,6 +45,9 @@ type AuthorizeRequest struct {
 	State               string `json:"state" form:"state"`
 	CodeChallenge       string `json:"code_challenge" form:"code_challenge"`
 	CodeChallengeMethod string `json:"code_challenge_method" form:"code_challenge_method"`
+	// Re-authentication hints for session based logins
+	Prompt string `json:"prompt" form:"prompt"`
+	MaxAge *int   `json:"max_age" form:"max_age"`
 	// Kong-specific fields
 	ProvisionKey        string `json:"provision_key" form:"provision_key"`
 	AuthenticatedUserID string `json:"authenticated_userid" form:"authenticated_userid"`
@@ -50,6 +59,7 @@ type TokenRequest struct {
 	ClientSecret string `json:"client_secret" form:"client_secret"`
 	RedirectURI  string `json:"redirect_uri" form:"redirect_uri"`
 	Code         string `json:"code" form:"code"`
+	CodeVerifier string `json:"code_verifier" form:"code_verifier"`
 	RefreshToken string `json:"refresh_token" form:"refresh_token"`
 	Scope        string `json:"scope" form:"scope"`
 	// Kong-specific fields
@@ -89,6 +99,33 @@ func (s *OAuth2Service) Authorize(req *AuthorizeRequest) (*AuthorizeResponse, er
 		return nil, errors.New("invalid provision key")
 	}
 
+	return s.authorize(req)
+}
+
+// AuthorizeForUser handles a request whose user was authenticated through a
+// login session on this server instead of by Kong, so no provision key is
+// involved.
+func (s *OAuth2Service) AuthorizeForUser(req *AuthorizeRequest, userID uuid.UUID) (*AuthorizeResponse, error) {
+	req.AuthenticatedUserID = userID.String()
+	return s.authorize(req)
+}
+
+// CheckRedirectURI reports whether redirectURI is registered for the client.
+// Until it passes, errors must not be sent to redirectURI, it could point
+// anywhere.
+func (s *OAuth2Service) CheckRedirectURI(clientID, redirectURI string) error {
+	var app models.OAuth2Credential
+	if err := s.db.Where("client_id = ?", clientID).First(&app).Error; err != nil {
+		return errors.New("invalid client")
+	}
+
+	if !s.isValidRedirectURI(redirectURI, app.RedirectURIs) {
+		return errors.New("invalid redirect URI")
+	}
+	return nil
+}
+
+func (s *OAuth2Service) authorize(req *AuthorizeRequest) (*AuthorizeResponse, error) {
 	var app models.OAuth2Credential
 	if err := s.db.Where("client_id = ?", req.ClientID).First(&app).Error; err != nil {
 		return nil, errors.New("invalid client")
@@ -98,25 +135,36 @@ func (s *OAuth2Service) Authorize(req *AuthorizeRequest) (*AuthorizeResponse, er
 		return nil, errors.New("invalid redirect URI")
 	}
 
-	switch req.ResponseType {
-	case "code":
-		return s.handleAuthorizationCodeFlow(req, &app)
-	case "token":
-		return s.handleImplicitFlow(req, &app)
-	default:
+	if req.ResponseType != models.ResponseTypeCode && req.ResponseType != models.ResponseTypeToken {
 		return nil, errors.New("unsupported response type")
 	}
-}
 
-func (s *OAuth2Service) handleAuthorizationCodeFlow(req *AuthorizeRequest, app *models.OAuth2Credential) (*AuthorizeResponse, error) {
-	if !s.config.OAuth2.EnableAuthorizationCode {
-		return nil, errors.New("authorization code flow is disabled")
+	policy := s.clientPolicy(&app)
+	if !policy.AllowsResponseType(req.ResponseType) {
+		return nil, errors.New("response type not allowed for this client")
 	}
 
-	if s.config.OAuth2.PKCERequired && req.CodeChallenge == "" {
+	if req.ResponseType == models.ResponseTypeCode {
+		return s.handleAuthorizationCodeFlow(req, &app, policy)
+	}
+	return s.handleImplicitFlow(req, &app, policy)
+}
+
+func (s *OAuth2Service) handleAuthorizationCodeFlow(req *AuthorizeRequest, app *models.OAuth2Credential, policy *ClientPolicy) (*AuthorizeResponse, error) {
+	if policy.RequirePKCE && req.CodeChallenge == "" {
 		return nil, errors.New("PKCE is required")
 	}
 
+	if req.CodeChallenge != "" {
+		switch req.CodeChallengeMethod {
+		case "":
+			req.CodeChallengeMethod = "plain"
+		case "plain", "S256":
+		default:
+			return nil, errors.New("unsupported code challenge method")
+		}
+	}
+
 	authCode := &models.AuthorizationCode{
 		ClientID:            req.ClientID,
 		UserID:              s.parseUserID(req.AuthenticatedUserID),
@@ -124,7 +172,7 @@ func (s *OAuth2Service) handleAuthorizationCodeFlow(req *AuthorizeRequest, app *
 		Scopes:              strings.Fields(req.Scope),
 		CodeChallenge:       req.CodeChallenge,
 		CodeChallengeMethod: req.CodeChallengeMethod,
-		ExpiresAt:           utils.GetCurrentTS().Add(time.Duration(s.config.OAuth2.AuthCodeExpiration) * time.Second),
+		ExpiresAt:           utils.GetCurrentTS().Add(policy.AuthCodeTTL),
 	}
 
 	if err := s.db.Create(authCode).Error; err != nil {
@@ -144,16 +192,12 @@ func (s *OAuth2Service) handleAuthorizationCodeFlow(req *AuthorizeRequest, app *
 	}, nil
 }
 
-func (s *OAuth2Service) handleImplicitFlow(req *AuthorizeRequest, app *models.OAuth2Credential) (*AuthorizeResponse, error) {
-	if !s.config.OAuth2.EnableImplicitGrant {
-		return nil, errors.New("implicit grant flow is disabled")
-	}
-
+func (s *OAuth2Service) handleImplicitFlow(req *AuthorizeRequest, app *models.OAuth2Credential, policy *ClientPolicy) (*AuthorizeResponse, error) {
 	// creamos el token directo
 	token := &models.OAuth2Token{
-		AccessTokenExpiration: utils.GetCurrentTS().Add(time.Duration(s.config.OAuth2.AccessTokenExpiration) * time.Second),
+		AccessTokenExpiration: utils.GetCurrentTS().Add(policy.AccessTokenTTL),
 		RefreshToken:          uuid.New().String(),
-		RefreshTokenExpiration: utils.GetCurrentTS().Add(time.Duration(s.config.OAuth2.RefreshTokenExpiration) * time.Second),
+		RefreshTokenExpiration: utils.GetCurrentTS().Add(policy.RefreshTokenTTL),
 		Scope:               req.Scope,
 		AuthenticatedUserID: req.AuthenticatedUserID,
 		CredentialID:        app.ID,
@@ -165,7 +209,7 @@ func (s *OAuth2Service) handleImplicitFlow(req *AuthorizeRequest, app *models.OA
 
 	redirectURL, _ := url.Parse(req.RedirectURI)
 	fragment := fmt.Sprintf("access_token=%s&token_type=bearer&expires_in=%d",
-		token.AccessToken, token.AccessTokenExpiration)
+		token.AccessToken, int(policy.AccessTokenTTL.Seconds()))
 	if req.Scope != "" {
 		fragment += "&scope=" + url.QueryEscape(req.Scope)
 	}
@@ -197,7 +241,8 @@ func (s *OAuth2Service) Token(req *TokenRequest) (*TokenResponse, error) {
 
 func (s *OAuth2Service) handleAuthorizationCodeGrant(req *TokenRequest) (*TokenResponse, error) {
 	var app models.OAuth2Credential
-	if err := s.validateClient(req.ClientID, req.ClientSecret, &app); err != nil {
+	policy, err := s.authorizeClient(req, &app)
+	if err != nil {
 		return nil, err
 	}
 
@@ -214,28 +259,46 @@ func (s *OAuth2Service) handleAuthorizationCodeGrant(req *TokenRequest) (*TokenR
 		return nil, errors.New("redirect URI mismatch")
 	}
 
-	if authCode.CodeChallenge != "" {
-		// PKCE validation would go here
-		// For now, we'll skip the implementation details
+	// The policy may have changed since the code was issued
+	if policy.RequirePKCE && authCode.CodeChallenge == "" {
+		return nil, errors.New("PKCE is required")
+	}
+	if authCode.CodeChallenge != "" && !verifyCodeChallenge(authCode.CodeChallenge, authCode.CodeChallengeMethod, req.CodeVerifier) {
+		return nil, errors.New("invalid grant: code verifier mismatch")
 	}
 
 	// Mark code as used
 	authCode.IsUsed = true
 	s.db.Save(&authCode)
 
-	return s.createTokenResponse(&app, authCode.UserID, strings.Join(authCode.Scopes, " "))
+	return s.createTokenResponse(&app, policy, authCode.UserID, strings.Join(authCode.Scopes, " "))
 }
 
 func (s *OAuth2Service) handleClientCredentialsGrant(req *TokenRequest) (*TokenResponse, error) {
-	if !s.config.OAuth2.EnableClientCredentials {
-		return nil, errors.New("client credentials flow is disabled")
+	var app models.OAuth2Credential
+	policy, err := s.authorizeClient(req, &app)
+	if err != nil {
+		return nil, err
 	}
+	return s.createTokenResponse(&app, policy, uuid.Nil, req.Scope)
+}
 
-	var app models.OAuth2Credential
-	if err := s.validateClient(req.ClientID, req.ClientSecret, &app); err != nil {
+// authorizeClient authenticates the client of a token request and checks
+// that its policy allows the requested grant type.
+func (s *OAuth2Service) authorizeClient(req *TokenRequest, app *models.OAuth2Credential) (*ClientPolicy, error) {
+	if err := s.validateClient(req.ClientID, req.ClientSecret, app); err != nil {
 		return nil, err
 	}
-	return s.createTokenResponse(&app, uuid.Nil, req.Scope)
+
+	policy := s.clientPolicy(app)
+	if !policy.AllowsGrant(req.GrantType) {
+		return nil, errors.New("grant type not allowed for this client")
+	}
+	return policy, nil
+}
+
+func (s *OAuth2Service) clientPolicy(app *models.OAuth2Credential) *ClientPolicy {
+	return resolveClientPolicy(app, s.config.OAuth2)
 }
 
 func (s *OAuth2Service) validateClient(clientID, clientSecret string, app *models.OAuth2Credential) error {
@@ -243,17 +306,45 @@ func (s *OAuth2Service) validateClient(clientID, clientSecret string, app *model
 		return errors.New("invalid client")
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(app.ClientSecret), []byte(clientSecret)); err != nil {
-		return errors.New("invalid credentials")
+	// Public clients have no secret, PKCE stands in for it
+	if app.Public {
+		return nil
 	}
 
-	return nil
+	now := utils.GetCurrentTS()
+	var secrets []models.ClientSecret
+	if err := s.db.Where("credential_id = ? AND (expires_at IS NULL OR expires_at > ?)", app.ID, now).
+		Find(&secrets).Error; err != nil {
+		return errors.New("invalid client")
+	}
+
+	// During a rotation both the old and the new secret are accepted
+	for i := range secrets {
+		secret := &secrets[i]
+		if !hashing.Verify(clientSecret, secret.SecretHash) {
+			continue
+		}
+
+		updates := map[string]interface{}{"last_used_at": now}
+		if hashing.NeedsRehash(secret.SecretHash) {
+			if hashed, err := hashing.Hash(clientSecret); err == nil {
+				updates["secret_hash"] = hashed
+			}
+		}
+		if err := s.db.Model(secret).Updates(updates).Error; err != nil {
+			log.Println("Failed to record client secret use:", err)
+		}
+
+		return nil
+	}
+
+	return errors.New("invalid credentials")
 }
 
-func (s *OAuth2Service) createTokenResponse(app *models.OAuth2Credential, userID uuid.UUID, scope string) (*TokenResponse, error) {
+func (s *OAuth2Service) createTokenResponse(app *models.OAuth2Credential, policy *ClientPolicy, userID uuid.UUID, scope string) (*TokenResponse, error) {
 	accessToken := &models.OAuth2Token{
-		AccessTokenExpiration:    utils.GetCurrentTS().Add(time.Duration(s.config.OAuth2.AccessTokenExpiration) * time.Second),
-		RefreshTokenExpiration:   utils.GetCurrentTS().Add(time.Duration(s.config.OAuth2.RefreshTokenExpiration) * time.Second),
+		AccessTokenExpiration:    utils.GetCurrentTS().Add(policy.AccessTokenTTL),
+		RefreshTokenExpiration:   utils.GetCurrentTS().Add(policy.RefreshTokenTTL),
 		Scope:        scope,
 		CredentialID: app.ID,
 		AuthenticatedUserID: userID.String(),
@@ -274,37 +365,38 @@ func (s *OAuth2Service) createTokenResponse(app *models.OAuth2Credential, userID
 
 	response.AccessToken = accessToken.AccessToken
 
+	// The refresh token column is unique so one is always stored, but the
+	// client never sees it and cannot redeem it
+	if policy.RefreshTokenPolicy == models.RefreshTokenNone {
+		response.RefreshToken = ""
+		response.RefreshTokenExpiration = time.Time{}
+	}
+
 	return response, nil
 }
 
 func (s *OAuth2Service) handlePasswordGrant(req *TokenRequest) (*TokenResponse, error) {
-	if !s.config.OAuth2.EnablePasswordCredentials {
-		return nil, errors.New("password grant flow is disabled")
+	// The client goes first so a client without the grant cannot be used
+	// to guess passwords
+	var app models.OAuth2Credential
+	policy, err := s.authorizeClient(req, &app)
+	if err != nil {
+		return nil, err
 	}
 
 	if req.Email == "" || req.Password == "" {
 		return nil, errors.New("missing username or password")
 	}
 
-	var user models.User
-	if err := s.db.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		return nil, errors.New("invalid credentials")
-	}
-
-	if !user.IsActive {
-		return nil, errors.New("user is inactive")
-	}
-
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+	user, err := s.authenticator.Authenticate(context.Background(), req.Email, req.Password)
+	if err != nil {
+		if err.Error() == "user is inactive" {
+			return nil, err
+		}
 		return nil, errors.New("invalid credentials")
 	}
 
-	var app models.OAuth2Credential
-	if err := s.validateClient(req.ClientID, req.ClientSecret, &app); err != nil {
-		return nil, err
-	}
-
-	return s.createTokenResponse(&app, user.ID, req.Scope)
+	return s.createTokenResponse(&app, policy, user.ID, req.Scope)
 }
 
 // Helper functions
@@ -322,7 +414,8 @@ func (s *OAuth2Service) parseUserID(userIDStr string) uuid.UUID {
 
 func (s *OAuth2Service) handleRefreshTokenGrant(req *TokenRequest) (*TokenResponse, error) {
     var app models.OAuth2Credential
-    if err := s.validateClient(req.ClientID, req.ClientSecret, &app); err != nil {
+    policy, err := s.authorizeClient(req, &app)
+    if err != nil {
         return nil, err
 	}
     
@@ -335,13 +428,50 @@ func (s *OAuth2Service) handleRefreshTokenGrant(req *TokenRequest) (*TokenRespon
 		return nil, errors.New("refresh token expired")
 	}
 
-    if err:= s.db.Delete(&oldToken).Error; err != nil {
-		return nil, fmt.Errorf("failed to delete old token: %w", err)
-	}
-
     userID, err := uuid.Parse(oldToken.AuthenticatedUserID)
     if err != nil {
         return nil, errors.New("invalid user id in token")
     }
-    return s.createTokenResponse(&app, userID, oldToken.Scope)
+
+	if policy.RefreshTokenPolicy == models.RefreshTokenReuse {
+		return s.renewAccessToken(&oldToken, policy)
+	}
+
+    if err:= s.db.Delete(&oldToken).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete old token: %w", err)
+	}
+    return s.createTokenResponse(&app, policy, userID, oldToken.Scope)
+}
+
+// renewAccessToken issues a new access token on the same row, keeping the
+// refresh token and its expiration.
+func (s *OAuth2Service) renewAccessToken(token *models.OAuth2Token, policy *ClientPolicy) (*TokenResponse, error) {
+	token.AccessToken = uuid.New().String() + uuid.New().String()
+	token.AccessTokenExpiration = utils.GetCurrentTS().Add(policy.AccessTokenTTL)
+	if err := s.db.Model(token).Select("access_token", "access_token_expiration").Updates(token).Error; err != nil {
+		return nil, fmt.Errorf("failed to renew access token: %w", err)
+	}
+
+	return &TokenResponse{
+		AccessToken:            token.AccessToken,
+		AccessTokenExpiration:  token.AccessTokenExpiration,
+		RefreshToken:           token.RefreshToken,
+		RefreshTokenExpiration: token.RefreshTokenExpiration,
+		Scope:                  token.Scope,
+	}, nil
+}
+
+// verifyCodeChallenge checks a PKCE code verifier against the challenge sent
+// with the authorization request (RFC 7636).
+func verifyCodeChallenge(challenge, method, verifier string) bool {
+	if verifier == "" {
+		return false
+	}
+
+	expected := verifier
+	if method == "S256" {
+		sum := sha256.Sum256([]byte(verifier))
+		expected = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
 }
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"auth-service/internal/config"
+)
+
+// Codes of the password policy violations. The frontend translates them, so
+// they must stay stable.
+const (
+	PasswordTooShort         = "too_short"
+	PasswordMissingUpper     = "missing_uppercase"
+	PasswordMissingLower     = "missing_lowercase"
+	PasswordMissingDigit     = "missing_digit"
+	PasswordMissingSymbol    = "missing_symbol"
+	PasswordContainsUsername = "contains_username"
+	PasswordContainsEmail    = "contains_email"
+	PasswordBreached         = "breached"
+)
+
+// Parts of the username or email shorter than this are too common to reject
+const minIdentifierMatch = 3
+
+type PasswordViolation struct {
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Params  map[string]interface{} `json:"params,omitempty"`
+}
+
+// PasswordPolicyError lists every rule a password breaks, so the user can fix
+// them all at once.
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password does not meet the policy"
+}
+
+type PasswordPolicy struct {
+	config   config.PasswordPolicyConfig
+	breached *BreachedPasswordFilter
+}
+
+// NewPasswordPolicy creates the policy. breached may be nil, in which case
+// passwords are not checked against a breach corpus.
+func NewPasswordPolicy(cfg config.PasswordPolicyConfig, breached *BreachedPasswordFilter) *PasswordPolicy {
+	return &PasswordPolicy{
+		config:   cfg,
+		breached: breached,
+	}
+}
+
+// Validate returns a *PasswordPolicyError when the password breaks any rule.
+// username and email belong to the account the password is for.
+func (p *PasswordPolicy) Validate(password, username, email string) error {
+	var violations []PasswordViolation
+
+	if length := utf8.RuneCountInString(password); length < p.config.MinLength {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooShort,
+			Message: fmt.Sprintf("password must be at least %d characters long", p.config.MinLength),
+			Params:  map[string]interface{}{"min_length": p.config.MinLength},
+		})
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+
+	if p.config.RequireUpper && !hasUpper {
+		violations = append(violations, PasswordViolation{Code: PasswordMissingUpper, Message: "password must contain an uppercase letter"})
+	}
+	if p.config.RequireLower && !hasLower {
+		violations = append(violations, PasswordViolation{Code: PasswordMissingLower, Message: "password must contain a lowercase letter"})
+	}
+	if p.config.RequireDigit && !hasDigit {
+		violations = append(violations, PasswordViolation{Code: PasswordMissingDigit, Message: "password must contain a digit"})
+	}
+	if p.config.RequireSymbol && !hasSymbol {
+		violations = append(violations, PasswordViolation{Code: PasswordMissingSymbol, Message: "password must contain a symbol"})
+	}
+
+	lowered := strings.ToLower(password)
+	if containsIdentifier(lowered, username) {
+		violations = append(violations, PasswordViolation{Code: PasswordContainsUsername, Message: "password must not contain the username"})
+	}
+	localPart, _, _ := strings.Cut(email, "@")
+	if containsIdentifier(lowered, localPart) {
+		violations = append(violations, PasswordViolation{Code: PasswordContainsEmail, Message: "password must not contain the email address"})
+	}
+
+	if p.breached != nil && p.breached.Contains(password) {
+		violations = append(violations, PasswordViolation{Code: PasswordBreached, Message: "password appears in a known data breach"})
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func containsIdentifier(password, identifier string) bool {
+	identifier = strings.ToLower(strings.TrimSpace(identifier))
+	return utf8.RuneCountInString(identifier) >= minIdentifierMatch && strings.Contains(password, identifier)
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"auth-service/internal/config"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	breached := NewBreachedPasswordFilter(10, 0.001)
+	breached.Add("Tr0ub4dor&3")
+
+	strict := config.PasswordPolicyConfig{MinLength: 10, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true}
+	cases := []struct {
+		name     string
+		config   config.PasswordPolicyConfig
+		breached *BreachedPasswordFilter
+		password string
+		want     []string
+	}{
+		{"valid", strict, breached, "Correct-Horse-9", nil},
+		{"too short", strict, nil, "Ab1!", []string{PasswordTooShort}},
+		// Length counts characters, not bytes
+		{"multibyte length", config.PasswordPolicyConfig{MinLength: 6}, nil, "ñandú€", nil},
+		{"missing every class", strict, nil, "          ", []string{PasswordMissingUpper, PasswordMissingLower, PasswordMissingDigit, PasswordMissingSymbol}},
+		{"missing upper", strict, nil, "correct-horse-9", []string{PasswordMissingUpper}},
+		{"missing lower", strict, nil, "CORRECT-HORSE-9", []string{PasswordMissingLower}},
+		{"missing digit", strict, nil, "Correct-Horse-X", []string{PasswordMissingDigit}},
+		{"missing symbol", strict, nil, "CorrectHorse99", []string{PasswordMissingSymbol}},
+		{"unicode classes", strict, nil, "Ñandú-2024-€", nil},
+		{"classes not required", config.PasswordPolicyConfig{MinLength: 8}, nil, "aaaaaaaa", nil},
+		{"contains username", strict, nil, "Ada-Lovelace-1", []string{PasswordContainsUsername}},
+		{"contains email", strict, nil, "Countess-Ada_Byron-1", []string{PasswordContainsEmail}},
+		{"breached", config.PasswordPolicyConfig{MinLength: 8}, breached, "Tr0ub4dor&3", []string{PasswordBreached}},
+		{"no breach corpus", config.PasswordPolicyConfig{MinLength: 8}, nil, "Tr0ub4dor&3", nil},
+	}
+
+	for _, tc := range cases {
+		err := NewPasswordPolicy(tc.config, tc.breached).Validate(tc.password, "lovelace", "ada_byron@example.com")
+
+		var got []string
+		var policyErr *PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			for _, violation := range policyErr.Violations {
+				got = append(got, violation.Code)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: violations = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPasswordPolicyIgnoresShortIdentifiers(t *testing.T) {
+	policy := NewPasswordPolicy(config.PasswordPolicyConfig{MinLength: 8}, nil)
+
+	// "jo" is too common a substring to reject passwords for
+	if err := policy.Validate("enjoying-the-view", "jo", "jo@example.com"); err != nil {
+		t.Errorf("err = %v", err)
+	}
+	// The check is case-insensitive and ignores surrounding spaces
+	err := policy.Validate("I-am-GRACE-hopper", " Grace ", "navy@example.com")
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) || len(policyErr.Violations) != 1 || policyErr.Violations[0].Code != PasswordContainsUsername {
+		t.Errorf("err = %v, want contains_username", err)
+	}
+}
+
+func TestPasswordTooShortCarriesMinLength(t *testing.T) {
+	err := NewPasswordPolicy(config.PasswordPolicyConfig{MinLength: 12}, nil).Validate("short", "", "")
+
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) || len(policyErr.Violations) != 1 {
+		t.Fatalf("err = %v", err)
+	}
+	if violation := policyErr.Violations[0]; violation.Params["min_length"] != 12 || violation.Message != "password must be at least 12 characters long" {
+		t.Errorf("violation = %+v", violation)
+	}
+}
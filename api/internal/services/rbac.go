@@ -0,0 +1,111 @@
+package services
+
+import (
+	"errors"
+
+	"auth-service/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type RBACService struct {
+	db *gorm.DB
+}
+
+func NewRBACService(db *gorm.DB) *RBACService {
+	return &RBACService{
+		db: db,
+	}
+}
+
+// GetUserWithRoles loads an active user together with its roles and their
+// permissions.
+func (s *RBACService) GetUserWithRoles(userID uuid.UUID) (*models.User, error) {
+	var user models.User
+	if err := s.db.Preload("Roles.Permissions").Where("id = ?", userID).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("user not found")
+		}
+		return nil, errors.New("failed to fetch user")
+	}
+
+	if !user.IsActive {
+		return nil, errors.New("user not found")
+	}
+
+	return &user, nil
+}
+
+func (s *RBACService) HasPermission(userID uuid.UUID, permission string) (bool, error) {
+	user, err := s.GetUserWithRoles(userID)
+	if err != nil {
+		if err.Error() == "user not found" {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return user.HasPermission(permission), nil
+}
+
+func (s *RBACService) ListRoles() ([]models.Role, error) {
+	var roles []models.Role
+	if err := s.db.Preload("Permissions").Order("name ASC").Find(&roles).Error; err != nil {
+		return nil, errors.New("failed to fetch roles")
+	}
+	return roles, nil
+}
+
+func (s *RBACService) AssignRole(userID uuid.UUID, roleName string) (*models.User, error) {
+	user, err := s.GetUserWithRoles(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := s.findRole(roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, existing := range user.Roles {
+		if existing.ID == role.ID {
+			return user, nil
+		}
+	}
+
+	if err := s.db.Model(user).Association("Roles").Append(role); err != nil {
+		return nil, errors.New("failed to assign role")
+	}
+
+	return s.GetUserWithRoles(userID)
+}
+
+func (s *RBACService) RemoveRole(userID uuid.UUID, roleName string) (*models.User, error) {
+	user, err := s.GetUserWithRoles(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := s.findRole(roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Model(user).Association("Roles").Delete(role); err != nil {
+		return nil, errors.New("failed to remove role")
+	}
+
+	return s.GetUserWithRoles(userID)
+}
+
+func (s *RBACService) findRole(name string) (*models.Role, error) {
+	var role models.Role
+	if err := s.db.Where("name = ?", name).First(&role).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("role not found")
+		}
+		return nil, errors.New("failed to fetch role")
+	}
+	return &role, nil
+}
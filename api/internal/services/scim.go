@@ -0,0 +1,891 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"auth-service/internal/config"
+	"auth-service/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	ScimSchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	ScimSchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ScimSchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	ScimSchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ScimSchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+	// Page size used when the client does not send count, and the largest
+	// one it may ask for
+	ScimDefaultCount = 100
+	ScimMaxCount     = 200
+)
+
+// ErrInvalidScimValue is returned when a SCIM resource or patch operation is
+// missing required attributes or carries values of the wrong type.
+var ErrInvalidScimValue = errors.New("invalid value")
+
+var scimUserAttributes = map[string]string{
+	"id":                "id",
+	"username":          "username",
+	"externalid":        "external_id",
+	"emails":            "email",
+	"emails.value":      "email",
+	"displayname":       "name",
+	"name.formatted":    "name",
+	"active":            "is_active",
+	"meta.created":      "created_at",
+	"meta.lastmodified": "updated_at",
+}
+
+var scimGroupAttributes = map[string]string{
+	"id":                "id",
+	"displayname":       "display_name",
+	"externalid":        "external_id",
+	"meta.created":      "created_at",
+	"meta.lastmodified": "updated_at",
+}
+
+// Matches the value filter of a patch path such as members[value eq "..."]
+var scimMemberPath = regexp.MustCompile(`(?i)^members\[\s*value\s+eq\s+"([^"]+)"\s*\]$`)
+
+type ScimMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+type ScimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type ScimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type ScimMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type ScimUser struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	UserName    string       `json:"userName"`
+	Name        *ScimName    `json:"name,omitempty"`
+	DisplayName string       `json:"displayName,omitempty"`
+	Emails      []ScimEmail  `json:"emails,omitempty"`
+	Active      *bool        `json:"active,omitempty"`
+	Password    string       `json:"password,omitempty"`
+	Groups      []ScimMember `json:"groups,omitempty"`
+	Meta        *ScimMeta    `json:"meta,omitempty"`
+}
+
+type ScimGroup struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []ScimMember `json:"members,omitempty"`
+	Meta        *ScimMeta    `json:"meta,omitempty"`
+}
+
+type ScimListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int64       `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+type ScimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+type ScimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []ScimPatchOperation `json:"Operations" binding:"required"`
+}
+
+// ScimService maps SCIM 2.0 users and groups (RFC 7643) onto the users and
+// groups tables so roster systems can provision accounts in bulk.
+type ScimService struct {
+	db             *gorm.DB
+	config         *config.Config
+	userService    *UserService
+	passwordPolicy *PasswordPolicy
+}
+
+func NewScimService(db *gorm.DB, cfg *config.Config, userService *UserService, passwordPolicy *PasswordPolicy) *ScimService {
+	return &ScimService{
+		db:             db,
+		config:         cfg,
+		userService:    userService,
+		passwordPolicy: passwordPolicy,
+	}
+}
+
+// ListUsers returns one page of the users matching the filter. startIndex is
+// 1-based as in SCIM.
+func (s *ScimService) ListUsers(filter string, startIndex, count int) (*ScimListResponse, error) {
+	query, err := s.filteredQuery(s.scimUsers(), filter, scimUserAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, errors.New("failed to fetch users")
+	}
+
+	var users []models.User
+	if count > 0 {
+		if err := query.Order("created_at").Offset(startIndex - 1).Limit(count).Find(&users).Error; err != nil {
+			return nil, errors.New("failed to fetch users")
+		}
+	}
+
+	resources := make([]*ScimUser, len(users))
+	for i := range users {
+		if resources[i], err = s.toScimUser(&users[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return newScimListResponse(total, startIndex, resources, len(resources)), nil
+}
+
+func (s *ScimService) GetUser(id string) (*ScimUser, error) {
+	user, err := s.findUser(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.toScimUser(user)
+}
+
+func (s *ScimService) CreateUser(resource *ScimUser) (*ScimUser, error) {
+	user := &models.User{IsActive: true}
+	if err := s.applyScimUser(user, resource); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkUserConflicts(user); err != nil {
+		return nil, err
+	}
+
+	// Accounts without a password log in through LDAP or an identity provider
+	password := resource.Password
+	if password != "" {
+		if err := s.passwordPolicy.Validate(password, user.Username, user.Email); err != nil {
+			return nil, err
+		}
+	} else {
+		generated, err := randomURLToken()
+		if err != nil {
+			return nil, errors.New("failed to create user")
+		}
+		password = generated
+	}
+	user.Password = password
+
+	active := user.IsActive
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		// is_active defaults to true, so gorm skips an explicit false on create
+		if !active {
+			if err := tx.Model(user).Update("is_active", false).Error; err != nil {
+				return err
+			}
+		}
+
+		var role models.Role
+		if err := tx.Where("name = ?", models.RoleUser).First(&role).Error; err == nil {
+			return tx.Model(user).Association("Roles").Append(&role)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.New("failed to create user")
+	}
+
+	log.Printf("Provisioned user %s through SCIM", user.ID)
+	return s.toScimUser(user)
+}
+
+// ReplaceUser overwrites the user with the given resource. Attributes left out
+// of the resource are cleared, as PUT requires.
+func (s *ScimService) ReplaceUser(id string, resource *ScimUser) (*ScimUser, error) {
+	user, err := s.findUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if resource.Active == nil {
+		active := true
+		resource.Active = &active
+	}
+
+	return s.saveUser(user, resource)
+}
+
+func (s *ScimService) PatchUser(id string, req *ScimPatchRequest) (*ScimUser, error) {
+	user, err := s.findUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	resource, err := s.toScimUser(user)
+	if err != nil {
+		return nil, err
+	}
+	resource.Groups = nil
+
+	for _, op := range req.Operations {
+		if err := patchScimUser(resource, op); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.saveUser(user, resource)
+}
+
+// DeleteUser deactivates the account the same way a user deleting their own
+// account does: access is revoked at once and data is purged after the grace
+// period. The user is no longer visible through SCIM afterwards.
+func (s *ScimService) DeleteUser(id string) error {
+	user, err := s.findUser(id)
+	if err != nil {
+		return err
+	}
+
+	return s.userService.scheduleDeletion(user)
+}
+
+func (s *ScimService) ListGroups(filter string, startIndex, count int) (*ScimListResponse, error) {
+	query, err := s.filteredQuery(s.db.Model(&models.Group{}), filter, scimGroupAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, errors.New("failed to fetch groups")
+	}
+
+	var groups []models.Group
+	if count > 0 {
+		if err := query.Preload("Members").Order("created_at").Offset(startIndex - 1).Limit(count).Find(&groups).Error; err != nil {
+			return nil, errors.New("failed to fetch groups")
+		}
+	}
+
+	resources := make([]*ScimGroup, len(groups))
+	for i := range groups {
+		resources[i] = s.toScimGroup(&groups[i])
+	}
+
+	return newScimListResponse(total, startIndex, resources, len(resources)), nil
+}
+
+func (s *ScimService) GetGroup(id string) (*ScimGroup, error) {
+	group, err := s.findGroup(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.toScimGroup(group), nil
+}
+
+func (s *ScimService) CreateGroup(resource *ScimGroup) (*ScimGroup, error) {
+	group := &models.Group{}
+	return s.saveGroup(group, resource, true)
+}
+
+func (s *ScimService) ReplaceGroup(id string, resource *ScimGroup) (*ScimGroup, error) {
+	group, err := s.findGroup(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.saveGroup(group, resource, false)
+}
+
+func (s *ScimService) PatchGroup(id string, req *ScimPatchRequest) (*ScimGroup, error) {
+	group, err := s.findGroup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	resource := s.toScimGroup(group)
+	for _, op := range req.Operations {
+		if err := patchScimGroup(resource, op); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.saveGroup(group, resource, false)
+}
+
+func (s *ScimService) DeleteGroup(id string) error {
+	group, err := s.findGroup(id)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(group).Association("Members").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(group).Error
+	})
+	if err != nil {
+		return errors.New("failed to delete group")
+	}
+
+	return nil
+}
+
+// scimUsers excludes accounts scheduled for deletion, which SCIM clients
+// already consider deleted.
+func (s *ScimService) scimUsers() *gorm.DB {
+	return s.db.Model(&models.User{}).Where("deletion_scheduled_at IS NULL")
+}
+
+func (s *ScimService) filteredQuery(query *gorm.DB, filter string, attributes map[string]string) (*gorm.DB, error) {
+	if strings.TrimSpace(filter) == "" {
+		return query, nil
+	}
+
+	condition, args, err := parseSCIMFilter(filter, attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	return query.Where(condition, args...), nil
+}
+
+func (s *ScimService) findUser(id string) (*models.User, error) {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	var user models.User
+	if err := s.scimUsers().Where("id = ?", userID).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("user not found")
+		}
+		return nil, errors.New("failed to fetch user")
+	}
+
+	return &user, nil
+}
+
+func (s *ScimService) findGroup(id string) (*models.Group, error) {
+	groupID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errors.New("group not found")
+	}
+
+	var group models.Group
+	if err := s.db.Preload("Members").Where("id = ?", groupID).First(&group).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("group not found")
+		}
+		return nil, errors.New("failed to fetch group")
+	}
+
+	return &group, nil
+}
+
+func (s *ScimService) saveUser(user *models.User, resource *ScimUser) (*ScimUser, error) {
+	wasActive := user.IsActive
+	if err := s.applyScimUser(user, resource); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkUserConflicts(user); err != nil {
+		return nil, err
+	}
+
+	if resource.Password != "" {
+		if err := s.passwordPolicy.Validate(resource.Password, user.Username, user.Email); err != nil {
+			return nil, err
+		}
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"email":       user.Email,
+			"name":        user.Name,
+			"username":    user.Username,
+			"external_id": user.ExternalID,
+			"is_active":   user.IsActive,
+		}
+		if resource.Password != "" {
+			if err := user.HashPassword(resource.Password); err != nil {
+				return err
+			}
+			updates["password"] = user.Password
+		}
+
+		if err := tx.Model(user).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		// A disabled student must lose access right away, not when their
+		// tokens expire
+		if wasActive && !user.IsActive {
+			return revokeUserAccess(tx, user.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.New("failed to update user")
+	}
+
+	return s.toScimUser(user)
+}
+
+// applyScimUser copies the attributes of a SCIM user onto the model.
+func (s *ScimService) applyScimUser(user *models.User, resource *ScimUser) error {
+	if strings.TrimSpace(resource.UserName) == "" {
+		return fmt.Errorf("%w: userName is required", ErrInvalidScimValue)
+	}
+
+	email := primaryEmail(resource.Emails)
+	if email == "" {
+		return fmt.Errorf("%w: an email is required", ErrInvalidScimValue)
+	}
+
+	name := resource.DisplayName
+	if resource.Name != nil {
+		switch {
+		case resource.Name.Formatted != "":
+			name = resource.Name.Formatted
+		case name == "":
+			name = strings.TrimSpace(resource.Name.GivenName + " " + resource.Name.FamilyName)
+		}
+	}
+	if name == "" {
+		name = resource.UserName
+	}
+
+	user.Username = strings.TrimSpace(resource.UserName)
+	if user.Email != strings.ToLower(email) {
+		// The new address is the client's word, not verified by the service
+		user.EmailVerifiedAt = nil
+	}
+	user.Email = strings.ToLower(email)
+	user.Name = name
+	user.ExternalID = resource.ExternalID
+	if resource.Active != nil {
+		user.IsActive = *resource.Active
+	}
+
+	return nil
+}
+
+func (s *ScimService) checkUserConflicts(user *models.User) error {
+	var count int64
+	if err := s.db.Model(&models.User{}).
+		Where("(LOWER(username) = LOWER(?) OR LOWER(email) = LOWER(?)) AND id <> ?", user.Username, user.Email, user.ID).
+		Count(&count).Error; err != nil {
+		return errors.New("failed to fetch user")
+	}
+	if count > 0 {
+		return errors.New("user already exists")
+	}
+	return nil
+}
+
+func (s *ScimService) saveGroup(group *models.Group, resource *ScimGroup, create bool) (*ScimGroup, error) {
+	displayName := strings.TrimSpace(resource.DisplayName)
+	if displayName == "" {
+		return nil, fmt.Errorf("%w: displayName is required", ErrInvalidScimValue)
+	}
+
+	var count int64
+	if err := s.db.Model(&models.Group{}).
+		Where("LOWER(display_name) = LOWER(?) AND id <> ?", displayName, group.ID).
+		Count(&count).Error; err != nil {
+		return nil, errors.New("failed to fetch group")
+	}
+	if count > 0 {
+		return nil, errors.New("group already exists")
+	}
+
+	members, err := s.resolveMembers(resource.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	group.DisplayName = displayName
+	group.ExternalID = resource.ExternalID
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if create {
+			if err := tx.Omit("Members").Create(group).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Model(group).Updates(map[string]interface{}{
+			"display_name": group.DisplayName,
+			"external_id":  group.ExternalID,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(group).Association("Members").Replace(members)
+	})
+	if err != nil {
+		return nil, errors.New("failed to save group")
+	}
+
+	group.Members = members
+	return s.toScimGroup(group), nil
+}
+
+func (s *ScimService) resolveMembers(members []ScimMember) ([]models.User, error) {
+	ids := make([]uuid.UUID, 0, len(members))
+	seen := map[uuid.UUID]bool{}
+	for _, member := range members {
+		id, err := uuid.Parse(member.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unknown member %s", ErrInvalidScimValue, member.Value)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	users := []models.User{}
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	if err := s.scimUsers().Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, errors.New("failed to fetch users")
+	}
+	if len(users) != len(ids) {
+		return nil, fmt.Errorf("%w: unknown member", ErrInvalidScimValue)
+	}
+
+	return users, nil
+}
+
+func (s *ScimService) toScimUser(user *models.User) (*ScimUser, error) {
+	var groups []models.Group
+	if err := s.db.Joins("JOIN group_members ON group_members.group_id = groups.id").
+		Where("group_members.user_id = ?", user.ID).
+		Order("display_name").Find(&groups).Error; err != nil {
+		return nil, errors.New("failed to fetch groups")
+	}
+
+	active := user.IsActive
+	resource := &ScimUser{
+		Schemas:     []string{ScimSchemaUser},
+		ID:          user.ID.String(),
+		ExternalID:  user.ExternalID,
+		UserName:    user.Username,
+		Name:        &ScimName{Formatted: user.Name},
+		DisplayName: user.Name,
+		Emails:      []ScimEmail{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta:        s.meta("User", "Users", user.ID, user.CreatedAt, user.UpdatedAt),
+	}
+
+	for _, group := range groups {
+		resource.Groups = append(resource.Groups, ScimMember{
+			Value:   group.ID.String(),
+			Display: group.DisplayName,
+			Ref:     s.location("Groups", group.ID),
+		})
+	}
+
+	return resource, nil
+}
+
+func (s *ScimService) toScimGroup(group *models.Group) *ScimGroup {
+	resource := &ScimGroup{
+		Schemas:     []string{ScimSchemaGroup},
+		ID:          group.ID.String(),
+		ExternalID:  group.ExternalID,
+		DisplayName: group.DisplayName,
+		Members:     []ScimMember{},
+		Meta:        s.meta("Group", "Groups", group.ID, group.CreatedAt, group.UpdatedAt),
+	}
+
+	for _, member := range group.Members {
+		resource.Members = append(resource.Members, ScimMember{
+			Value:   member.ID.String(),
+			Display: member.Username,
+			Ref:     s.location("Users", member.ID),
+		})
+	}
+
+	return resource
+}
+
+func (s *ScimService) meta(resourceType, endpoint string, id uuid.UUID, created, modified time.Time) *ScimMeta {
+	if modified.IsZero() {
+		modified = created
+	}
+	return &ScimMeta{
+		ResourceType: resourceType,
+		Created:      created,
+		LastModified: modified,
+		Location:     s.location(endpoint, id),
+	}
+}
+
+func (s *ScimService) location(endpoint string, id uuid.UUID) string {
+	return fmt.Sprintf("%s/scim/v2/%s/%s", strings.TrimRight(s.config.PublicURL, "/"), endpoint, id)
+}
+
+func newScimListResponse(total int64, startIndex int, resources interface{}, items int) *ScimListResponse {
+	return &ScimListResponse{
+		Schemas:      []string{ScimSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: items,
+		Resources:    resources,
+	}
+}
+
+func primaryEmail(emails []ScimEmail) string {
+	for _, email := range emails {
+		if email.Primary && email.Value != "" {
+			return email.Value
+		}
+	}
+	for _, email := range emails {
+		if email.Value != "" {
+			return email.Value
+		}
+	}
+	return ""
+}
+
+// patchScimUser applies one PATCH operation to a user resource. Only the
+// attributes stored in the users table can be patched.
+func patchScimUser(resource *ScimUser, op ScimPatchOperation) error {
+	operation := strings.ToLower(op.Op)
+	if operation != "add" && operation != "replace" && operation != "remove" {
+		return fmt.Errorf("%w: unsupported op %q", ErrInvalidScimValue, op.Op)
+	}
+
+	// Without a path the value is a partial resource
+	if op.Path == "" {
+		if operation == "remove" {
+			return fmt.Errorf("%w: remove requires a path", ErrInvalidScimValue)
+		}
+		var attributes map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &attributes); err != nil {
+			return fmt.Errorf("%w: value must be an object", ErrInvalidScimValue)
+		}
+		for path, value := range attributes {
+			if err := patchScimUser(resource, ScimPatchOperation{Op: op.Op, Path: path, Value: value}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	remove := operation == "remove"
+	switch path := strings.ToLower(op.Path); {
+	case path == "active":
+		if remove {
+			return fmt.Errorf("%w: active cannot be removed", ErrInvalidScimValue)
+		}
+		active, err := scimBool(op.Value)
+		if err != nil {
+			return err
+		}
+		resource.Active = &active
+	case path == "username":
+		if remove {
+			return fmt.Errorf("%w: userName cannot be removed", ErrInvalidScimValue)
+		}
+		return scimString(op.Value, &resource.UserName)
+	case path == "externalid":
+		resource.ExternalID = ""
+		if !remove {
+			return scimString(op.Value, &resource.ExternalID)
+		}
+	case path == "displayname" || path == "name.formatted":
+		resource.DisplayName = ""
+		resource.Name = nil
+		if !remove {
+			return scimString(op.Value, &resource.DisplayName)
+		}
+	case path == "name":
+		resource.Name = nil
+		resource.DisplayName = ""
+		if !remove {
+			resource.Name = &ScimName{}
+			if err := json.Unmarshal(op.Value, resource.Name); err != nil {
+				return fmt.Errorf("%w: name must be an object", ErrInvalidScimValue)
+			}
+		}
+	case path == "password":
+		if remove {
+			return fmt.Errorf("%w: password cannot be removed", ErrInvalidScimValue)
+		}
+		return scimString(op.Value, &resource.Password)
+	case strings.HasPrefix(path, "emails"):
+		if remove {
+			return fmt.Errorf("%w: the email cannot be removed", ErrInvalidScimValue)
+		}
+		// emails[type eq "work"].value and similar address the single email
+		if strings.HasSuffix(path, ".value") {
+			var email string
+			if err := scimString(op.Value, &email); err != nil {
+				return err
+			}
+			resource.Emails = []ScimEmail{{Value: email, Primary: true}}
+			return nil
+		}
+		var emails []ScimEmail
+		if err := json.Unmarshal(op.Value, &emails); err != nil {
+			return fmt.Errorf("%w: emails must be a list", ErrInvalidScimValue)
+		}
+		resource.Emails = emails
+	default:
+		return fmt.Errorf("%w: unsupported path %q", ErrInvalidScimValue, op.Path)
+	}
+
+	return nil
+}
+
+// patchScimGroup applies one PATCH operation to a group resource, including
+// the add and remove of single members roster systems use for enrollments.
+func patchScimGroup(resource *ScimGroup, op ScimPatchOperation) error {
+	operation := strings.ToLower(op.Op)
+	if operation != "add" && operation != "replace" && operation != "remove" {
+		return fmt.Errorf("%w: unsupported op %q", ErrInvalidScimValue, op.Op)
+	}
+
+	if op.Path == "" {
+		if operation == "remove" {
+			return fmt.Errorf("%w: remove requires a path", ErrInvalidScimValue)
+		}
+		var attributes map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &attributes); err != nil {
+			return fmt.Errorf("%w: value must be an object", ErrInvalidScimValue)
+		}
+		for path, value := range attributes {
+			if err := patchScimGroup(resource, ScimPatchOperation{Op: op.Op, Path: path, Value: value}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if match := scimMemberPath.FindStringSubmatch(op.Path); match != nil {
+		if operation != "remove" {
+			return fmt.Errorf("%w: only remove is supported on a single member", ErrInvalidScimValue)
+		}
+		resource.Members = withoutMembers(resource.Members, []ScimMember{{Value: match[1]}})
+		return nil
+	}
+
+	switch strings.ToLower(op.Path) {
+	case "displayname":
+		if operation == "remove" {
+			return fmt.Errorf("%w: displayName cannot be removed", ErrInvalidScimValue)
+		}
+		return scimString(op.Value, &resource.DisplayName)
+	case "externalid":
+		resource.ExternalID = ""
+		if operation != "remove" {
+			return scimString(op.Value, &resource.ExternalID)
+		}
+	case "members":
+		var members []ScimMember
+		if len(op.Value) > 0 {
+			if err := json.Unmarshal(op.Value, &members); err != nil {
+				return fmt.Errorf("%w: members must be a list", ErrInvalidScimValue)
+			}
+		}
+
+		switch operation {
+		case "add":
+			resource.Members = append(withoutMembers(resource.Members, members), members...)
+		case "replace":
+			resource.Members = members
+		case "remove":
+			// Without a value every member is removed
+			if len(members) == 0 {
+				resource.Members = nil
+			} else {
+				resource.Members = withoutMembers(resource.Members, members)
+			}
+		}
+	default:
+		return fmt.Errorf("%w: unsupported path %q", ErrInvalidScimValue, op.Path)
+	}
+
+	return nil
+}
+
+func withoutMembers(members, removed []ScimMember) []ScimMember {
+	drop := map[string]bool{}
+	for _, member := range removed {
+		drop[strings.ToLower(member.Value)] = true
+	}
+
+	kept := []ScimMember{}
+	for _, member := range members {
+		if !drop[strings.ToLower(member.Value)] {
+			kept = append(kept, member)
+		}
+	}
+	return kept
+}
+
+func scimString(raw json.RawMessage, target *string) error {
+	if err := json.Unmarshal(raw, target); err != nil {
+		return fmt.Errorf("%w: expected a string", ErrInvalidScimValue)
+	}
+	return nil
+}
+
+// scimBool accepts "True"/"False" strings too, which some clients (notably
+// Azure AD) send for active.
+func scimBool(raw json.RawMessage) (bool, error) {
+	var value bool
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return value, nil
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		switch strings.ToLower(text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+
+	return false, fmt.Errorf("%w: expected a boolean", ErrInvalidScimValue)
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidFilter is returned for SCIM filters that cannot be parsed or use
+// attributes or operators that are not supported.
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// scimFilter turns a SCIM filter expression (RFC 7644 section 3.4.2.2) into a
+// SQL condition. attributes maps lower-cased SCIM attribute paths to columns;
+// anything else is rejected.
+type scimFilter struct {
+	tokens     []string
+	pos        int
+	attributes map[string]string
+}
+
+func parseSCIMFilter(filter string, attributes map[string]string) (string, []interface{}, error) {
+	tokens, err := tokenizeSCIMFilter(filter)
+	if err != nil {
+		return "", nil, err
+	}
+
+	p := &scimFilter{tokens: tokens, attributes: attributes}
+	sql, args, err := p.parseOr()
+	if err != nil {
+		return "", nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return "", nil, fmt.Errorf("%w: unexpected %q", ErrInvalidFilter, p.tokens[p.pos])
+	}
+
+	return sql, args, nil
+}
+
+func (p *scimFilter) parseOr() (string, []interface{}, error) {
+	sql, args, err := p.parseAnd()
+	if err != nil {
+		return "", nil, err
+	}
+
+	for p.peekKeyword("or") {
+		p.pos++
+		right, rightArgs, err := p.parseAnd()
+		if err != nil {
+			return "", nil, err
+		}
+		sql = "(" + sql + " OR " + right + ")"
+		args = append(args, rightArgs...)
+	}
+
+	return sql, args, nil
+}
+
+func (p *scimFilter) parseAnd() (string, []interface{}, error) {
+	sql, args, err := p.parseAtom()
+	if err != nil {
+		return "", nil, err
+	}
+
+	for p.peekKeyword("and") {
+		p.pos++
+		right, rightArgs, err := p.parseAtom()
+		if err != nil {
+			return "", nil, err
+		}
+		sql = "(" + sql + " AND " + right + ")"
+		args = append(args, rightArgs...)
+	}
+
+	return sql, args, nil
+}
+
+func (p *scimFilter) parseAtom() (string, []interface{}, error) {
+	token, ok := p.next()
+	if !ok {
+		return "", nil, fmt.Errorf("%w: unexpected end of filter", ErrInvalidFilter)
+	}
+
+	if strings.EqualFold(token, "not") {
+		if next, _ := p.next(); next != "(" {
+			return "", nil, fmt.Errorf("%w: expected ( after not", ErrInvalidFilter)
+		}
+		sql, args, err := p.parseGroup()
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT " + sql, args, nil
+	}
+
+	if token == "(" {
+		return p.parseGroup()
+	}
+
+	column, ok := p.attributes[strings.ToLower(token)]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: unsupported attribute %q", ErrInvalidFilter, token)
+	}
+
+	operator, ok := p.next()
+	if !ok {
+		return "", nil, fmt.Errorf("%w: missing operator", ErrInvalidFilter)
+	}
+	operator = strings.ToLower(operator)
+
+	if operator == "pr" {
+		return fmt.Sprintf("(%s IS NOT NULL AND CAST(%s AS TEXT) <> '')", column, column), nil, nil
+	}
+
+	raw, ok := p.next()
+	if !ok {
+		return "", nil, fmt.Errorf("%w: missing value", ErrInvalidFilter)
+	}
+	value, err := parseSCIMValue(raw)
+	if err != nil {
+		return "", nil, err
+	}
+
+	text, isText := value.(string)
+	switch operator {
+	case "eq", "ne":
+		sqlOp := "="
+		if operator == "ne" {
+			sqlOp = "<>"
+		}
+		if value == nil {
+			if operator == "eq" {
+				return column + " IS NULL", nil, nil
+			}
+			return column + " IS NOT NULL", nil, nil
+		}
+		if isText {
+			return fmt.Sprintf("LOWER(CAST(%s AS TEXT)) %s LOWER(?)", column, sqlOp), []interface{}{text}, nil
+		}
+		return fmt.Sprintf("%s %s ?", column, sqlOp), []interface{}{value}, nil
+	case "co", "sw", "ew":
+		if !isText {
+			return "", nil, fmt.Errorf("%w: %s needs a string", ErrInvalidFilter, operator)
+		}
+		pattern := escapeLike(text)
+		switch operator {
+		case "co":
+			pattern = "%" + pattern + "%"
+		case "sw":
+			pattern = pattern + "%"
+		case "ew":
+			pattern = "%" + pattern
+		}
+		return fmt.Sprintf("CAST(%s AS TEXT) ILIKE ?", column), []interface{}{pattern}, nil
+	case "gt", "ge", "lt", "le":
+		sqlOp := map[string]string{"gt": ">", "ge": ">=", "lt": "<", "le": "<="}[operator]
+		return fmt.Sprintf("%s %s ?", column, sqlOp), []interface{}{value}, nil
+	default:
+		return "", nil, fmt.Errorf("%w: unsupported operator %q", ErrInvalidFilter, operator)
+	}
+}
+
+func (p *scimFilter) parseGroup() (string, []interface{}, error) {
+	sql, args, err := p.parseOr()
+	if err != nil {
+		return "", nil, err
+	}
+	if closing, _ := p.next(); closing != ")" {
+		return "", nil, fmt.Errorf("%w: missing )", ErrInvalidFilter)
+	}
+	return "(" + sql + ")", args, nil
+}
+
+func (p *scimFilter) next() (string, bool) {
+	if p.pos >= len(p.tokens) {
+		return "", false
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	return token, true
+}
+
+func (p *scimFilter) peekKeyword(keyword string) bool {
+	return p.pos < len(p.tokens) && strings.EqualFold(p.tokens[p.pos], keyword)
+}
+
+func tokenizeSCIMFilter(filter string) ([]string, error) {
+	var tokens []string
+	runes := []rune(filter)
+	for i := 0; i < len(runes); {
+		switch r := runes[i]; {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, string(r))
+			i++
+		case r == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != '"' {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("%w: unterminated string", ErrInvalidFilter)
+			}
+			tokens = append(tokens, string(runes[i:j+1]))
+			i = j + 1
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && runes[j] != '(' && runes[j] != ')' {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+func parseSCIMValue(raw string) (interface{}, error) {
+	switch strings.ToLower(raw) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	if strings.HasPrefix(raw, `"`) {
+		value, err := strconv.Unquote(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad string %s", ErrInvalidFilter, raw)
+		}
+		return value, nil
+	}
+
+	if number, err := strconv.ParseFloat(raw, 64); err == nil {
+		return number, nil
+	}
+
+	return nil, fmt.Errorf("%w: bad value %s", ErrInvalidFilter, raw)
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseSCIMFilter(t *testing.T) {
+	cases := []struct {
+		filter string
+		sql    string
+		args   []interface{}
+	}{
+		// Attributes are matched case-insensitively and mapped to columns
+		{`userName eq "ada"`, "LOWER(CAST(username AS TEXT)) = LOWER(?)", []interface{}{"ada"}},
+		{`USERNAME EQ "ada"`, "LOWER(CAST(username AS TEXT)) = LOWER(?)", []interface{}{"ada"}},
+		{`emails.value ne "ada@example.com"`, "LOWER(CAST(email AS TEXT)) <> LOWER(?)", []interface{}{"ada@example.com"}},
+		{`active eq true`, "is_active = ?", []interface{}{true}},
+		{`externalId eq null`, "external_id IS NULL", nil},
+		{`externalId ne null`, "external_id IS NOT NULL", nil},
+		{`externalId pr`, "(external_id IS NOT NULL AND CAST(external_id AS TEXT) <> '')", nil},
+		{`displayName co "Love"`, "CAST(name AS TEXT) ILIKE ?", []interface{}{"%Love%"}},
+		{`displayName sw "Ada"`, "CAST(name AS TEXT) ILIKE ?", []interface{}{"Ada%"}},
+		{`displayName ew "lace"`, "CAST(name AS TEXT) ILIKE ?", []interface{}{"%lace"}},
+		{`meta.created gt "2024-01-01T00:00:00Z"`, "created_at > ?", []interface{}{"2024-01-01T00:00:00Z"}},
+		{`meta.lastModified le "2024-01-01T00:00:00Z"`, "updated_at <= ?", []interface{}{"2024-01-01T00:00:00Z"}},
+
+		// Values stay out of the SQL, LIKE wildcards in them are escaped
+		{`userName eq "x' OR '1'='1"`, "LOWER(CAST(username AS TEXT)) = LOWER(?)", []interface{}{"x' OR '1'='1"}},
+		{`userName eq "say \"hi\""`, "LOWER(CAST(username AS TEXT)) = LOWER(?)", []interface{}{`say "hi"`}},
+		{`displayName co "100%_\\"`, "CAST(name AS TEXT) ILIKE ?", []interface{}{`%100\%\_\\%`}},
+
+		// and binds tighter than or, parentheses and not override it
+		{`userName eq "a" or userName eq "b" and active eq true`,
+			"(LOWER(CAST(username AS TEXT)) = LOWER(?) OR (LOWER(CAST(username AS TEXT)) = LOWER(?) AND is_active = ?))",
+			[]interface{}{"a", "b", true}},
+		{`(userName eq "a" or userName eq "b") and active eq true`,
+			"(((LOWER(CAST(username AS TEXT)) = LOWER(?) OR LOWER(CAST(username AS TEXT)) = LOWER(?))) AND is_active = ?)",
+			[]interface{}{"a", "b", true}},
+		{`not (active eq false) AND userName sw "a"`,
+			"(NOT (is_active = ?) AND CAST(username AS TEXT) ILIKE ?)",
+			[]interface{}{false, "a%"}},
+	}
+
+	for _, tc := range cases {
+		sql, args, err := parseSCIMFilter(tc.filter, scimUserAttributes)
+		if err != nil {
+			t.Errorf("%s: %v", tc.filter, err)
+			continue
+		}
+		if sql != tc.sql {
+			t.Errorf("%s:\n got  %s\n want %s", tc.filter, sql, tc.sql)
+		}
+		if !reflect.DeepEqual(args, tc.args) {
+			t.Errorf("%s: args = %#v, want %#v", tc.filter, args, tc.args)
+		}
+	}
+}
+
+func TestParseSCIMFilterRejects(t *testing.T) {
+	cases := []struct {
+		name   string
+		filter string
+	}{
+		{"unknown attribute", `password eq "secret"`},
+		{"column name", `is_active eq true`},
+		{"group attribute on users", `members eq "x"`},
+		{"unknown operator", `userName like "a"`},
+		{"SQL operator", `userName = "a"`},
+		{"substring of a number", `active co 1`},
+		{"bare word value", `userName eq ada`},
+		{"unterminated string", `userName eq "ada`},
+		{"bad escape", `userName eq "\q"`},
+		{"missing operator", `userName`},
+		{"missing value", `userName eq`},
+		{"missing )", `(userName eq "a"`},
+		{"extra )", `userName eq "a")`},
+		{"not without group", `not active eq true`},
+		{"dangling and", `userName eq "a" and`},
+		{"two expressions", `userName eq "a" userName eq "b"`},
+		{"empty", ``},
+	}
+
+	for _, tc := range cases {
+		if sql, _, err := parseSCIMFilter(tc.filter, scimUserAttributes); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("%s: sql = %q, err = %v, want invalid filter", tc.name, sql, err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"auth-service/internal/config"
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+type SessionService struct {
+	db            *gorm.DB
+	config        *config.Config
+	authenticator Authenticator
+}
+
+func NewSessionService(db *gorm.DB, cfg *config.Config, authenticator Authenticator) *SessionService {
+	return &SessionService{
+		db:            db,
+		config:        cfg,
+		authenticator: authenticator,
+	}
+}
+
+// Authenticate checks an email and password with the configured authenticator
+func (s *SessionService) Authenticate(ctx context.Context, email, password string) (*models.User, error) {
+	user, err := s.authenticator.Authenticate(ctx, email, password)
+	if err != nil {
+		if err.Error() == "user is inactive" {
+			return nil, err
+		}
+		return nil, errors.New("invalid credentials")
+	}
+
+	return user, nil
+}
+
+// CreateSession starts a session for the user and returns the raw value to be
+// stored in the cookie.
+func (s *SessionService) CreateSession(user *models.User, userAgent, ipAddress string) (string, *models.Session, error) {
+	raw, err := randomURLToken()
+	if err != nil {
+		return "", nil, errors.New("failed to generate session")
+	}
+
+	now := utils.GetCurrentTS()
+	session := &models.Session{
+		UserID:     user.ID,
+		TokenHash:  hashSessionToken(raw),
+		UserAgent:  userAgent,
+		IPAddress:  ipAddress,
+		AuthTime:   now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.AbsoluteTimeout()),
+	}
+
+	if err := s.db.Create(session).Error; err != nil {
+		return "", nil, errors.New("failed to create session")
+	}
+
+	// Opportunistic cleanup, nothing else removes dead sessions
+	s.db.Where("user_id = ? AND expires_at < ?", user.ID, now).Delete(&models.Session{})
+
+	return raw, session, nil
+}
+
+// ResolveSession returns the active session behind a cookie value and slides
+// its idle timeout forward.
+func (s *SessionService) ResolveSession(raw string) (*models.Session, error) {
+	if raw == "" {
+		return nil, errors.New("session not found")
+	}
+
+	var session models.Session
+	if err := s.db.Preload("User").Where("token_hash = ?", hashSessionToken(raw)).First(&session).Error; err != nil {
+		return nil, errors.New("session not found")
+	}
+
+	if !session.IsActive(s.IdleTimeout()) || !session.User.IsActive {
+		return nil, errors.New("session not found")
+	}
+
+	session.LastSeenAt = utils.GetCurrentTS()
+	if err := s.db.Model(&session).Update("last_seen_at", session.LastSeenAt).Error; err != nil {
+		return nil, errors.New("failed to update session")
+	}
+
+	return &session, nil
+}
+
+func (s *SessionService) RevokeSession(raw string) error {
+	result := s.db.Model(&models.Session{}).
+		Where("token_hash = ? AND revoked_at IS NULL", hashSessionToken(raw)).
+		Update("revoked_at", utils.GetCurrentTS())
+	if result.Error != nil {
+		return errors.New("failed to revoke session")
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("session not found")
+	}
+
+	return nil
+}
+
+func (s *SessionService) IdleTimeout() time.Duration {
+	return time.Duration(s.config.Session.IdleTimeout) * time.Minute
+}
+
+func (s *SessionService) AbsoluteTimeout() time.Duration {
+	return time.Duration(s.config.Session.AbsoluteTimeout) * time.Hour
+}
+
+func hashSessionToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,480 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"auth-service/internal/config"
+	"auth-service/internal/models"
+	"auth-service/internal/storage"
+	"auth-service/internal/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type UserService struct {
+	db             *gorm.DB
+	config         *config.Config
+	store          storage.BlobStore
+	passwordPolicy *PasswordPolicy
+}
+
+func NewUserService(db *gorm.DB, cfg *config.Config, store storage.BlobStore, passwordPolicy *PasswordPolicy) *UserService {
+	return &UserService{
+		db:             db,
+		config:         cfg,
+		store:          store,
+		passwordPolicy: passwordPolicy,
+	}
+}
+
+type UpdateProfileRequest struct {
+	Name     *string `json:"name,omitempty"`
+	Username *string `json:"username,omitempty"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type ChangeEmailRequest struct {
+	Email           string `json:"email" binding:"required"`
+	CurrentPassword string `json:"current_password" binding:"required"`
+}
+
+// CreateUserRequest is the account an administrator creates directly.
+type CreateUserRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Username string `json:"username" binding:"required"`
+	Name     string `json:"name" binding:"required"`
+}
+
+type UserResponse struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	Username  string    `json:"username"`
+	IsActive  bool      `json:"is_active"`
+	CreatedAt string    `json:"created_at"`
+}
+
+func newUserResponse(user *models.User) *UserResponse {
+	return &UserResponse{
+		ID:        user.ID,
+		Email:     user.Email,
+		Name:      user.Name,
+		Username:  user.Username,
+		IsActive:  user.IsActive,
+		CreatedAt: user.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+func (s *UserService) GetUser(userID uuid.UUID) (*UserResponse, error) {
+	user, err := s.findActiveUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return newUserResponse(user), nil
+}
+
+func (s *UserService) UpdateProfile(userID uuid.UUID, req *UpdateProfileRequest) (*UserResponse, error) {
+	user, err := s.findActiveUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		if *req.Name == "" {
+			return nil, errors.New("name cannot be empty")
+		}
+		updates["name"] = *req.Name
+	}
+	if req.Username != nil {
+		if *req.Username == "" {
+			return nil, errors.New("username cannot be empty")
+		}
+
+		var count int64
+		if err := s.db.Model(&models.User{}).
+			Where("username = ? AND id <> ?", *req.Username, user.ID).
+			Count(&count).Error; err != nil {
+			return nil, errors.New("failed to validate username")
+		}
+		if count > 0 {
+			return nil, errors.New("username already taken")
+		}
+		updates["username"] = *req.Username
+	}
+
+	if len(updates) > 0 {
+		if err := s.db.Model(user).Updates(updates).Error; err != nil {
+			return nil, errors.New("failed to update user")
+		}
+	}
+
+	return newUserResponse(user), nil
+}
+
+// ChangePassword replaces the user's password and revokes every login session
+// and every token except the one used to make the request.
+func (s *UserService) ChangePassword(userID uuid.UUID, currentAccessToken string, req *ChangePasswordRequest) error {
+	user, err := s.findActiveUser(userID)
+	if err != nil {
+		return err
+	}
+
+	if !user.CheckPassword(req.CurrentPassword) {
+		return errors.New("invalid current password")
+	}
+
+	if err := s.passwordPolicy.Validate(req.NewPassword, user.Username, user.Email); err != nil {
+		return err
+	}
+
+	if err := user.HashPassword(req.NewPassword); err != nil {
+		return errors.New("failed to hash password")
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("password", user.Password).Error; err != nil {
+			return errors.New("failed to update password")
+		}
+
+		if err := tx.Where("authenticated_userid = ? AND access_token <> ?", user.ID.String(), currentAccessToken).
+			Delete(&models.OAuth2Token{}).Error; err != nil {
+			return errors.New("failed to revoke sessions")
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.Session{}).Error; err != nil {
+			return errors.New("failed to revoke sessions")
+		}
+
+		return nil
+	})
+}
+
+// RequestEmailChange stores a pending verification for the new address. The
+// email on the account is only replaced once VerifyEmailChange succeeds. The
+// current address can be requested too while it is unverified, to verify it.
+func (s *UserService) RequestEmailChange(userID uuid.UUID, req *ChangeEmailRequest) (*models.EmailVerification, error) {
+	user, err := s.findActiveUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.CheckPassword(req.CurrentPassword) {
+		return nil, errors.New("invalid current password")
+	}
+
+	if req.Email == user.Email && user.EmailVerifiedAt != nil {
+		return nil, errors.New("email unchanged")
+	}
+
+	var count int64
+	if err := s.db.Model(&models.User{}).Where("email = ? AND id <> ?", req.Email, user.ID).Count(&count).Error; err != nil {
+		return nil, errors.New("failed to validate email")
+	}
+	if count > 0 {
+		return nil, errors.New("email already taken")
+	}
+
+	verification := &models.EmailVerification{
+		UserID:    user.ID,
+		Email:     req.Email,
+		ExpiresAt: utils.GetCurrentTS().Add(time.Duration(s.config.Account.EmailVerificationExpiration) * time.Hour),
+	}
+
+	if err := s.db.Create(verification).Error; err != nil {
+		return nil, errors.New("failed to create email verification")
+	}
+
+	// There is no mail delivery yet. The token itself only reaches the logs
+	// in development, it is enough to confirm the change.
+	if s.config.Account.LogVerificationTokens {
+		log.Printf("Email verification token for %s: %s", verification.Email, verification.Token)
+	} else {
+		log.Printf("Email verification %s created for user %s", verification.ID, user.ID)
+	}
+
+	return verification, nil
+}
+
+func (s *UserService) VerifyEmailChange(token string) (*UserResponse, error) {
+	var verification models.EmailVerification
+	if err := s.db.Where("token = ?", token).First(&verification).Error; err != nil {
+		return nil, errors.New("invalid verification token")
+	}
+
+	if !verification.IsValid() {
+		return nil, errors.New("verification token expired or already used")
+	}
+
+	user, err := s.findActiveUser(verification.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.User{}).Where("email = ? AND id <> ?", verification.Email, user.ID).
+			Count(&count).Error; err != nil {
+			return errors.New("failed to validate email")
+		}
+		if count > 0 {
+			return errors.New("email already taken")
+		}
+
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"email":             verification.Email,
+			"email_verified_at": utils.GetCurrentTS(),
+		}).Error; err != nil {
+			return errors.New("failed to update email")
+		}
+
+		if err := tx.Model(&verification).Update("is_used", true).Error; err != nil {
+			return errors.New("failed to update email verification")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newUserResponse(user), nil
+}
+
+// CreateUser creates an active account with the same password policy and
+// default role as a registration.
+func (s *UserService) CreateUser(req *CreateUserRequest) (*UserResponse, error) {
+	var count int64
+	if err := s.db.Model(&models.User{}).Where("email = ?", req.Email).Count(&count).Error; err != nil {
+		return nil, errors.New("failed to validate email")
+	}
+	if count > 0 {
+		return nil, errors.New("email already taken")
+	}
+	if err := s.db.Model(&models.User{}).Where("username = ?", req.Username).Count(&count).Error; err != nil {
+		return nil, errors.New("failed to validate username")
+	}
+	if count > 0 {
+		return nil, errors.New("username already taken")
+	}
+
+	if err := s.passwordPolicy.Validate(req.Password, req.Username, req.Email); err != nil {
+		return nil, err
+	}
+
+	user := &models.User{
+		Email:    req.Email,
+		Username: req.Username,
+		Name:     req.Name,
+		Password: req.Password,
+		IsActive: true,
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return errors.New("failed to create user")
+		}
+
+		var role models.Role
+		if err := tx.Where("name = ?", models.RoleUser).First(&role).Error; err == nil {
+			if err := tx.Model(user).Association("Roles").Append(&role); err != nil {
+				return errors.New("failed to assign role")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newUserResponse(user), nil
+}
+
+// DisableUser deactivates an account and revokes its sessions and tokens
+// without scheduling its deletion, unlike DeactivateUser.
+func (s *UserService) DisableUser(userID uuid.UUID) error {
+	user, err := s.findActiveUser(userID)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("is_active", false).Error; err != nil {
+			return errors.New("failed to deactivate user")
+		}
+
+		return revokeUserAccess(tx, user.ID)
+	})
+}
+
+// RevokeUserTokens deletes every token and login session of a user and
+// returns how many tokens there were.
+func (s *UserService) RevokeUserTokens(userID uuid.UUID) (int64, error) {
+	var user models.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return 0, errors.New("user not found")
+		}
+		return 0, errors.New("failed to fetch user")
+	}
+
+	var revoked int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.OAuth2Token{}).
+			Where("authenticated_userid = ?", user.ID.String()).
+			Count(&revoked).Error; err != nil {
+			return errors.New("failed to revoke sessions")
+		}
+
+		return revokeUserAccess(tx, user.ID)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return revoked, nil
+}
+
+// DeactivateUser disables the account, revokes all of its sessions and tokens
+// and schedules its images for deletion after the configured grace period.
+func (s *UserService) DeactivateUser(userID uuid.UUID) error {
+	user, err := s.findActiveUser(userID)
+	if err != nil {
+		return err
+	}
+
+	return s.scheduleDeletion(user)
+}
+
+func (s *UserService) scheduleDeletion(user *models.User) error {
+	scheduledAt := utils.GetCurrentTS().Add(time.Duration(s.config.Account.DeletionGracePeriod) * time.Hour)
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"is_active":             false,
+			"deletion_scheduled_at": scheduledAt,
+		}).Error; err != nil {
+			return errors.New("failed to deactivate user")
+		}
+
+		return revokeUserAccess(tx, user.ID)
+	})
+}
+
+// revokeUserAccess deletes every access token and login session of a user.
+func revokeUserAccess(tx *gorm.DB, userID uuid.UUID) error {
+	if err := tx.Where("authenticated_userid = ?", userID.String()).
+		Delete(&models.OAuth2Token{}).Error; err != nil {
+		return errors.New("failed to revoke sessions")
+	}
+
+	if err := tx.Where("user_id = ?", userID).Delete(&models.Session{}).Error; err != nil {
+		return errors.New("failed to revoke sessions")
+	}
+
+	return nil
+}
+
+// PurgeScheduledDeletions removes the images, blobs and exports of every
+// deactivated account whose grace period has expired. An account that fails
+// is logged and skipped, it keeps its schedule and is tried again on the next
+// run. It returns how many accounts were purged.
+func (s *UserService) PurgeScheduledDeletions(ctx context.Context) (int, error) {
+	var users []models.User
+	if err := s.db.Where("is_active = ? AND deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?",
+		false, utils.GetCurrentTS()).Find(&users).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch scheduled deletions: %w", err)
+	}
+
+	purged := 0
+	for i := range users {
+		if err := s.purgeUser(ctx, &users[i]); err != nil {
+			log.Println("Failed to purge account:", err)
+			continue
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// purgeUser removes what one deactivated account left behind and clears its
+// deletion schedule last, so a failure halfway leaves it for the next run
+func (s *UserService) purgeUser(ctx context.Context, user *models.User) error {
+	var images []models.Image
+	if err := s.db.Unscoped().Where("user_id = ?", user.ID).Find(&images).Error; err != nil {
+		return fmt.Errorf("failed to fetch images for user %s: %w", user.ID, err)
+	}
+
+	for _, image := range images {
+		for _, blobID := range []uuid.UUID{image.SentImageID, image.ReceivedImageID} {
+			if err := s.store.Delete(ctx, blobName(blobID)); err != nil {
+				return fmt.Errorf("failed to remove blob %s of user %s: %w", blobID, user.ID, err)
+			}
+		}
+
+		if err := removeDerivatives(ctx, s.store, image.ID); err != nil {
+			return fmt.Errorf("failed to remove derivatives of image %s of user %s: %w", image.ID, user.ID, err)
+		}
+
+		if err := s.db.Unscoped().Delete(&image).Error; err != nil {
+			return fmt.Errorf("failed to delete image %s of user %s: %w", image.ID, user.ID, err)
+		}
+	}
+
+	if err := removeUserExports(ctx, s.db, s.store, user.ID); err != nil {
+		return fmt.Errorf("failed to remove exports for user %s: %w", user.ID, err)
+	}
+
+	if err := s.db.Model(user).Update("deletion_scheduled_at", nil).Error; err != nil {
+		return fmt.Errorf("failed to clear deletion schedule for user %s: %w", user.ID, err)
+	}
+
+	log.Printf("Purged %d images for deactivated user %s", len(images), user.ID)
+	return nil
+}
+
+// StartDeletionWorker runs PurgeScheduledDeletions on the given interval until
+// the context is cancelled.
+func (s *UserService) StartDeletionWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := s.PurgeScheduledDeletions(ctx); err != nil {
+					log.Println("Account purge failed:", err)
+				}
+			}
+		}
+	}()
+}
+
+func (s *UserService) findActiveUser(userID uuid.UUID) (*models.User, error) {
+	var user models.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("user not found")
+		}
+		return nil, errors.New("failed to fetch user")
+	}
+
+	if !user.IsActive {
+		return nil, errors.New("user not found")
+	}
+
+	return &user, nil
+}
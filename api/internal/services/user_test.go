@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-service/internal/config"
+	"auth-service/internal/models"
+	"auth-service/internal/storage"
+	"auth-service/internal/testdb"
+
+	"github.com/google/uuid"
+)
+
+// brokenDeleteStore fails every Delete of the given key
+type brokenDeleteStore struct {
+	*storage.MemoryStore
+	failKey string
+}
+
+func (s *brokenDeleteStore) Delete(ctx context.Context, key string) error {
+	if key == s.failKey {
+		return errors.New("storage unavailable")
+	}
+	return s.MemoryStore.Delete(ctx, key)
+}
+
+func TestPurgeScheduledDeletionsSkipsFailingAccount(t *testing.T) {
+	db := testdb.Open(t)
+	store := &brokenDeleteStore{MemoryStore: storage.NewMemoryStore()}
+	service := NewUserService(db, &config.Config{}, store, nil)
+	ctx := context.Background()
+
+	scheduled := time.Now().Add(-time.Hour)
+	images := map[uuid.UUID]models.Image{}
+	for _, name := range []string{"failing", "healthy"} {
+		userID := newTestUser(t, db)
+		if err := db.Model(&models.User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{"is_active": false, "deletion_scheduled_at": scheduled}).Error; err != nil {
+			t.Fatal(err)
+		}
+		image := models.Image{UserID: userID, SentImageID: uuid.New(), ReceivedImageID: uuid.New()}
+		if err := db.Create(&image).Error; err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range []uuid.UUID{image.SentImageID, image.ReceivedImageID} {
+			if err := store.Put(ctx, blobName(id), strings.NewReader(name), int64(len(name)), "image/png"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if name == "failing" {
+			store.failKey = blobName(image.SentImageID)
+		}
+		images[userID] = image
+	}
+
+	purged, err := service.PurgeScheduledDeletions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 1 {
+		t.Errorf("purged %d accounts, want 1", purged)
+	}
+
+	for userID, image := range images {
+		failing := store.failKey == blobName(image.SentImageID)
+
+		var user models.User
+		if err := db.First(&user, "id = ?", userID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if (user.DeletionScheduledAt != nil) != failing {
+			t.Errorf("user %s: deletion_scheduled_at = %v, failing = %v", userID, user.DeletionScheduledAt, failing)
+		}
+
+		var rows int64
+		db.Unscoped().Model(&models.Image{}).Where("id = ?", image.ID).Count(&rows)
+		if (rows == 1) != failing {
+			t.Errorf("user %s: image row kept = %v, failing = %v", userID, rows == 1, failing)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Package storage keeps the blobs of the service (drawings, segmentations and
+// export archives) behind one interface, so the API runs against MinIO in
+// production, a local directory in development and memory in tests.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"auth-service/internal/config"
+)
+
+const (
+	BackendMinio      = "minio"
+	BackendFilesystem = "filesystem"
+	BackendMemory     = "memory"
+)
+
+const (
+	URLModePresign = "presign"
+	URLModeSigned  = "signed"
+)
+
+var (
+	// ErrNotFound is returned by Get and Stat for a key that does not exist
+	ErrNotFound = errors.New("blob not found")
+	// ErrPresignUnsupported is returned by PresignGet on backends that cannot
+	// be reached by the client directly
+	ErrPresignUnsupported = errors.New("presigned URLs are not supported by this storage backend")
+)
+
+// ObjectInfo describes a stored blob
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// Object is an open blob, it can seek so ranges can be served from it
+type Object interface {
+	io.ReadSeekCloser
+}
+
+// BlobStore is a flat key/value store of blobs. Keys use / as separator,
+// "exports/<id>.zip" for example.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens a blob, the caller must close it
+	Get(ctx context.Context, key string) (Object, *ObjectInfo, error)
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// Delete removes a blob, a key that does not exist is not an error
+	Delete(ctx context.Context, key string) error
+	// List calls fn for every blob whose key starts with prefix, stopping at
+	// the first error fn returns
+	List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+	// PresignGet returns a URL the client can download the blob from without
+	// credentials until expiry
+	PresignGet(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// New builds the store selected by STORAGE_BACKEND.
+func New(ctx context.Context, cfg *config.Config) (BlobStore, error) {
+	switch cfg.Storage.Backend {
+	case BackendMinio:
+		return NewMinioStore(ctx, cfg.Minio, cfg.Storage.Bucket)
+	case BackendFilesystem:
+		return NewFilesystemStore(cfg.Storage.Path)
+	case BackendMemory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+	}
+}
@@ -0,0 +1,78 @@
+// Package testdb gives tests a database with the schema of the models
+// without a Postgres server. It is an in-memory SQLite database, so tests
+// that need Postgres-only SQL do not belong on it.
+package testdb
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"auth-service/internal/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+var databases atomic.Int64
+
+// Open returns a fresh migrated database that is closed when the test ends
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	// Foreign keys are enforced so deletes cascade as they do on Postgres
+	dsn := fmt.Sprintf("file:testdb%d?mode=memory&cache=shared&_foreign_keys=on", databases.Add(1))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+
+	for _, model := range models.All {
+		if err := adaptSchema(db, model); err != nil {
+			t.Fatalf("parse %T: %v", model, err)
+		}
+	}
+	if err := db.AutoMigrate(models.All...); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// adaptSchema drops what SQLite cannot create from the cached schema of a
+// model: gen_random_uuid() defaults, which the BeforeCreate hooks make
+// unnecessary, and GIN indexes.
+func adaptSchema(db *gorm.DB, model interface{}) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+
+	adapt := func(fields []*schema.Field) {
+		for _, field := range fields {
+			if field.DefaultValue == "gen_random_uuid()" {
+				field.DefaultValue = ""
+				field.DefaultValueInterface = nil
+				field.HasDefaultValue = false
+			}
+			field.Tag = reflect.StructTag(strings.ReplaceAll(string(field.Tag), ",type:gin", ""))
+		}
+	}
+
+	adapt(stmt.Schema.Fields)
+	for _, relation := range stmt.Schema.Relationships.Relations {
+		if relation.JoinTable != nil {
+			adapt(relation.JoinTable.Fields)
+		}
+	}
+	return nil
+}
@@ -197,56 +197,34 @@ const DrawingCanvas: React.FC<DrawingCanvasProps> = ({ onDrawingComplete }) => {
       }
 
       const formData = new FormData();
-      formData.append("image", blob, "processed.jpg");
+      formData.append("drawing", blob, "drawing.png");
 
-      let newBase64Img = "";
+      // The API runs the model and stores both images in one request
       try {
         const response = await axios.post(
-          "https://10.49.12.47:8443/api/v1/inference",
+          `${import.meta.env.VITE_API_URL}/api/v1/inferences`,
           formData,
+          {
+            headers: {
+              "Content-Type": "multipart/form-data",
+              Authorization: `Bearer ${localStorage.getItem("access_token")}`,
+            },
+          },
         );
-        newBase64Img = response.data.segmentation_base64; 
-        setCurrBase64Img(newBase64Img); 
+        const newBase64Img = response.data.segmentation_base64;
+        setCurrBase64Img(newBase64Img);
+        // Tell parent to update the history
+        onDrawingComplete(newBase64Img);
+        enqueueSnackbar(t("drawing_saved"), { variant: "success" });
       } catch (error: unknown) {
-        if (error instanceof Error) {
-          console.error("Upload error:", error.message);
-        } else if (typeof error === "object" && error !== null && "response" in error && typeof (error as any).response === "object" && (error as any).response !== null && "data" in (error as any).response) {
-          console.error("Upload error: ", (error as any).response.data);
+        if (axios.isAxiosError(error)) {
+          console.warn("Inference failed:", error.response?.data ?? error.message);
         } else {
-          console.error("Unknown upload error:", error);
+          console.error("Unknown inference error:", error);
         }
-      } finally {
-        const uploadFormData = new FormData();
-        uploadFormData.append("original_image", blob, "original.jpg");
-        // Convert the base64 image to a Blob
-        const byteString = atob(newBase64Img);
-        const ab = new ArrayBuffer(byteString.length);
-        const ia = new Uint8Array(ab);
-        for (let i = 0; i < byteString.length; i++) {
-          ia[i] = byteString.charCodeAt(i);
-        }
-        const base64Blob = new Blob([ab], { type: "image/png" });
-        uploadFormData.append("inference_image", base64Blob, "inference.jpg");
-        return axios.post(
-            `${import.meta.env.VITE_API_URL}/api/v1/images`,
-            uploadFormData,
-            {
-              headers: {
-                "Content-Type": "multipart/form-data",
-                Authorization: `Bearer ${localStorage.getItem("access_token")}`,
-              },
-            }
-          ).then(() => {
-          // Tell parent to update the history
-          onDrawingComplete(currBase64Img);
-          enqueueSnackbar(t("drawing_saved"), { variant: "success" });
-        })
-        .catch(error => {
-          console.warn("Image upload failed:", error.message);
-          enqueueSnackbar(t("error_saving_drawing"), { variant: "error" });
-        });
+        enqueueSnackbar(t("error_saving_drawing"), { variant: "error" });
       }
-    }, "image/jpeg");
+    }, "image/png");
   };
 
   useEffect(() => {
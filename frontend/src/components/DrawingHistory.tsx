@@ -24,48 +24,46 @@ const DrawingHistory: React.FC<DrawingHistoryProps> = ({
   const { t } = useTranslation();
 
   useEffect(() => {
-    const fetchBlobs = async () => {
-      const newBlobURLs: Record<string, string> = {};
+    // The API hands out short-lived URLs, the images are then loaded straight
+    // from storage instead of being proxied through the backend. The cards
+    // only need thumbnails, not the full PNGs
+    const fetchImageUrl = async (id: string, kind: "sent" | "received") => {
+      const response = await axios.get(
+        `${import.meta.env.VITE_API_URL}/api/v1/images/${id}/url`,
+        {
+          headers: {
+            Authorization: `Bearer ${localStorage.getItem("access_token")}`,
+          },
+          params: { kind, variant: "thumb_256" },
+        },
+      );
+      return response.data.url as string;
+    };
+
+    const fetchUrls = async () => {
+      const newImageUrls: Record<string, string> = {};
 
       await Promise.all(
         imagesData.map(async (img) => {
           try {
-            const [sentBlob, receivedBlob] = await Promise.all([
-              axios.get(
-                `${import.meta.env.VITE_API_URL}/api/v1/images/blob/${img.sent_image_id}`,
-                {
-                  headers: {
-                    Authorization: `Bearer ${localStorage.getItem("access_token")}`,
-                  },
-                  responseType: "blob",
-                },
-              ),
-              axios.get(
-                `${import.meta.env.VITE_API_URL}/api/v1/images/blob/${img.received_image_id}`,
-                {
-                  headers: {
-                    Authorization: `Bearer ${localStorage.getItem("access_token")}`,
-                  },
-                  responseType: "blob",
-                },
-              ),
+            const [sentUrl, receivedUrl] = await Promise.all([
+              fetchImageUrl(img.id, "sent"),
+              fetchImageUrl(img.id, "received"),
             ]);
 
-            newBlobURLs[img.sent_image_id] = URL.createObjectURL(sentBlob.data);
-            newBlobURLs[img.received_image_id] = URL.createObjectURL(
-              receivedBlob.data,
-            );
+            newImageUrls[img.sent_image_id] = sentUrl;
+            newImageUrls[img.received_image_id] = receivedUrl;
           } catch (err) {
-            console.error("Error fetching image blob", err);
+            console.error("Error fetching image URL", err);
           }
         }),
       );
 
-      setImageUrls(newBlobURLs);
+      setImageUrls(newImageUrls);
     };
 
     if (imagesData.length > 0) {
-      fetchBlobs();
+      fetchUrls();
     }
   }, [imagesData]);
 
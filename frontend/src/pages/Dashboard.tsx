@@ -15,6 +15,7 @@ import { useTranslation } from "react-i18next";
 import { useLocation } from "react-router-dom";
 
 export interface ImageMetadata {
+  id: string;
   sent_image_id: string;
   received_image_id: string;
   created_at: Date;
@@ -82,6 +83,7 @@ const Dashboard: React.FC = () => {
       .then((response) => {
         const fetchedImagesData: ImageMetadata[] = response.data.data.map(
           (item: ImageMetadata) => ({
+            id: item.id,
             sent_image_id: item.sent_image_id,
             received_image_id: item.received_image_id,
             created_at: item.created_at,
@@ -38,6 +38,7 @@ func main() {
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("POST /logs", routes.PostLog)
+	mux.HandleFunc("GET /logs", routes.RequireToken(routes.GetLogs))
 
 	server := &http.Server{
 		Addr:    port,
@@ -25,6 +25,10 @@ type KongLogEntry struct {
 	RouteID           string    `json:"route_id"`
 	RouteName         string    `json:"route_name"`
 	StartedAt         time.Time `json:"started_at"`
+	// Taken from an X-Authenticated-Userid response header when an upstream
+	// sets one, used to attribute entries to a user for data exports. The
+	// auth API does not, it keeps user IDs out of its responses.
+	AuthenticatedUserID string `json:"authenticated_userid,omitempty"`
 }
 
 func parseHeaderInt(value string) int {
@@ -59,5 +63,7 @@ func MapKongLogToEntry(raw *KongLog) KongLogEntry {
 		RouteID:           raw.Route.ID,
 		RouteName:         raw.Route.Name,
 		StartedAt:         time.UnixMilli(raw.StartedAt),
+
+		AuthenticatedUserID: raw.Response.Headers["x-authenticated-userid"],
 	}
 }
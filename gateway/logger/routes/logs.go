@@ -2,6 +2,9 @@
 
 Contains the API routes to handle kong logs
 - PostLog: Adds a Kong log to the database
+- GetLogs: Lists the logs attributed to an authenticated user, behind
+  RequireToken
+- RequireToken: Only lets requests with the shared read token through
 
 Joaquin Badillo
 2024-04-14
@@ -11,14 +14,20 @@ package routes
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"log"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"ccs/logger/db"
 	"ccs/logger/lib"
 	"ccs/logger/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func PostLog(w http.ResponseWriter, r *http.Request) {
@@ -53,3 +62,63 @@ func PostLog(w http.ResponseWriter, r *http.Request) {
 
 	lib.WriteResponse(res.InsertedID, w, http.StatusOK)
 }
+
+func GetLogs(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("authenticated_userid")
+	if userID == "" {
+		http.Error(w, "authenticated_userid is required", http.StatusBadRequest)
+		return
+	}
+
+	client, err := db.GetMongoClient()
+	if err != nil {
+		log.Printf("MongoDB error: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	collection := client.Database("logs").Collection("gateway")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "startedat", Value: 1}})
+	cursor, err := collection.Find(ctx, bson.M{"authenticateduserid": userID}, opts)
+	if err != nil {
+		log.Printf("MongoDB find error: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	entries := []models.KongLogEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		log.Printf("MongoDB cursor error: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	lib.WriteResponse(entries, w, http.StatusOK)
+}
+
+// RequireToken wraps a handler so it only answers requests carrying
+// "Authorization: Bearer $LOGGER_READ_TOKEN". Logs hold every user's requests,
+// so reads are refused altogether while the token is not configured.
+func RequireToken(next http.HandlerFunc) http.HandlerFunc {
+	token := os.Getenv("LOGGER_READ_TOKEN")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.Error(w, "Log reads are disabled, set LOGGER_READ_TOKEN", http.StatusForbidden)
+			return
+		}
+
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -1,4 +1,5 @@
 import io
+import os
 import base64
 import torch
 import numpy as np
@@ -9,7 +10,9 @@ from fastapi.responses import JSONResponse
 from fastapi.middleware.cors import CORSMiddleware
 from PIL import Image
 
-from model import model
+from model import model, ckpt_file
+
+MODEL_VERSION = os.getenv("MODEL_VERSION", ckpt_file)
 
 app = FastAPI()
 
@@ -64,9 +67,19 @@ async def segment_image(image: UploadFile = File(...)):
         x = preprocess_image(image)
         if isinstance(x, JSONResponse):
             return x  # Return error response if preprocessing failed
-        segmentation_rgb = model.inference(x)  # shape: (H, W, 3)
+        pred, confidences = model.predict(x)
+        segmentation_rgb = model.render(pred)  # shape: (H, W, 3)
         img_b64 = image_to_base64(segmentation_rgb)
-        return JSONResponse(content={"segmentation_base64": img_b64})
+        height, width = pred.shape
+        return JSONResponse(content={
+            "segmentation_base64": img_b64,
+            # one byte per pixel with its class, row by row
+            "class_map_base64": base64.b64encode(pred.astype(np.uint8).tobytes()).decode(),
+            "width": width,
+            "height": height,
+            "confidences": confidences,
+            "model_version": MODEL_VERSION,
+        })
 
     except Exception as e:
         return JSONResponse(status_code=500, content={"error": str(e)})
@@ -99,7 +99,9 @@ class UNetCE(L.LightningModule):
     def forward(self, x):
         return self.unet(x)
 
-    def inference(self, x, device=None):
+    def predict(self, x, device=None):
+        """Returns the class of every pixel (0 background, 1-9 digits 1-9,
+        10 digit 0) and the mean probability of each predicted digit."""
         if device is None:
             device = torch.device("cuda" if torch.cuda.is_available() else "cpu")       
         
@@ -108,9 +110,24 @@ class UNetCE(L.LightningModule):
 
         with torch.no_grad():
             logits = self.forward(x.to(device)) 
-            pred = torch.nn.functional.softmax(logits[0], dim=0).argmax(dim=0)
+            probs = torch.nn.functional.softmax(logits[0], dim=0)
+            conf, pred = probs.max(dim=0)
             pred = pred.cpu().numpy()
+            conf = conf.cpu().numpy()
+
+        confidences = {}
+        for cls in np.unique(pred):
+            if cls == 0:
+                continue
+            confidences[str(int(cls) % 10)] = float(conf[pred == cls].mean())
+
+        return pred, confidences
+
+    def inference(self, x, device=None):
+        pred, _ = self.predict(x, device)
+        return self.render(pred)
 
+    def render(self, pred):
         digit_colors = ['black', 'red', 'orange', 'yellow', 'lime',
                         'lightgreen', 'cyan', 'blue', 'indigo', 'purple',
                         'violet']